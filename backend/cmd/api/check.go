@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"go-backend/internal/config"
+	"go-backend/internal/session"
+)
+
+// checkConfig validates the configuration without connecting to anything and lists where
+// every variable came from. Values are not printed since some of them are credentials.
+func checkConfig() int {
+	config.InitConfig()
+	settings, err := config.LoadEnv()
+	if err == nil {
+		err = session.LoadPolicies()
+	}
+
+	for _, setting := range settings {
+		fmt.Printf("  %-32s %s\n", setting.Name, setting.Source)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nConfiguration is invalid:\n%v\n", err)
+		return 1
+	}
+
+	fmt.Println("\n✓ Configuration is valid")
+	return 0
+}
@@ -1,17 +1,44 @@
 package main
 
 import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"go-backend/internal/bootstrap"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if len(os.Args) == 3 && os.Args[1] == "config" && os.Args[2] == "check" {
+			os.Exit(checkConfig())
+		}
+		log.Fatalf("Unknown command %q, usage: api [config check]", os.Args[1:])
+	}
+
 	app := fiber.New(fiber.Config{
 		AppName: "KS_WEALTH_API",
 	})
 
-	bootstrap.InitializeApp(app)
+	shutdown := bootstrap.InitializeApp(app)
+
+	go func() {
+		if err := app.Listen(":8080"); err != nil {
+			log.Printf("Server stopped: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
 
-	app.Listen(":8080")
+	log.Println("Shutting down...")
+	if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
+	}
+	shutdown()
 }
@@ -0,0 +1,32 @@
+// Command sealsecrets encrypts a JSON object of secrets for the encrypted-file secret provider.
+//
+//	SECRETS_FILE_KEY=$(openssl rand -base64 32) go run ./cmd/sealsecrets < secrets.json > secrets.enc
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"os"
+
+	"go-backend/internal/config"
+)
+
+func main() {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("SECRETS_FILE_KEY"))
+	if err != nil || len(key) != 32 {
+		log.Fatal("SECRETS_FILE_KEY must be a base64 encoded 32 byte key")
+	}
+
+	var secrets map[string]string
+	if err := json.NewDecoder(os.Stdin).Decode(&secrets); err != nil {
+		log.Fatalf("reading secrets from stdin: %v", err)
+	}
+
+	sealed, err := config.SealSecretsFile(key, secrets)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Stdout.Write(sealed)
+}
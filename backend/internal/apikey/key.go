@@ -0,0 +1,70 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+)
+
+// keys look like ksk_<id>_<secret>, the id is stored in clear for the lookup and only a hash
+// of the secret is kept
+const keyPrefix = "ksk"
+
+// Key is a stored API key, the secret itself is only returned once by Store.Create
+type Key struct {
+	ID         string `json:"id" redis:"id"`
+	Name       string `json:"name" redis:"name"`
+	OwnerID    string `json:"ownerId" redis:"ownerId"`
+	OwnerName  string `json:"ownerName" redis:"ownerName"`
+	Role       string `json:"role" redis:"role"`
+	Scope      string `json:"scope" redis:"scope"`
+	CreatedAt  int64  `json:"createdAt" redis:"createdAt"`
+	ExpiresAt  int64  `json:"expiresAt" redis:"expiresAt"`
+	LastUsedAt int64  `json:"lastUsedAt,omitempty" redis:"lastUsedAt"`
+
+	Hash string `json:"-" redis:"hash"`
+}
+
+func (k Key) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(k.Scope), scope)
+}
+
+func (k Key) Expired(now time.Time) bool {
+	return !now.Before(time.Unix(k.ExpiresAt, 0))
+}
+
+// generate returns a new key, its id and the hash of its secret
+func generate() (key, id, hash string, err error) {
+	idBytes := make([]byte, 6)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", "", err
+	}
+
+	id = hex.EncodeToString(idBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+	return keyPrefix + "_" + id + "_" + secret, id, hashSecret(secret), nil
+}
+
+// parse splits a presented key into its id and secret. The secret may contain underscores.
+func parse(key string) (id, secret string, ok bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != keyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// hashSecret is a plain SHA-256, the secret is 256 random bits so a slow password hash
+// would only add latency to every request
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerateParse(t *testing.T) {
+	key, id, hash, err := generate()
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+
+	gotID, secret, ok := parse(key)
+	if !ok || gotID != id || hashSecret(secret) != hash {
+		t.Errorf("parse(%q) = %q, %q, %v, want id %q and secret matching the hash", key, gotID, secret, ok, id)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		wantID     string
+		wantSecret string
+		wantOK     bool
+	}{
+		{name: "Valid key", key: "ksk_a1b2c3_secret", wantID: "a1b2c3", wantSecret: "secret", wantOK: true},
+		{name: "Secret with underscores", key: "ksk_a1b2c3_se_cr_et", wantID: "a1b2c3", wantSecret: "se_cr_et", wantOK: true},
+		{name: "Wrong prefix", key: "abc_a1b2c3_secret"},
+		{name: "Missing secret", key: "ksk_a1b2c3_"},
+		{name: "Missing id", key: "ksk__secret"},
+		{name: "Bearer token", key: "eyJhbGciOiJIUzI1NiJ9.e30.sig"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, secret, ok := parse(tt.key)
+			if id != tt.wantID || secret != tt.wantSecret || ok != tt.wantOK {
+				t.Errorf("parse() = %q, %q, %v, want %q, %q, %v", id, secret, ok, tt.wantID, tt.wantSecret, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	now := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	key := Key{Scope: "files admin", ExpiresAt: now.Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name        string
+		scope       string
+		now         time.Time
+		wantScope   bool
+		wantExpired bool
+	}{
+		{name: "Granted scope", scope: "files", now: now, wantScope: true},
+		{name: "Scope not granted", scope: "openid", now: now},
+		{name: "Empty scope", scope: "", now: now},
+		{name: "Expired", scope: "files", now: now.Add(time.Hour), wantScope: true, wantExpired: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := key.HasScope(tt.scope); got != tt.wantScope {
+				t.Errorf("HasScope(%q) = %v, want %v", tt.scope, got, tt.wantScope)
+			}
+			if got := key.Expired(tt.now); got != tt.wantExpired {
+				t.Errorf("Expired() = %v, want %v", got, tt.wantExpired)
+			}
+		})
+	}
+}
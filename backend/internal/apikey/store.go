@@ -0,0 +1,325 @@
+package apikey
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// last-used timestamps are written at most this often per key
+const lastUsedResolution = time.Minute
+
+// touchScript records the last use only while the key exists, a key revoked concurrently
+// is not recreated without its expiry
+var touchScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('HSET', KEYS[1], 'lastUsedAt', ARGV[1])
+	return 1
+end
+return 0
+`)
+
+var (
+	ErrInvalidKey = errors.New("api key is invalid or expired")
+	ErrNotFound   = errors.New("not found")
+)
+
+// service account ids carry this prefix, every other owner is a user
+const serviceAccountPrefix = "sa-"
+
+// UserRoleFunc returns the current role of the user userID named username, ok is false once
+// the account is gone
+type UserRoleFunc func(userID, username string) (string, bool)
+
+// userRole resolves owners that are users, until the user store registers no user has a role
+var userRole UserRoleFunc = func(string, string) (string, bool) { return "", false }
+
+// ResolveUserRolesWith sets where the current role of users owning keys comes from
+func ResolveUserRolesWith(fn UserRoleFunc) {
+	userRole = fn
+}
+
+// Owner is the user or service account a key acts as
+type Owner struct {
+	ID   string
+	Name string
+	Role string
+}
+
+// ServiceAccount is a non-human account without a password, it only authenticates with
+// API keys created by an admin
+type ServiceAccount struct {
+	ID        string `json:"id" redis:"id"`
+	Name      string `json:"name" redis:"name"`
+	Role      string `json:"role" redis:"role"`
+	CreatedBy string `json:"createdBy" redis:"createdBy"`
+	CreatedAt int64  `json:"createdAt" redis:"createdAt"`
+}
+
+func (a ServiceAccount) Owner() Owner {
+	return Owner{ID: a.ID, Name: a.Name, Role: a.Role}
+}
+
+// Store keeps API keys and service accounts in Redis. A key lives in api_key:<id> until it
+// expires, api_keys:<ownerId> indexes the keys of an owner.
+type Store struct {
+	redisClient *redis.Client
+}
+
+func NewStore(redisClient *redis.Client) *Store {
+	return &Store{redisClient: redisClient}
+}
+
+// Create stores a new key for owner and returns it, together with the only copy of the full key
+func (s *Store) Create(ctx context.Context, owner Owner, name string, scopes []string, expiresAt time.Time) (string, Key, error) {
+	secret, id, hash, err := generate()
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	key := Key{
+		ID:        id,
+		Name:      name,
+		OwnerID:   owner.ID,
+		OwnerName: owner.Name,
+		Role:      owner.Role,
+		Scope:     strings.Join(scopes, " "),
+		CreatedAt: time.Now().Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		Hash:      hash,
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	pipe.HSet(ctx, keyKey(id), map[string]interface{}{
+		"id":        key.ID,
+		"name":      key.Name,
+		"ownerId":   key.OwnerID,
+		"ownerName": key.OwnerName,
+		"role":      key.Role,
+		"scope":     key.Scope,
+		"createdAt": key.CreatedAt,
+		"expiresAt": key.ExpiresAt,
+		"hash":      key.Hash,
+	})
+	pipe.ExpireAt(ctx, keyKey(id), expiresAt)
+	pipe.SAdd(ctx, ownerKeysKey(owner.ID), id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", Key{}, err
+	}
+
+	return secret, key, nil
+}
+
+// Verify looks up a presented key and records its use. The key acts with the role its owner
+// has now, not the one at creation, and stops working once the owner is gone.
+func (s *Store) Verify(ctx context.Context, presented string, now time.Time) (Key, error) {
+	id, secret, ok := parse(presented)
+	if !ok {
+		return Key{}, ErrInvalidKey
+	}
+
+	key, err := s.get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return Key{}, ErrInvalidKey
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.Hash)) != 1 || key.Expired(now) {
+		return Key{}, ErrInvalidKey
+	}
+
+	key.Role, err = s.ownerRole(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return Key{}, ErrInvalidKey
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	if now.Sub(time.Unix(key.LastUsedAt, 0)) >= lastUsedResolution {
+		key.LastUsedAt = now.Unix()
+		touchScript.Run(ctx, s.redisClient, []string{keyKey(id)}, key.LastUsedAt)
+	}
+
+	return key, nil
+}
+
+// List returns the live keys of an owner
+func (s *Store) List(ctx context.Context, ownerID string) ([]Key, error) {
+	ids, err := s.redisClient.SMembers(ctx, ownerKeysKey(ownerID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []Key{}
+	for _, id := range ids {
+		key, err := s.get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			// expired, drop it from the index
+			s.redisClient.SRem(ctx, ownerKeysKey(ownerID), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Revoke deletes a key of ownerID, keys of other owners are ErrNotFound
+func (s *Store) Revoke(ctx context.Context, ownerID, id string) error {
+	key, err := s.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.OwnerID != ownerID {
+		return ErrNotFound
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	pipe.Del(ctx, keyKey(id))
+	pipe.SRem(ctx, ownerKeysKey(ownerID), id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RevokeAll deletes every key of ownerID
+func (s *Store) RevokeAll(ctx context.Context, ownerID string) error {
+	ids, err := s.redisClient.SMembers(ctx, ownerKeysKey(ownerID)).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	for _, id := range ids {
+		pipe.Del(ctx, keyKey(id))
+	}
+	pipe.Del(ctx, ownerKeysKey(ownerID))
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *Store) CreateServiceAccount(ctx context.Context, name, role, createdBy string) (ServiceAccount, error) {
+	account := ServiceAccount{
+		ID:        serviceAccountPrefix + uuid.New().String(),
+		Name:      name,
+		Role:      role,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	pipe.HSet(ctx, serviceAccountKey(account.ID), map[string]interface{}{
+		"id":        account.ID,
+		"name":      account.Name,
+		"role":      account.Role,
+		"createdBy": account.CreatedBy,
+		"createdAt": account.CreatedAt,
+	})
+	pipe.SAdd(ctx, "service_accounts", account.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return ServiceAccount{}, err
+	}
+
+	return account, nil
+}
+
+func (s *Store) ServiceAccount(ctx context.Context, id string) (ServiceAccount, error) {
+	cmd := s.redisClient.HGetAll(ctx, serviceAccountKey(id))
+	if err := cmd.Err(); err != nil {
+		return ServiceAccount{}, err
+	}
+	if len(cmd.Val()) == 0 {
+		return ServiceAccount{}, ErrNotFound
+	}
+
+	var account ServiceAccount
+	err := cmd.Scan(&account)
+	return account, err
+}
+
+func (s *Store) ServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	ids, err := s.redisClient.SMembers(ctx, "service_accounts").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []ServiceAccount{}
+	for _, id := range ids {
+		account, err := s.ServiceAccount(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+// DeleteServiceAccount removes the account and revokes its keys
+func (s *Store) DeleteServiceAccount(ctx context.Context, id string) error {
+	if _, err := s.ServiceAccount(ctx, id); err != nil {
+		return err
+	}
+	if err := s.RevokeAll(ctx, id); err != nil {
+		return err
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	pipe.Del(ctx, serviceAccountKey(id))
+	pipe.SRem(ctx, "service_accounts", id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ownerRole is the current role of the owner of key, ErrNotFound once the owner is gone
+func (s *Store) ownerRole(ctx context.Context, key Key) (string, error) {
+	if strings.HasPrefix(key.OwnerID, serviceAccountPrefix) {
+		account, err := s.ServiceAccount(ctx, key.OwnerID)
+		return account.Role, err
+	}
+
+	role, ok := userRole(key.OwnerID, key.OwnerName)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return role, nil
+}
+
+func (s *Store) get(ctx context.Context, id string) (Key, error) {
+	cmd := s.redisClient.HGetAll(ctx, keyKey(id))
+	if err := cmd.Err(); err != nil {
+		return Key{}, err
+	}
+	if len(cmd.Val()) == 0 {
+		return Key{}, ErrNotFound
+	}
+
+	var key Key
+	err := cmd.Scan(&key)
+	return key, err
+}
+
+func keyKey(id string) string {
+	return fmt.Sprintf("api_key:%s", id)
+}
+
+func ownerKeysKey(ownerID string) string {
+	return fmt.Sprintf("api_keys:%s", ownerID)
+}
+
+func serviceAccountKey(id string) string {
+	return fmt.Sprintf("service_account:%s", id)
+}
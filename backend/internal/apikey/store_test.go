@@ -0,0 +1,177 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testUsers stands in for the user store, mapping user ids to their current role
+func testUsers(t *testing.T, roles map[string]string) {
+	t.Helper()
+	saved := userRole
+	userRole = func(userID, username string) (string, bool) {
+		role, ok := roles[userID]
+		return role, ok && username == "user-"+userID
+	}
+	t.Cleanup(func() { userRole = saved })
+}
+
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	return NewStore(redisClient), mr
+}
+
+func TestStore_Verify(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newTestStore(t)
+	roles := map[string]string{"7": "admin"}
+	testUsers(t, roles)
+	now := time.Now()
+
+	secret, created, err := store.Create(ctx, Owner{ID: "7", Name: "user-7", Role: "admin"}, "ci", []string{"files"}, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists(keyKey(created.ID)) || mr.TTL(keyKey(created.ID)) <= 0 {
+		t.Fatal("key stored without its expiry")
+	}
+
+	key, err := store.Verify(ctx, secret, now)
+	if err != nil || key.ID != created.ID || key.Role != "admin" || !key.HasScope("files") {
+		t.Fatalf("Verify() = %+v, %v, want the created key", key, err)
+	}
+
+	invalid := []struct {
+		name      string
+		presented string
+		now       time.Time
+	}{
+		{name: "Wrong secret", presented: secret + "x", now: now},
+		{name: "Unknown id", presented: "ksk_000000000000_secret", now: now},
+		{name: "Malformed", presented: "not-a-key", now: now},
+		{name: "Expired", presented: secret, now: now.Add(time.Hour)},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Verify(ctx, tt.presented, tt.now); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Verify() error = %v, want ErrInvalidKey", err)
+			}
+		})
+	}
+
+	t.Run("Owner demoted", func(t *testing.T) {
+		roles["7"] = "user"
+		t.Cleanup(func() { roles["7"] = "admin" })
+		if key, err := store.Verify(ctx, secret, now); err != nil || key.Role != "user" {
+			t.Errorf("Verify() role = %q, %v, want the owner's current role user", key.Role, err)
+		}
+	})
+	t.Run("Owner deleted", func(t *testing.T) {
+		delete(roles, "7")
+		t.Cleanup(func() { roles["7"] = "admin" })
+		if _, err := store.Verify(ctx, secret, now); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Verify() error = %v, want ErrInvalidKey", err)
+		}
+	})
+}
+
+func TestStore_VerifyRecordsUse(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newTestStore(t)
+	testUsers(t, map[string]string{"7": "user"})
+	now := time.Now()
+
+	secret, created, _ := store.Create(ctx, Owner{ID: "7", Name: "user-7", Role: "user"}, "ci", []string{"files"}, now.Add(time.Hour))
+
+	store.Verify(ctx, secret, now)
+	if got := mr.HGet(keyKey(created.ID), "lastUsedAt"); got != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("lastUsedAt = %q, want the first use", got)
+	}
+	// uses within the resolution are not written
+	store.Verify(ctx, secret, now.Add(30*time.Second))
+	if got := mr.HGet(keyKey(created.ID), "lastUsedAt"); got != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("lastUsedAt = %q, want it unchanged within a minute", got)
+	}
+	store.Verify(ctx, secret, now.Add(2*time.Minute))
+	if got := mr.HGet(keyKey(created.ID), "lastUsedAt"); got != strconv.FormatInt(now.Add(2*time.Minute).Unix(), 10) {
+		t.Errorf("lastUsedAt = %q, want the later use", got)
+	}
+
+	// a key revoked between the lookup and the touch is not recreated
+	mr.Del(keyKey(created.ID))
+	touchScript.Run(ctx, store.redisClient, []string{keyKey(created.ID)}, now.Unix())
+	if mr.Exists(keyKey(created.ID)) {
+		t.Error("touch recreated a revoked key")
+	}
+}
+
+func TestStore_Revoke(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newTestStore(t)
+	testUsers(t, map[string]string{"7": "user", "8": "user"})
+	expiresAt := time.Now().Add(time.Hour)
+
+	secret, first, _ := store.Create(ctx, Owner{ID: "7", Name: "user-7", Role: "user"}, "first", []string{"files"}, expiresAt)
+	_, second, _ := store.Create(ctx, Owner{ID: "7", Name: "user-7", Role: "user"}, "second", []string{"files"}, expiresAt)
+
+	if err := store.Revoke(ctx, "8", first.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Revoke() by another owner error = %v, want ErrNotFound", err)
+	}
+	if err := store.Revoke(ctx, "7", first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Verify(ctx, secret, time.Now()); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Verify() of a revoked key error = %v, want ErrInvalidKey", err)
+	}
+
+	// an expired key is dropped from the owner's index when listed
+	mr.Del(keyKey(second.ID))
+	keys, err := store.List(ctx, "7")
+	if err != nil || len(keys) != 0 || mr.Exists(ownerKeysKey("7")) {
+		t.Errorf("List() = %+v, %v, want no keys and the index cleaned up", keys, err)
+	}
+}
+
+func TestStore_ServiceAccounts(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+	testUsers(t, nil)
+
+	account, err := store.CreateServiceAccount(ctx, "backup", "admin", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.ServiceAccount(ctx, account.ID); err != nil || got != account {
+		t.Fatalf("ServiceAccount() = %+v, %v, want %+v", got, err, account)
+	}
+	if accounts, _ := store.ServiceAccounts(ctx); len(accounts) != 1 || accounts[0] != account {
+		t.Errorf("ServiceAccounts() = %+v, want the created account", accounts)
+	}
+
+	secret, _, _ := store.Create(ctx, account.Owner(), "nightly", []string{"files", "admin"}, time.Now().Add(time.Hour))
+	if key, err := store.Verify(ctx, secret, time.Now()); err != nil || key.Role != "admin" {
+		t.Fatalf("Verify() = %+v, %v, want the service account's role", key, err)
+	}
+
+	if err := store.DeleteServiceAccount(ctx, account.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ServiceAccount(ctx, account.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ServiceAccount() after delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Verify(ctx, secret, time.Now()); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Verify() of a deleted account's key error = %v, want ErrInvalidKey", err)
+	}
+	if err := store.DeleteServiceAccount(ctx, account.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second DeleteServiceAccount() error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/apikey"
+	"go-backend/internal/config"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// scopes an API key may be granted, admin only for admins
+var apiKeyScopes = []string{shared.ScopeFiles, shared.ScopeAdmin}
+
+// roles a service account may be given
+var serviceAccountRoles = []string{"user", "admin"}
+
+// APIKeyHandler manages personal API keys and, for admins, service accounts and their keys
+type APIKeyHandler struct {
+	keys *apikey.Store
+}
+
+func NewAPIKeyHandler(keys *apikey.Store) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+func (h *APIKeyHandler) ListHandler(c *fiber.Ctx) error {
+	return h.list(c, c.Locals("userId").(string))
+}
+
+func (h *APIKeyHandler) CreateHandler(c *fiber.Ctx) error {
+	return h.create(c, apikey.Owner{
+		ID:   c.Locals("userId").(string),
+		Name: c.Locals("username").(string),
+		Role: c.Locals("role").(string),
+	})
+}
+
+func (h *APIKeyHandler) RevokeHandler(c *fiber.Ctx) error {
+	return h.revoke(c, c.Locals("userId").(string))
+}
+
+func (h *APIKeyHandler) ServiceAccountsHandler(c *fiber.Ctx) error {
+	accounts, err := h.keys.ServiceAccounts(context.Background())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "SERVICE_ACCOUNT_RETRIEVAL_FAILED",
+			Message:   "Failed to retrieve service accounts",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"serviceAccounts": accounts,
+	})
+}
+
+func (h *APIKeyHandler) CreateServiceAccountHandler(c *fiber.Ctx) error {
+	var req CreateServiceAccountRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_REQUEST",
+			Message:   "Service account name is required",
+		})
+	}
+	if !slices.Contains(serviceAccountRoles, req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_ROLE",
+			Message:   "Role must be user or admin",
+		})
+	}
+
+	account, err := h.keys.CreateServiceAccount(context.Background(), strings.TrimSpace(req.Name), req.Role, c.Locals("username").(string))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "SERVICE_ACCOUNT_CREATION_FAILED",
+			Message:   "Failed to create service account",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(account)
+}
+
+// DeleteServiceAccountHandler removes a service account and revokes all of its keys
+func (h *APIKeyHandler) DeleteServiceAccountHandler(c *fiber.Ctx) error {
+	err := h.keys.DeleteServiceAccount(context.Background(), c.Params("accountId"))
+	if errors.Is(err, apikey.ErrNotFound) {
+		return serviceAccountNotFound(c)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "SERVICE_ACCOUNT_DELETION_FAILED",
+			Message:   "Failed to delete service account",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Service account deleted",
+	})
+}
+
+func (h *APIKeyHandler) ServiceAccountKeysHandler(c *fiber.Ctx) error {
+	account, ok, err := h.serviceAccount(c)
+	if !ok {
+		return err
+	}
+	return h.list(c, account.ID)
+}
+
+func (h *APIKeyHandler) CreateServiceAccountKeyHandler(c *fiber.Ctx) error {
+	account, ok, err := h.serviceAccount(c)
+	if !ok {
+		return err
+	}
+	return h.create(c, account.Owner())
+}
+
+func (h *APIKeyHandler) RevokeServiceAccountKeyHandler(c *fiber.Ctx) error {
+	account, ok, err := h.serviceAccount(c)
+	if !ok {
+		return err
+	}
+	return h.revoke(c, account.ID)
+}
+
+func (h *APIKeyHandler) list(c *fiber.Ctx, ownerID string) error {
+	keys, err := h.keys.List(context.Background(), ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "API_KEY_RETRIEVAL_FAILED",
+			Message:   "Failed to retrieve API keys",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"apiKeys": keys,
+	})
+}
+
+// create issues a key for owner. The full key is in this response only, it is stored hashed.
+func (h *APIKeyHandler) create(c *fiber.Ctx, owner apikey.Owner) error {
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_REQUEST",
+			Message:   "API key name is required",
+		})
+	}
+
+	if len(req.Scopes) == 0 {
+		return invalidScope(c)
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) || (scope == shared.ScopeAdmin && owner.Role != "admin") {
+			return invalidScope(c)
+		}
+	}
+
+	maxTTL := config.GetConfig().Env.API_KEY_MAX_TTL
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	if ttl <= 0 || ttl > maxTTL {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_EXPIRY",
+			Message:   "expiresInDays must be between 1 and " + strconv.Itoa(int(maxTTL/(24*time.Hour))),
+		})
+	}
+
+	secret, key, err := h.keys.Create(context.Background(), owner, strings.TrimSpace(req.Name), slices.Compact(slices.Sorted(slices.Values(req.Scopes))), time.Now().Add(ttl))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "API_KEY_CREATION_FAILED",
+			Message:   "Failed to create API key",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(CreateAPIKeyResponse{Key: secret, APIKey: key})
+}
+
+func (h *APIKeyHandler) revoke(c *fiber.Ctx, ownerID string) error {
+	err := h.keys.Revoke(context.Background(), ownerID, c.Params("keyId"))
+	if errors.Is(err, apikey.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(shared.ErrorResponse{
+			ErrorCode: "API_KEY_NOT_FOUND",
+			Message:   "API key not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "API_KEY_REVOCATION_FAILED",
+			Message:   "Failed to revoke API key",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked",
+	})
+}
+
+// serviceAccount loads the :accountId of the route, ok is false once the error response is sent
+func (h *APIKeyHandler) serviceAccount(c *fiber.Ctx) (apikey.ServiceAccount, bool, error) {
+	account, err := h.keys.ServiceAccount(context.Background(), c.Params("accountId"))
+	if errors.Is(err, apikey.ErrNotFound) {
+		return account, false, serviceAccountNotFound(c)
+	}
+	if err != nil {
+		return account, false, c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "SERVICE_ACCOUNT_RETRIEVAL_FAILED",
+			Message:   "Failed to retrieve service account",
+		})
+	}
+	return account, true, nil
+}
+
+func serviceAccountNotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(shared.ErrorResponse{
+		ErrorCode: "SERVICE_ACCOUNT_NOT_FOUND",
+		Message:   "Service account not found",
+	})
+}
+
+func invalidScope(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+		ErrorCode: "INVALID_SCOPE",
+		Message:   "Scopes must be one or more of " + strings.Join(apiKeyScopes, ", ") + ", admin only for admins",
+	})
+}
@@ -8,6 +8,7 @@ package auth
 // @Tags Auth
 // @Param username body string true "Username"
 // @Param password body string true "Password"
+// @Param transport body string false "bearer (default) or cookie, cookie sets HttpOnly token cookies and returns a CSRF token for the X-CSRF-Token header"
 // @Success 200 {object} TokenResponse "Tokens and user info"
 // @Failure 400 {object} shared.ErrorResponse "Invalid request"
 // @Failure 401 {object} shared.ErrorResponse "Unauthorized"
@@ -22,3 +23,110 @@ func Login()
 // @Success 200 {string} string "Logout successful"
 // @Router /logout [post]
 func Logout()
+
+// RevokeToken
+// @Security ApiKeyAuth
+// @Tags Auth
+// @Summary Revoke a single access or refresh token of the user without ending the session
+// @Param token body string false "Token to revoke, the presented token when empty"
+// @Success 200 {string} string "Token revoked"
+// @Failure 400 {object} shared.ErrorResponse "Token is invalid or not the user's"
+// @Router /auth/tokens/revoke [post]
+func RevokeToken()
+
+// UploadAvatar
+// @Security ApiKeyAuth
+// @Tags Auth
+// @Summary Upload profile avatar (PNG, JPEG, WebP or GIF)
+// @Accept multipart/form-data
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} map[string]interface{} "Avatar URLs"
+// @Failure 400 {object} shared.ErrorResponse "Invalid image"
+// @Failure 415 {object} shared.ErrorResponse "Unsupported image format"
+// @Router /auth/profile/avatar [post]
+func UploadAvatar()
+
+// Events
+// @Security ApiKeyAuth
+// @Tags Auth
+// @Summary Stream session events (locked, unlocked, revoked, token_expiring) as Server-Sent Events
+// @Produce text/event-stream
+// @Success 200 {object} session.Event "Event stream"
+// @Failure 401 {object} shared.ErrorResponse "Unauthorized"
+// @Failure 503 {object} shared.ErrorResponse "Session events are unavailable"
+// @Router /auth/events [get]
+func Events()
+
+// OIDCLogin
+// @Tags Auth
+// @Summary Start login with an external OpenID provider (redirects to the provider)
+// @Param provider path string true "Provider name"
+// @Success 302 {string} string "Redirect to the provider"
+// @Failure 404 {object} shared.ErrorResponse "Login provider not found"
+// @Router /auth/oidc/{provider}/login [get]
+func OIDCLogin()
+
+// OIDCToken
+// @Tags Auth
+// @Summary Trade the one-time code from the OIDC callback redirect for tokens
+// @Param code body string true "Code from the callback redirect"
+// @Param transport body string false "bearer (default) or cookie"
+// @Success 200 {object} TokenResponse "Tokens and user info"
+// @Failure 401 {object} shared.ErrorResponse "Login code is invalid or expired"
+// @Router /auth/oidc/token [post]
+func OIDCToken()
+
+// CreateAPIKey
+// @Security ApiKeyAuth
+// @Tags Auth
+// @Summary Create a personal API key, the key is only shown in this response. Send it as "Authorization: ApiKey <key>".
+// @Param name body string true "Name of the key"
+// @Param scopes body []string true "files and/or admin (admins only)"
+// @Param expiresInDays body int true "Lifetime in days, at most API_KEY_MAX_TTL"
+// @Success 201 {object} CreateAPIKeyResponse "Key and its metadata"
+// @Failure 400 {object} shared.ErrorResponse "Invalid name, scope or expiry"
+// @Router /auth/api-keys [post]
+func CreateAPIKey()
+
+// ListAPIKeys
+// @Security ApiKeyAuth
+// @Tags Auth
+// @Summary List personal API keys with their last use
+// @Success 200 {object} map[string]interface{} "apiKeys: the keys, without their secret"
+// @Router /auth/api-keys [get]
+func ListAPIKeys()
+
+// RevokeAPIKey
+// @Security ApiKeyAuth
+// @Tags Auth
+// @Summary Revoke a personal API key
+// @Param keyId path string true "Key ID"
+// @Success 200 {string} string "API key revoked"
+// @Failure 404 {object} shared.ErrorResponse "API key not found"
+// @Router /auth/api-keys/{keyId} [delete]
+func RevokeAPIKey()
+
+// CreateServiceAccount
+// @Security ApiKeyAuth
+// @Tags Admin
+// @Summary Create a service account without a password, it authenticates with API keys from /admin/service-accounts/{accountId}/api-keys
+// @Param name body string true "Name of the account"
+// @Param role body string true "user or admin"
+// @Success 201 {object} apikey.ServiceAccount "Service account"
+// @Failure 400 {object} shared.ErrorResponse "Invalid name or role"
+// @Router /admin/service-accounts [post]
+func CreateServiceAccount()
+
+// ChangePassword
+// @Security ApiKeyAuth
+// @Tags Auth
+// @Summary Change the password of a local account, other sessions and OAuth grants are signed out
+// @Param currentPassword body string true "Current password"
+// @Param newPassword body string true "New password, checked against the password policy"
+// @Success 200 {string} string "Password changed successfully"
+// @Failure 400 {object} PasswordPolicyErrorResponse "New password breaks the policy, or the password is managed by LDAP"
+// @Failure 401 {object} shared.ErrorResponse "Current password is incorrect"
+// @Failure 409 {object} shared.ErrorResponse "Password was changed concurrently"
+// @Failure 500 {object} shared.ErrorResponse "Password was changed but the other sessions could not be signed out"
+// @Router /auth/change-password [post]
+func ChangePassword()
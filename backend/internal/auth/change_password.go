@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/notify"
+	"go-backend/internal/password"
+	"go-backend/internal/session"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ChangePasswordHandler changes the password of a local account and signs out everything
+// but the current session
+func (s *AuthService) ChangePasswordHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	username := c.Locals("username").(string)
+	sessionId := c.Locals("sessionId").(string)
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.CurrentPassword == "" || req.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_REQUEST",
+			Message:   "Current and new password are required",
+		})
+	}
+
+	user, exists := users.Get(username)
+	if !exists || user.UserId != userId {
+		return c.Status(fiber.StatusNotFound).JSON(shared.ErrorResponse{
+			ErrorCode: "USER_NOT_FOUND",
+			Message:   "User not found",
+		})
+	}
+	if user.Source != SourceLocal {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "PASSWORD_MANAGED_EXTERNALLY",
+			Message:   "Your password is managed by your organization's directory",
+		})
+	}
+
+	if ok, _ := password.Verify(user.Password, req.CurrentPassword); !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_PASSWORD",
+			Message:   "Current password is incorrect",
+		})
+	}
+
+	var policyErr *password.PolicyError
+	if err := s.checkNewPassword(user, req.NewPassword); errors.As(err, &policyErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(PasswordPolicyErrorResponse{
+			ErrorResponse: shared.ErrorResponse{
+				ErrorCode: "WEAK_PASSWORD",
+				Message:   policyErr.Error(),
+			},
+			Violations: policyErr.Violations,
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "PASSWORD_CHECK_FAILED",
+			Message:   "Failed to check the new password",
+		})
+	}
+
+	hash, err := s.hasher.Hash(req.NewPassword)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "PASSWORD_CHANGE_FAILED",
+			Message:   "Failed to change password",
+		})
+	}
+
+	changed := replacePassword(users, username, user.Password, hash, s.policy.HistorySize)
+	if !changed {
+		return c.Status(fiber.StatusConflict).JSON(shared.ErrorResponse{
+			ErrorCode: "PASSWORD_CHANGED_CONCURRENTLY",
+			Message:   "Password was changed meanwhile, please try again",
+		})
+	}
+
+	ctx := context.Background()
+	revoked, err := s.revokeOtherSessions(ctx, userId, sessionId)
+	if err != nil {
+		log.Printf("audit: password_changed user=%s session=%s ip=%s revocation_failed=%q", userId, sessionId, c.IP(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "SESSION_REVOCATION_FAILED",
+			Message:   "Password was changed but your other sessions could not be signed out, please log out to end them",
+		})
+	}
+	s.notifyPasswordChanged(ctx, c, user)
+	log.Printf("audit: password_changed user=%s session=%s ip=%s revoked_tokens=%d", userId, sessionId, c.IP(), revoked)
+
+	return c.JSON(fiber.Map{
+		"message": "Password changed successfully",
+	})
+}
+
+// replacePassword stores hash as the password of username if verifiedHash is still the
+// current one, a concurrent change wins
+func replacePassword(store *UserStore, username, verifiedHash, hash string, historySize int) bool {
+	_, changed := store.Update(username, func(current User, exists bool) (User, bool) {
+		if !exists || current.Password != verifiedHash {
+			return current, false
+		}
+		current.PasswordHistory = password.PushHistory(current.PasswordHistory, current.Password, historySize)
+		current.Password = hash
+		return current, true
+	})
+	return changed
+}
+
+// revocationAttempts is how often signing out the other sessions is tried before the password
+// change is reported as failed
+const revocationAttempts = 3
+
+// revokeOtherSessions deletes the refresh tokens of userId except the current session's own
+// and denies the access tokens issued to OAuth clients, the clients have to be authorized
+// again. It returns how many tokens were revoked.
+func (s *AuthService) revokeOtherSessions(ctx context.Context, userId, sessionId string) (int, error) {
+	var err error
+	for attempt := 1; attempt <= revocationAttempts; attempt++ {
+		var revoked int
+		if revoked, err = s.revokeOtherSessionsOnce(ctx, userId, sessionId); err == nil {
+			return revoked, nil
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+	return 0, err
+}
+
+func (s *AuthService) revokeOtherSessionsOnce(ctx context.Context, userId, sessionId string) (int, error) {
+	denied, err := session.DenyClientTokens(ctx, s.redisClient, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	revoke, err := s.otherRefreshTokens(ctx, userId, sessionId)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(revoke) > 0 {
+		if err := s.redisClient.Del(ctx, revoke...).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return denied + len(revoke), nil
+}
+
+// notifyPasswordChanged queues the notice of a password change, which is only sent once the
+// other sessions are signed out. The password lives in the user store, not in Redis, so the
+// notice cannot commit with it: a crash before this point loses the notice, and a failure to
+// queue it does not undo the change.
+func (s *AuthService) notifyPasswordChanged(ctx context.Context, c *fiber.Ctx, user User) {
+	if user.Email == "" {
+		return
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	err := s.outbox.Enqueue(ctx, pipe, notify.Message{
+		To:       user.Email,
+		Template: notify.TemplatePasswordChanged,
+		Locale:   notify.PreferredLocale(c.Get(fiber.HeaderAcceptLanguage)),
+		Data: map[string]string{
+			"Username": user.Username,
+			"Time":     time.Now().UTC().Format("2006-01-02 15:04 MST"),
+			"IP":       c.IP(),
+		},
+	})
+	if err == nil {
+		_, err = pipe.Exec(ctx)
+	}
+	if err != nil {
+		log.Printf("Queueing the password change notice of %s failed: %v", user.Username, err)
+	}
+}
+
+// otherRefreshTokens returns the refresh token keys of userId except the current session's
+// own. Tokens issued to OAuth clients are included.
+func (s *AuthService) otherRefreshTokens(ctx context.Context, userId, sessionId string) ([]string, error) {
+	var keys []string
+	iter := s.redisClient.Scan(ctx, 0, session.RefreshTokenKey(userId, "*"), 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	tokens, err := s.redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var revoke []string
+	for i, token := range tokens {
+		tokenString, _ := token.(string)
+		claims := &shared.Claims{}
+		_, err := jwt.ParseWithClaims(tokenString, claims, config.JWTKeyFunc)
+		if err == nil && sessionId != "" && claims.SessionID == sessionId && claims.ClientID == "" {
+			continue
+		}
+		revoke = append(revoke, keys[i])
+	}
+	return revoke, nil
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/notify"
+	"go-backend/internal/password"
+	"go-backend/internal/session"
+	"go-backend/internal/shared"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loadTestConfig loads the config from the environment with env secrets, enough to sign
+// tokens and look up session policies
+func loadTestConfig(t *testing.T) {
+	t.Helper()
+	for name, value := range map[string]string{
+		"APP_ENV":             "test",
+		"SECRET_PROVIDERS":    "env",
+		"REDIS_HOST":          "localhost",
+		"MINIO_HOST":          "localhost",
+		"MINIO_BUCKET":        "test",
+		"JWT_SECRET":          "test-jwt-secret",
+		"MINIO_ROOT_USER":     "test",
+		"MINIO_ROOT_PASSWORD": "test-password",
+	} {
+		t.Setenv(name, value)
+	}
+
+	config.InitConfig()
+	if _, err := config.LoadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := config.NewSecretChain(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadSecrets(chain); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.LoadPolicies(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var testHasher = password.Hasher{Algorithm: password.AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}
+
+func newTestService(t *testing.T) (*AuthService, *miniredis.Miniredis) {
+	t.Helper()
+	loadTestConfig(t)
+
+	mr := miniredis.RunT(t)
+	// fail fast once the server is closed
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1, DialerRetries: 1})
+	t.Cleanup(func() { redisClient.Close() })
+
+	templates, err := notify.LoadTemplates("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := notify.NewOutbox(redisClient, templates, nil, notify.RetryPolicy{MaxAttempts: 1, Lease: time.Minute})
+
+	policy := password.Policy{MinLength: 12, MaxLength: 64, RequiredClasses: []string{"lower", "digit"}, HistorySize: 2}
+	return NewAuthService(redisClient, nil, nil, nil, nil, policy, testHasher, outbox), mr
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	current, err := testHasher.Hash("current-password-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		body        ChangePasswordRequest
+		noEmail     bool
+		redisDown   bool
+		wantStatus  int
+		wantCode    string
+		wantChanged bool
+		wantRevoked bool
+	}{
+		{
+			name:       "Wrong current password",
+			body:       ChangePasswordRequest{CurrentPassword: "nope", NewPassword: "brand-new-password-2"},
+			wantStatus: fiber.StatusUnauthorized, wantCode: "INVALID_PASSWORD",
+		},
+		{
+			name:       "Policy violation",
+			body:       ChangePasswordRequest{CurrentPassword: "current-password-1", NewPassword: "short"},
+			wantStatus: fiber.StatusBadRequest, wantCode: "WEAK_PASSWORD",
+		},
+		{
+			name:       "Reusing the current password",
+			body:       ChangePasswordRequest{CurrentPassword: "current-password-1", NewPassword: "current-password-1"},
+			wantStatus: fiber.StatusBadRequest, wantCode: "WEAK_PASSWORD",
+		},
+		{
+			name:       "Changed, other sessions signed out",
+			body:       ChangePasswordRequest{CurrentPassword: "current-password-1", NewPassword: "brand-new-password-2"},
+			wantStatus: fiber.StatusOK, wantChanged: true, wantRevoked: true,
+		},
+		{
+			name:       "Without an email the sessions are still signed out",
+			body:       ChangePasswordRequest{CurrentPassword: "current-password-1", NewPassword: "brand-new-password-2"},
+			noEmail:    true,
+			wantStatus: fiber.StatusOK, wantChanged: true, wantRevoked: true,
+		},
+		{
+			name:       "Revocation failure is not reported as success",
+			body:       ChangePasswordRequest{CurrentPassword: "current-password-1", NewPassword: "brand-new-password-2"},
+			redisDown:  true,
+			wantStatus: fiber.StatusInternalServerError, wantCode: "SESSION_REVOCATION_FAILED", wantChanged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, mr := newTestService(t)
+
+			saved := users
+			alice := User{UserId: "7", Username: "alice", Password: current, Role: "user", Email: "alice@example.com", Source: SourceLocal}
+			if tt.noEmail {
+				alice.Email = ""
+			}
+			users = NewUserStore(alice)
+			t.Cleanup(func() { users = saved })
+
+			// this session, another session of the user and an OAuth client on this session
+			ownAccess, ownRefresh := issue(t, service, TokenSubject{UserID: "7", Username: "alice", Role: "user", SessionID: "s1"})
+			_, otherRefresh := issue(t, service, TokenSubject{UserID: "7", Username: "alice", Role: "user", SessionID: "s0"})
+			clientAccess, clientRefresh := issue(t, service, TokenSubject{UserID: "7", Username: "alice", Role: "user", SessionID: "s1", ClientID: "app", Scope: "profile"})
+
+			app := fiber.New()
+			app.Post("/change-password", func(c *fiber.Ctx) error {
+				c.Locals("userId", "7")
+				c.Locals("username", "alice")
+				c.Locals("sessionId", "s1")
+				return c.Next()
+			}, service.ChangePasswordHandler)
+
+			if tt.redisDown {
+				mr.Close()
+			}
+
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(fiber.MethodPost, "/change-password", bytes.NewReader(body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req, 5000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var errResp shared.ErrorResponse
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			if resp.StatusCode != tt.wantStatus || errResp.ErrorCode != tt.wantCode {
+				t.Fatalf("status = %d %q, want %d %q", resp.StatusCode, errResp.ErrorCode, tt.wantStatus, tt.wantCode)
+			}
+
+			stored, _ := users.Get("alice")
+			if changed := stored.Password != current; changed != tt.wantChanged {
+				t.Errorf("password changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if tt.redisDown {
+				return
+			}
+
+			if !mr.Exists(refreshKey(t, ownRefresh)) {
+				t.Error("refresh token of the current session was revoked")
+			}
+			if denied, _ := session.IsTokenDenied(context.Background(), service.redisClient, tokenID(t, ownAccess)); denied {
+				t.Error("access token of the current session was denied")
+			}
+
+			otherGone := !mr.Exists(refreshKey(t, otherRefresh)) && !mr.Exists(refreshKey(t, clientRefresh))
+			clientDenied, _ := session.IsTokenDenied(context.Background(), service.redisClient, tokenID(t, clientAccess))
+			if otherGone != tt.wantRevoked || clientDenied != tt.wantRevoked {
+				t.Errorf("other refresh tokens revoked = %v, client access token denied = %v, want %v", otherGone, clientDenied, tt.wantRevoked)
+			}
+
+			queued, _ := service.redisClient.ZCard(context.Background(), "notify_queue").Result()
+			if wantQueued := tt.wantChanged && !tt.noEmail; (queued == 1) != wantQueued {
+				t.Errorf("queued notifications = %d, want one only after a change of an account with email", queued)
+			}
+		})
+	}
+}
+
+func TestReplacePassword(t *testing.T) {
+	store := NewUserStore(User{Username: "alice", Password: "hash-1", Source: SourceLocal})
+
+	if !replacePassword(store, "alice", "hash-1", "hash-2", 2) {
+		t.Fatal("replacePassword() refused the verified hash")
+	}
+	// a second request verified against the hash that was just replaced
+	if replacePassword(store, "alice", "hash-1", "hash-3", 2) {
+		t.Error("replacePassword() overwrote a concurrent change")
+	}
+
+	stored, _ := store.Get("alice")
+	if stored.Password != "hash-2" || len(stored.PasswordHistory) != 1 || stored.PasswordHistory[0] != "hash-1" {
+		t.Errorf("stored = %+v, want hash-2 with hash-1 in the history", stored)
+	}
+}
+
+func issue(t *testing.T, service *AuthService, subject TokenSubject) (string, string) {
+	t.Helper()
+	access, refresh, err := service.GenerateScopedToken(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return access, refresh
+}
+
+func refreshKey(t *testing.T, token string) string {
+	t.Helper()
+	claims := parseClaims(t, token)
+	return session.RefreshTokenKey(claims.UserID, claims.ID)
+}
+
+func tokenID(t *testing.T, token string) string {
+	t.Helper()
+	return parseClaims(t, token).ID
+}
+
+func parseClaims(t *testing.T, token string) *shared.Claims {
+	t.Helper()
+	claims := &shared.Claims{}
+	if _, err := jwt.ParseWithClaims(token, claims, config.JWTKeyFunc); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	TransportBearer = "bearer"
+	TransportCookie = "cookie"
+
+	// the access token is sent to the whole API, the refresh token only to the refresh route
+	accessCookiePath  = "/api/v1"
+	refreshCookiePath = "/api/v1/auth/refresh-token"
+
+	// binds an OIDC login to the browser that started it, only sent back to the callback
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/v1/auth/oidc"
+)
+
+func validTransport(transport string) bool {
+	return transport == "" || transport == TransportBearer || transport == TransportCookie
+}
+
+func setTokenCookie(c *fiber.Ctx, name, value, path string, ttl time.Duration, httpOnly bool) {
+	env := config.GetConfig().Env
+
+	c.Cookie(&fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   env.AUTH_COOKIE_DOMAIN,
+		Expires:  time.Now().Add(ttl),
+		Secure:   env.AUTH_COOKIE_SECURE,
+		HTTPOnly: httpOnly,
+		SameSite: env.AUTH_COOKIE_SAMESITE,
+	})
+}
+
+// setAuthCookies hands the tokens to the browser as HttpOnly cookies. The CSRF token cookie
+// stays readable so the frontend can echo it in the CSRF header after a reload.
+func setAuthCookies(c *fiber.Ctx, accessToken, refreshToken, csrfToken string, accessTTL, refreshTTL time.Duration) {
+	setTokenCookie(c, shared.AccessTokenCookie, accessToken, accessCookiePath, accessTTL, true)
+	if refreshToken != "" {
+		setTokenCookie(c, shared.RefreshTokenCookie, refreshToken, refreshCookiePath, refreshTTL, true)
+	}
+	setTokenCookie(c, shared.CSRFCookie, csrfToken, "/", refreshTTL, false)
+}
+
+func clearAuthCookies(c *fiber.Ctx) {
+	setTokenCookie(c, shared.AccessTokenCookie, "", accessCookiePath, -time.Hour, true)
+	setTokenCookie(c, shared.RefreshTokenCookie, "", refreshCookiePath, -time.Hour, true)
+	setTokenCookie(c, shared.CSRFCookie, "", "/", -time.Hour, false)
+}
+
+// setOIDCStateCookie remembers the state of a login in the browser that started it. The
+// provider redirects back cross-site, so the cookie is Lax whatever AUTH_COOKIE_SAMESITE says.
+func setOIDCStateCookie(c *fiber.Ctx, state string, ttl time.Duration) {
+	env := config.GetConfig().Env
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		Domain:   env.AUTH_COOKIE_DOMAIN,
+		Expires:  time.Now().Add(ttl),
+		Secure:   env.AUTH_COOKIE_SECURE,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
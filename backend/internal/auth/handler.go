@@ -1,25 +1,62 @@
 package auth
 
 import (
+	"go-backend/internal/apikey"
+	"go-backend/internal/avatar"
+	"go-backend/internal/config"
+	"go-backend/internal/fieldcrypt"
+	"go-backend/internal/ldapauth"
 	"go-backend/internal/middleware"
+	"go-backend/internal/notify"
+	"go-backend/internal/oidc"
+	"go-backend/internal/password"
+	"go-backend/internal/quota"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/minio/minio-go/v7"
 	"github.com/redis/go-redis/v9"
 )
 
-func RegisterRoutes(app *fiber.Router, redisClient *redis.Client) {
-	authService := NewAuthService(redisClient)
+func RegisterRoutes(app *fiber.Router, redisClient *redis.Client, minioClient *minio.Client, quotaService *quota.QuotaService, cipher fieldcrypt.Cipher, rp *oidc.RelyingParty, directory *ldapauth.Directory, policy password.Policy, hasher password.Hasher, outbox *notify.Outbox) (*AuthService, error) {
+	cfg := config.GetConfig()
+	passwords, err := NewPasswordVerifier(cfg.Env.AUTH_PASSWORD_BACKENDS, users, directory, hasher)
+	if err != nil {
+		return nil, err
+	}
+	avatarService := avatar.NewAvatarService(redisClient, minioClient, cfg.Env.MINIO_BUCKET, quotaService)
+	authService := NewAuthService(redisClient, avatarService, quotaService, cipher, passwords, policy, hasher, outbox)
 
 	auth := (*app).Group("/auth")
 
 	auth.Post("/login", authService.LoginHandler)
 	auth.Post("/refresh-token", authService.RefreshTokenHandler)
 
+	// OIDC login, only when providers are configured
+	if rp != nil {
+		oidcHandler := NewOIDCHandler(authService, rp)
+		auth.Get("/oidc/providers", oidcHandler.ProvidersHandler)
+		auth.Get("/oidc/:provider/login", oidcHandler.LoginHandler)
+		auth.Get("/oidc/:provider/callback", oidcHandler.CallbackHandler)
+		auth.Post("/oidc/token", oidcHandler.TokenHandler)
+	}
+
 	// Protected routes
 	protected := auth.Group("/", middleware.AuthMiddleware(redisClient))
 	protected.Post("/logout", authService.LogoutHandler)
+	protected.Post("/tokens/revoke", authService.RevokeTokenHandler)
 	protected.Post("/lock", authService.LockSessionHandler)
 	protected.Post("/unlock", authService.UnlockSessionHandler)
 	protected.Get("/check-session", authService.CheckSessionHandler) // Check session status
+	protected.Get("/events", authService.EventsHandler)              // Stream session events (SSE)
 	protected.Get("/profile", authService.ProfileHandler)
+	protected.Post("/profile/avatar", authService.UploadAvatarHandler)
+	protected.Post("/change-password", authService.ChangePasswordHandler)
+
+	// personal API keys, managed with the user's session only
+	apiKeyHandler := NewAPIKeyHandler(apikey.NewStore(redisClient))
+	protected.Get("/api-keys", apiKeyHandler.ListHandler)
+	protected.Post("/api-keys", apiKeyHandler.CreateHandler)
+	protected.Delete("/api-keys/:keyId", apiKeyHandler.RevokeHandler)
+
+	return authService, nil
 }
@@ -1,41 +1,97 @@
 package auth
 
+import (
+	"go-backend/internal/apikey"
+	"go-backend/internal/password"
+	"go-backend/internal/shared"
+)
+
 type User struct {
 	UserId   string `json:"userId"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Role     string `json:"role"`
+	// verified email, used to link OIDC identities
+	Email string `json:"email"`
+	// SourceLocal for accounts with a password here, SourceLDAP for accounts provisioned on
+	// their first directory login
+	Source string `json:"source"`
+	// hashes of previous passwords, newest first, for the password policy's history
+	PasswordHistory []string `json:"-"`
 }
 
+const (
+	SourceLocal = "local"
+	SourceLDAP  = "ldap"
+)
+
 // Mock database
-var users = map[string]User{
-	"user1": {
+var users = NewUserStore(
+	User{
 		UserId:   "1",
 		Username: "user1",
 		Password: "$2a$10$UbDFYt/ybeIfPnvIQp4rnu2PI4BckMLcPVN7SCVvD1prr2zUw9Sr.", // password
+		Role:     "admin",
+		Email:    "user1@example.com",
+		Source:   SourceLocal,
 	},
-	"user2": {
+	User{
 		UserId:   "2",
 		Username: "user2",
 		Password: "$2a$10$UbDFYt/ybeIfPnvIQp4rnu2PI4BckMLcPVN7SCVvD1prr2zUw9Sr.", // password
+		Role:     "user",
+		Email:    "user2@example.com",
+		Source:   SourceLocal,
 	},
-	"user3": {
+	User{
 		UserId:   "3",
 		Username: "user3",
 		Password: "$2a$10$UbDFYt/ybeIfPnvIQp4rnu2PI4BckMLcPVN7SCVvD1prr2zUw9Sr.", // password
+		Role:     "user",
+		Email:    "user3@example.com",
+		Source:   SourceLocal,
 	},
+)
+
+// API keys act with the current role of their owner, an account recreated under the same
+// name is another owner
+func init() {
+	apikey.ResolveUserRolesWith(func(userID, username string) (string, bool) {
+		user, ok := users.Get(username)
+		return user.Role, ok && user.UserId == userID
+	})
+}
+
+// LookupUser returns the local account of username
+func LookupUser(username string) (User, bool) {
+	return users.Get(username)
 }
 
+// session hash fields holding personal data, stored as field ciphertexts
+var EncryptedSessionFields = []string{"ip", "userAgent"}
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// bearer (default) returns the tokens, cookie sets them as HttpOnly cookies instead
+	Transport string `json:"transport"`
 }
 
+// TokenResponse carries the tokens for bearer clients, and only the CSRF token for the
+// cookie transport
 type TokenResponse struct {
-	AccessToken  string      `json:"accessToken"`
-	RefreshToken string      `json:"refreshToken"`
+	AccessToken  string      `json:"accessToken,omitempty"`
+	RefreshToken string      `json:"refreshToken,omitempty"`
+	CSRFToken    string      `json:"csrfToken,omitempty"`
 	User         interface{} `json:"user,omitempty"`
 }
 
+// OIDCTokenRequest trades the one-time code from the OIDC callback redirect for tokens
+type OIDCTokenRequest struct {
+	Code      string `json:"code"`
+	Transport string `json:"transport"`
+}
+
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
@@ -43,6 +99,40 @@ type LockSessionRequest struct {
 	Timestamp int64 `json:"timestamp"`
 }
 
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// PasswordPolicyErrorResponse lists every rule the new password broke
+type PasswordPolicyErrorResponse struct {
+	shared.ErrorResponse
+	Violations []password.Violation `json:"violations"`
+}
+
+// RevokeTokenRequest names an access or refresh token of the user, empty means the token the
+// request is authorized with
+type RevokeTokenRequest struct {
+	Token string `json:"token"`
+}
+
 type UnlockRequest struct {
 	Password string `json:"password"`
 }
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+// CreateAPIKeyResponse is the only time the full key is shown
+type CreateAPIKeyResponse struct {
+	Key    string     `json:"key"`
+	APIKey apikey.Key `json:"apiKey"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/oidc"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// the frontend has this long to trade the callback code for tokens
+const oidcLoginCodeTTL = time.Minute
+
+var errAccountNotLinked = errors.New("no local account for this identity")
+
+// OIDCHandler signs local users in through external OpenID providers
+type OIDCHandler struct {
+	authService *AuthService
+	rp          *oidc.RelyingParty
+}
+
+func NewOIDCHandler(authService *AuthService, rp *oidc.RelyingParty) *OIDCHandler {
+	return &OIDCHandler{authService: authService, rp: rp}
+}
+
+func (h *OIDCHandler) ProvidersHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"providers": h.rp.Providers(),
+	})
+}
+
+// LoginHandler redirects the browser to the provider's authorization endpoint. The state is
+// also set as an HttpOnly cookie, so only this browser can complete the login.
+func (h *OIDCHandler) LoginHandler(c *fiber.Ctx) error {
+	authURL, state, err := h.rp.AuthURL(context.Background(), c.Params("provider"))
+	if errors.Is(err, oidc.ErrUnknownProvider) {
+		return c.Status(fiber.StatusNotFound).JSON(shared.ErrorResponse{
+			ErrorCode: "OIDC_PROVIDER_NOT_FOUND",
+			Message:   "Login provider not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "OIDC_LOGIN_FAILED",
+			Message:   "Failed to start login",
+		})
+	}
+
+	setOIDCStateCookie(c, state, oidc.StateTTL)
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// CallbackHandler completes the provider login and sends the browser back to the frontend
+// with a one-time code, tokens never appear in a URL. A callback whose state does not match
+// the browser's state cookie was not started by this browser and is refused (login CSRF).
+func (h *OIDCHandler) CallbackHandler(c *fiber.Ctx) error {
+	browserState := c.Cookies(oidcStateCookie)
+	setOIDCStateCookie(c, "", -time.Hour)
+
+	if providerError := c.Query("error"); providerError != "" {
+		return h.redirectToFrontend(c, url.Values{"error": {providerError}})
+	}
+
+	state := c.Query("state")
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(browserState), []byte(state)) != 1 {
+		log.Printf("OIDC login with %s refused: state does not match the browser", c.Params("provider"))
+		return h.redirectToFrontend(c, url.Values{"error": {"login_failed"}})
+	}
+
+	identity, err := h.rp.Exchange(context.Background(), c.Params("provider"), state, c.Query("code"))
+	if err != nil {
+		log.Printf("OIDC login with %s failed: %v", c.Params("provider"), err)
+		return h.redirectToFrontend(c, url.Values{"error": {"login_failed"}})
+	}
+
+	user, err := h.linkedUser(identity)
+	if errors.Is(err, errAccountNotLinked) {
+		return h.redirectToFrontend(c, url.Values{"error": {"account_not_linked"}})
+	}
+	if err != nil {
+		return h.redirectToFrontend(c, url.Values{"error": {"login_failed"}})
+	}
+
+	code := uuid.New().String()
+	err = h.authService.redisClient.Set(context.Background(), oidcLoginCodeKey(code), user.Username, oidcLoginCodeTTL).Err()
+	if err != nil {
+		return h.redirectToFrontend(c, url.Values{"error": {"login_failed"}})
+	}
+
+	return h.redirectToFrontend(c, url.Values{"code": {code}})
+}
+
+// TokenHandler trades the callback code for our normal TokenResponse and session
+func (h *OIDCHandler) TokenHandler(c *fiber.Ctx) error {
+	var req OIDCTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_REQUEST",
+			Message:   "Invalid request body",
+		})
+	}
+	if !validTransport(req.Transport) {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_TRANSPORT",
+			Message:   "Transport must be bearer or cookie",
+		})
+	}
+
+	username, err := h.authService.redisClient.GetDel(context.Background(), oidcLoginCodeKey(req.Code)).Result()
+	user, exists := users.Get(username)
+	if err != nil || !exists {
+		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_LOGIN_CODE",
+			Message:   "Login code is invalid or expired",
+		})
+	}
+
+	return h.authService.startSession(c, user, req.Transport)
+}
+
+// linkedUser finds the local account of an identity: by an earlier link of the provider
+// subject, otherwise by verified email, which then links the subject for later logins. A link
+// holds the account's UserId too, a username handed to another account does not carry it over.
+func (h *OIDCHandler) linkedUser(identity oidc.Identity) (User, error) {
+	ctx := context.Background()
+	linkKey := oidcLinkKey(identity)
+
+	link, err := h.authService.redisClient.HGetAll(ctx, linkKey).Result()
+	if err != nil {
+		return User{}, err
+	}
+	if user, ok := users.Get(link["username"]); ok && user.UserId == link["userId"] {
+		return user, nil
+	}
+
+	if !identity.EmailVerified || identity.Email == "" {
+		return User{}, errAccountNotLinked
+	}
+	user, ok := users.FindByEmail(identity.Email)
+	if !ok {
+		return User{}, errAccountNotLinked
+	}
+	err = h.authService.redisClient.HSet(ctx, linkKey, map[string]interface{}{
+		"userId":   user.UserId,
+		"username": user.Username,
+	}).Err()
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (h *OIDCHandler) redirectToFrontend(c *fiber.Ctx, query url.Values) error {
+	return c.Redirect(config.GetConfig().Env.OIDC_FRONTEND_URL+"?"+query.Encode(), fiber.StatusFound)
+}
+
+// links made while they held only the username were under oidc_link and are not followed,
+// their users link again by verified email
+func oidcLinkKey(identity oidc.Identity) string {
+	return fmt.Sprintf("oidc_identity:%s:%s", identity.Provider, identity.Subject)
+}
+
+func oidcLoginCodeKey(code string) string {
+	return fmt.Sprintf("oidc_login:%s", code)
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"go-backend/internal/oidc"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newTestProvider serves just enough discovery for an authorization redirect, token
+// requests fail
+func newTestProvider(t *testing.T) *oidc.Provider {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.ProviderConfig{Name: "mock", Issuer: server.URL, ClientID: "fiber-app"}, "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestOIDCHandler_StateCookie(t *testing.T) {
+	service, mr := newTestService(t)
+	handler := NewOIDCHandler(service, oidc.NewRelyingParty(oidc.NewRedisStateStore(service.redisClient), newTestProvider(t)))
+
+	app := fiber.New()
+	app.Get("/api/v1/auth/oidc/:provider/login", handler.LoginHandler)
+	app.Get("/api/v1/auth/oidc/:provider/callback", handler.CallbackHandler)
+
+	login := func(t *testing.T) (string, *http.Cookie) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/auth/oidc/mock/login", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		location, _ := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == oidcStateCookie {
+				return location.Query().Get("state"), cookie
+			}
+		}
+		t.Fatal("login set no state cookie")
+		return "", nil
+	}
+
+	state, cookie := login(t)
+	if cookie.Value != state || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != oidcStateCookiePath {
+		t.Fatalf("state cookie = %+v, want the state %q, HttpOnly, Lax on %s", cookie, state, oidcStateCookiePath)
+	}
+
+	tests := []struct {
+		name         string
+		cookie       string
+		wantConsumed bool
+	}{
+		{name: "Without the state cookie"},
+		{name: "With the state cookie of another login", cookie: "attacker-state"},
+		{name: "With the matching state cookie", cookie: state, wantConsumed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/api/v1/auth/oidc/mock/callback?"+url.Values{"state": {state}, "code": {"code-1"}}.Encode(), nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			location, _ := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+			if resp.StatusCode != fiber.StatusFound || location.Query().Get("error") != "login_failed" {
+				t.Errorf("callback = %d %s, want a redirect with login_failed", resp.StatusCode, location)
+			}
+			if consumed := !mr.Exists("oidc_state:" + state); consumed != tt.wantConsumed {
+				t.Errorf("state consumed = %v, want %v", consumed, tt.wantConsumed)
+			}
+		})
+	}
+}
+
+func TestOIDCHandler_LinkedUser(t *testing.T) {
+	service, mr := newTestService(t)
+	handler := NewOIDCHandler(service, nil)
+
+	previous := users
+	t.Cleanup(func() { users = previous })
+
+	identity := oidc.Identity{Provider: "mock", Subject: "sub-1", Email: "dave@example.com", EmailVerified: true}
+	unverified := oidc.Identity{Provider: "mock", Subject: "sub-1", Email: "dave@example.com"}
+
+	tests := []struct {
+		name     string
+		store    *UserStore
+		link     map[string]string
+		identity oidc.Identity
+		wantUser string
+		wantErr  error
+	}{
+		{
+			name:     "Linked by verified email",
+			store:    NewUserStore(User{UserId: "d1", Username: "dave", Email: "dave@example.com"}),
+			identity: identity, wantUser: "d1",
+		},
+		{
+			name:     "Unverified email does not link",
+			store:    NewUserStore(User{UserId: "d1", Username: "dave", Email: "dave@example.com"}),
+			identity: unverified, wantErr: errAccountNotLinked,
+		},
+		{
+			name:     "Earlier link",
+			store:    NewUserStore(User{UserId: "d1", Username: "dave"}),
+			link:     map[string]string{"userId": "d1", "username": "dave"},
+			identity: unverified, wantUser: "d1",
+		},
+		{
+			name:     "Username handed to another account",
+			store:    NewUserStore(User{UserId: "d2", Username: "dave"}),
+			link:     map[string]string{"userId": "d1", "username": "dave"},
+			identity: unverified, wantErr: errAccountNotLinked,
+		},
+		{
+			name:     "Stale link is replaced by verified email",
+			store:    NewUserStore(User{UserId: "d2", Username: "dave"}, User{UserId: "d1", Username: "dave.old", Email: "dave@example.com"}),
+			link:     map[string]string{"userId": "d1", "username": "dave"},
+			identity: identity, wantUser: "d1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr.FlushAll()
+			users = tt.store
+			for field, value := range tt.link {
+				mr.HSet(oidcLinkKey(tt.identity), field, value)
+			}
+
+			user, err := handler.linkedUser(tt.identity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("linkedUser() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if user.UserId != tt.wantUser {
+				t.Errorf("linkedUser() = %+v, want UserId %s", user, tt.wantUser)
+			}
+			if got := mr.HGet(oidcLinkKey(tt.identity), "userId"); got != tt.wantUser {
+				t.Errorf("link userId = %q, want %q", got, tt.wantUser)
+			}
+		})
+	}
+}
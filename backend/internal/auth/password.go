@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"go-backend/internal/ldapauth"
+	"go-backend/internal/password"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PasswordBackendLocal = "local"
+	PasswordBackendLDAP  = "ldap"
+)
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// PasswordVerifier checks a username and password and returns the local account they sign in to
+type PasswordVerifier interface {
+	VerifyPassword(ctx context.Context, username, password string) (User, error)
+}
+
+// NewPasswordVerifier tries the AUTH_PASSWORD_BACKENDS in order, directory is required for ldap
+func NewPasswordVerifier(backends []string, store *UserStore, directory *ldapauth.Directory, hasher password.Hasher) (PasswordVerifier, error) {
+	var chain passwordChain
+	for _, backend := range backends {
+		switch backend {
+		case PasswordBackendLocal:
+			chain = append(chain, localPasswords{store: store, hasher: hasher})
+		case PasswordBackendLDAP:
+			if directory == nil {
+				return nil, errors.New("password backend ldap requires LDAP_URL")
+			}
+			chain = append(chain, directoryPasswords{directory: directory, store: store})
+		default:
+			return nil, fmt.Errorf("unknown password backend %q", backend)
+		}
+	}
+	return chain, nil
+}
+
+// passwordChain asks each backend in turn. A backend that is down does not stop the next one,
+// its error is only returned when no backend accepted the password.
+type passwordChain []PasswordVerifier
+
+func (c passwordChain) VerifyPassword(ctx context.Context, username, password string) (User, error) {
+	var backendErr error
+	for _, verifier := range c {
+		user, err := verifier.VerifyPassword(ctx, username, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			backendErr = err
+		}
+	}
+
+	if backendErr != nil {
+		return User{}, backendErr
+	}
+	return User{}, ErrInvalidCredentials
+}
+
+// localPasswords checks the password hashes of local accounts and upgrades hashes weaker
+// than the hasher's target while the plaintext is at hand
+type localPasswords struct {
+	store  *UserStore
+	hasher password.Hasher
+}
+
+func (p localPasswords) VerifyPassword(ctx context.Context, username, plaintext string) (User, error) {
+	user, ok := p.store.Get(username)
+	if !ok || user.Source != SourceLocal {
+		return User{}, ErrInvalidCredentials
+	}
+	if ok, err := password.Verify(user.Password, plaintext); !ok {
+		if err != nil {
+			log.Printf("Password hash of %s cannot be verified: %v", username, err)
+		}
+		return User{}, ErrInvalidCredentials
+	}
+
+	if p.hasher.NeedsRehash(user.Password) {
+		user = p.rehash(user, plaintext)
+	}
+	return user, nil
+}
+
+// rehash stores a new hash unless the password changed meanwhile. A failure only postpones
+// the upgrade to the next login.
+func (p localPasswords) rehash(user User, plaintext string) User {
+	hash, err := p.hasher.Hash(plaintext)
+	if err != nil {
+		log.Printf("Rehashing the password of %s failed: %v", user.Username, err)
+		return user
+	}
+
+	updated, _ := p.store.Update(user.Username, func(current User, exists bool) (User, bool) {
+		if !exists || current.Password != user.Password {
+			return current, false
+		}
+		current.Password = hash
+		return current, true
+	})
+	return updated
+}
+
+// directoryPasswords binds against LDAP and provisions the local account just in time
+type directoryPasswords struct {
+	directory *ldapauth.Directory
+	store     *UserStore
+}
+
+func (p directoryPasswords) VerifyPassword(ctx context.Context, username, password string) (User, error) {
+	identity, err := p.directory.Authenticate(ctx, username, password)
+	if errors.Is(err, ldapauth.ErrNoRole) {
+		log.Printf("LDAP user %s is in no group mapped to a role", username)
+		return User{}, ErrInvalidCredentials
+	}
+	if errors.Is(err, ldapauth.ErrInvalidCredentials) {
+		return User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	user, ok := provision(p.store, identity)
+	if !ok {
+		log.Printf("LDAP user %s matches a local account, not signing in", identity.Username)
+		return User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// directoryNamespace derives user ids from directory ids, so a directory user has the same id
+// on every replica and after restarts
+var directoryNamespace = uuid.MustParse("3f0e6f0a-7c1d-5b8e-9a4f-2d6c8b1e0a57")
+
+// provision creates the account of a directory user, or updates its role and email from the
+// directory. A local account of the same name is never taken over.
+func provision(store *UserStore, identity ldapauth.Identity) (User, bool) {
+	return store.Update(identity.Username, func(user User, exists bool) (User, bool) {
+		if exists && user.Source != SourceLDAP {
+			return User{}, false
+		}
+		if !exists {
+			user = User{
+				Username: identity.Username,
+				Source:   SourceLDAP,
+			}
+		}
+
+		// a username handed to another directory entry gets that entry's id
+		user.UserId = uuid.NewSHA1(directoryNamespace, []byte(identity.ID)).String()
+		user.Role = identity.Role
+		user.Email = identity.Email
+		return user, true
+	})
+}
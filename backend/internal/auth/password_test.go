@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go-backend/internal/ldapauth"
+	"go-backend/internal/password"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeVerifier struct {
+	user User
+	err  error
+}
+
+func (f fakeVerifier) VerifyPassword(ctx context.Context, username, password string) (User, error) {
+	return f.user, f.err
+}
+
+func TestPasswordChain(t *testing.T) {
+	alice := User{UserId: "1", Username: "alice"}
+	errDown := errors.New("ldap dial: connection refused")
+
+	tests := []struct {
+		name     string
+		chain    passwordChain
+		wantUser User
+		wantErr  error
+	}{
+		{
+			name:     "First backend accepts",
+			chain:    passwordChain{fakeVerifier{user: alice}, fakeVerifier{err: errDown}},
+			wantUser: alice,
+		},
+		{
+			name:     "Falls through rejected credentials",
+			chain:    passwordChain{fakeVerifier{err: ErrInvalidCredentials}, fakeVerifier{user: alice}},
+			wantUser: alice,
+		},
+		{
+			name:     "Backend down does not stop the next one",
+			chain:    passwordChain{fakeVerifier{err: errDown}, fakeVerifier{user: alice}},
+			wantUser: alice,
+		},
+		{
+			name:    "Outage is reported when nobody accepted",
+			chain:   passwordChain{fakeVerifier{err: errDown}, fakeVerifier{err: ErrInvalidCredentials}},
+			wantErr: errDown,
+		},
+		{
+			name:    "All reject",
+			chain:   passwordChain{fakeVerifier{err: ErrInvalidCredentials}},
+			wantErr: ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tt.chain.VerifyPassword(context.Background(), "alice", "pw")
+			if !errors.Is(err, tt.wantErr) || !reflect.DeepEqual(user, tt.wantUser) {
+				t.Errorf("VerifyPassword() = %v, %v, want %v, %v", user, err, tt.wantUser, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProvision(t *testing.T) {
+	store := NewUserStore(
+		User{UserId: "1", Username: "local", Role: "user", Source: SourceLocal},
+		User{UserId: "2", Username: "dave", Role: "user", Email: "old@example.com", Source: SourceLDAP},
+	)
+
+	tests := []struct {
+		name     string
+		identity ldapauth.Identity
+		wantOK   bool
+	}{
+		{
+			name:     "New directory user is created",
+			identity: ldapauth.Identity{ID: "entryUUID:e1", Username: "erin", Email: "erin@example.com", Role: "user"},
+			wantOK:   true,
+		},
+		{
+			name:     "Provisioned user gets the directory's id, role and email",
+			identity: ldapauth.Identity{ID: "entryUUID:d1", Username: "dave", Email: "dave@example.com", Role: "admin"},
+			wantOK:   true,
+		},
+		{
+			name:     "Local account is not taken over",
+			identity: ldapauth.Identity{ID: "entryUUID:l1", Username: "local", Role: "admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, ok := provision(store, tt.identity)
+			if ok != tt.wantOK {
+				t.Fatalf("provision() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				if stored, _ := store.Get(tt.identity.Username); stored.Source != SourceLocal || stored.Role != "user" || stored.UserId != "1" {
+					t.Errorf("local account changed to %+v", stored)
+				}
+				return
+			}
+
+			stored, _ := store.Get(tt.identity.Username)
+			if !reflect.DeepEqual(stored, user) || user.Source != SourceLDAP || user.Role != tt.identity.Role || user.Email != tt.identity.Email {
+				t.Errorf("provision() = %+v, stored %+v, want role %q and email %q", user, stored, tt.identity.Role, tt.identity.Email)
+			}
+
+			// another replica, or this one after a restart, provisions the same id
+			again, _ := provision(NewUserStore(), tt.identity)
+			if user.UserId == "" || again.UserId != user.UserId {
+				t.Errorf("provision() UserId = %q, re-provisioned %q, want the same stable id", user.UserId, again.UserId)
+			}
+		})
+	}
+
+	renamed, _ := provision(NewUserStore(), ldapauth.Identity{ID: "entryUUID:e1", Username: "erin.new", Role: "user"})
+	other, _ := provision(NewUserStore(), ldapauth.Identity{ID: "entryUUID:x9", Username: "erin", Role: "user"})
+	erin, _ := store.Get("erin")
+	if renamed.UserId != erin.UserId || other.UserId == erin.UserId {
+		t.Errorf("user ids follow the username instead of the directory entry: renamed %q, other entry %q, erin %q", renamed.UserId, other.UserId, erin.UserId)
+	}
+}
+
+func TestLocalPasswordsRehash(t *testing.T) {
+	weak, err := password.Hasher{Algorithm: password.AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher := password.Hasher{
+		Algorithm: password.AlgorithmArgon2id,
+		Argon2:    password.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+	}
+
+	tests := []struct {
+		name       string
+		password   string
+		wantErr    error
+		wantRehash bool
+	}{
+		{name: "Wrong password keeps the hash", password: "nope", wantErr: ErrInvalidCredentials},
+		{name: "Login upgrades the hash", password: "secret", wantRehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewUserStore(User{UserId: "1", Username: "alice", Password: weak, Source: SourceLocal})
+			verifier := localPasswords{store: store, hasher: hasher}
+
+			user, err := verifier.VerifyPassword(context.Background(), "alice", tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyPassword() error = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, _ := store.Get("alice")
+			if rehashed := stored.Password != weak; rehashed != tt.wantRehash {
+				t.Fatalf("stored hash rehashed = %v, want %v", rehashed, tt.wantRehash)
+			}
+			if tt.wantRehash {
+				if ok, _ := password.Verify(stored.Password, tt.password); !ok || hasher.NeedsRehash(stored.Password) || user.Password != stored.Password {
+					t.Errorf("stored hash %q is not an upgraded hash of the password", stored.Password)
+				}
+			}
+		})
+	}
+}
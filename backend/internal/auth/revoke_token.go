@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/session"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RevokeTokenHandler revokes one access or refresh token of the user, leaving the session and
+// the user's other tokens alone. Without a token in the body the presented token is revoked.
+func (s *AuthService) RevokeTokenHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	var req RevokeTokenRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+				ErrorCode: "INVALID_REQUEST",
+				Message:   "Invalid request body",
+			})
+		}
+	}
+
+	ctx := context.Background()
+	if req.Token == "" {
+		tokenId := c.Locals("tokenId").(string)
+		expiresAt, ok := c.Locals("tokenExpiresAt").(time.Time)
+		if tokenId == "" || !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+				ErrorCode: "INVALID_TOKEN",
+				Message:   "Token cannot be revoked individually",
+			})
+		}
+		if err := session.DenyToken(ctx, s.redisClient, tokenId, expiresAt); err != nil {
+			return revokeFailed(c)
+		}
+		return c.JSON(fiber.Map{
+			"message": "Token revoked",
+		})
+	}
+
+	// expired tokens need no revoking, but they must still be the user's own
+	claims := &shared.Claims{}
+	_, err := jwt.ParseWithClaims(req.Token, claims, config.JWTKeyFunc, jwt.WithoutClaimsValidation())
+	if err != nil || claims.ID == "" || claims.UserID != userId {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_TOKEN",
+			Message:   "Token is invalid or not yours",
+		})
+	}
+
+	if claims.TokenType == shared.TokenTypeRefresh {
+		err = s.redisClient.Del(ctx, session.RefreshTokenKey(claims.UserID, claims.ID)).Err()
+	} else if claims.ExpiresAt != nil {
+		err = session.DenyToken(ctx, s.redisClient, claims.ID, claims.ExpiresAt.Time)
+	}
+	if err != nil {
+		return revokeFailed(c)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Token revoked",
+	})
+}
+
+func revokeFailed(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusServiceUnavailable).JSON(shared.ErrorResponse{
+		ErrorCode: "TOKEN_REVOCATION_FAILED",
+		Message:   "Failed to revoke the token",
+	})
+}
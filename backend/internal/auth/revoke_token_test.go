@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"go-backend/internal/session"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRevokeTokenHandler(t *testing.T) {
+	service, mr := newTestService(t)
+
+	presented, _ := issue(t, service, TokenSubject{UserID: "7", Username: "alice", Role: "user", SessionID: "s1"})
+	otherAccess, refresh := issue(t, service, TokenSubject{UserID: "7", Username: "alice", Role: "user", SessionID: "s1"})
+	strangerAccess, _ := issue(t, service, TokenSubject{UserID: "8", Username: "bob", Role: "user", SessionID: "s9"})
+	mr.HSet(session.Key("7"), "sid", "s1")
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantDenied string
+		wantGone   string
+	}{
+		{name: "Presented token", wantStatus: fiber.StatusOK, wantDenied: presented},
+		{name: "Another access token of the user", token: otherAccess, wantStatus: fiber.StatusOK, wantDenied: otherAccess},
+		{name: "Refresh token", token: refresh, wantStatus: fiber.StatusOK, wantGone: refresh},
+		{name: "Token of another user", token: strangerAccess, wantStatus: fiber.StatusBadRequest},
+		{name: "Not a token", token: "garbage", wantStatus: fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := parseClaims(t, presented)
+			app := fiber.New()
+			app.Post("/tokens/revoke", func(c *fiber.Ctx) error {
+				c.Locals("userId", "7")
+				c.Locals("tokenId", claims.ID)
+				c.Locals("tokenExpiresAt", claims.ExpiresAt.Time)
+				return c.Next()
+			}, service.RevokeTokenHandler)
+
+			var body []byte
+			if tt.token != "" {
+				body, _ = json.Marshal(RevokeTokenRequest{Token: tt.token})
+			}
+			req := httptest.NewRequest(fiber.MethodPost, "/tokens/revoke", bytes.NewReader(body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				var errResp shared.ErrorResponse
+				json.NewDecoder(resp.Body).Decode(&errResp)
+				t.Fatalf("status = %d %+v, want %d", resp.StatusCode, errResp, tt.wantStatus)
+			}
+
+			if tt.wantDenied != "" {
+				if denied, _ := session.IsTokenDenied(context.Background(), service.redisClient, tokenID(t, tt.wantDenied)); !denied {
+					t.Error("access token not denied")
+				}
+			}
+			if tt.wantGone != "" && mr.Exists(refreshKey(t, tt.wantGone)) {
+				t.Error("refresh token still stored")
+			}
+			if !mr.Exists(session.Key("7")) {
+				t.Error("revoking one token ended the session")
+			}
+			if denied, _ := session.IsTokenDenied(context.Background(), service.redisClient, tokenID(t, strangerAccess)); denied {
+				t.Error("token of another user was denied")
+			}
+		})
+	}
+}
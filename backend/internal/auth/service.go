@@ -1,11 +1,22 @@
 package auth
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"strconv"
 
+	"go-backend/internal/avatar"
 	"go-backend/internal/config"
+	"go-backend/internal/fieldcrypt"
+	"go-backend/internal/middleware"
+	"go-backend/internal/notify"
+	"go-backend/internal/password"
+	"go-backend/internal/quota"
+	"go-backend/internal/session"
 	"go-backend/internal/shared"
 	"time"
 
@@ -13,62 +24,199 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService struct {
-	redisClient *redis.Client
+	redisClient   *redis.Client
+	avatarService *avatar.AvatarService
+	quotaService  *quota.QuotaService
+	cipher        fieldcrypt.Cipher
+	passwords     PasswordVerifier
+	policy        password.Policy
+	hasher        password.Hasher
+	outbox        *notify.Outbox
 }
 
-func NewAuthService(redisClient *redis.Client) *AuthService {
+func NewAuthService(redisClient *redis.Client, avatarService *avatar.AvatarService, quotaService *quota.QuotaService, cipher fieldcrypt.Cipher, passwords PasswordVerifier, policy password.Policy, hasher password.Hasher, outbox *notify.Outbox) *AuthService {
 	return &AuthService{
-		redisClient: redisClient,
+		redisClient:   redisClient,
+		avatarService: avatarService,
+		quotaService:  quotaService,
+		cipher:        cipher,
+		passwords:     passwords,
+		policy:        policy,
+		hasher:        hasher,
+		outbox:        outbox,
 	}
 }
 
-func (s *AuthService) GenerateToken(userID, username string) (string, string, error) {
-	cfg := config.GetConfig()
-	JWT_SECRET := []byte(cfg.Secrets.JWT_SECRET)
-	accessClaims := &shared.Claims{
-		UserID:   userID,
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// checkNewPassword applies the password policy to a new password of user, the current
+// password counts towards the history
+func (s *AuthService) checkNewPassword(user User, newPassword string) error {
+	return s.policy.Check(newPassword, password.Account{
+		Username: user.Username,
+		Email:    user.Email,
+		History:  append([]string{user.Password}, user.PasswordHistory...),
+	})
+}
+
+// redeemRefreshTokenScript deletes a stored refresh token if it is still the one presented,
+// so of two concurrent requests only one redeems it
+var redeemRefreshTokenScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+var (
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenRevoked = errors.New("refresh token not found or has been revoked")
+	ErrSessionExpired      = errors.New("session has expired")
+)
+
+// TokenSubject is who a token is issued to. ClientID and Scope are only set for OAuth
+// clients, SessionID binds the token to one login of the user.
+type TokenSubject struct {
+	UserID    string
+	Username  string
+	Role      string
+	SessionID string
+	ClientID  string
+	Scope     string
+}
+
+func (s *AuthService) GenerateToken(userID, username, role, sessionID string) (string, string, error) {
+	return s.GenerateScopedToken(TokenSubject{UserID: userID, Username: username, Role: role, SessionID: sessionID})
+}
+
+// GenerateScopedToken issues an access and a refresh token, for an OAuth client limited to its scope
+func (s *AuthService) GenerateScopedToken(subject TokenSubject) (string, string, error) {
+	accessTokenString, err := s.SignAccessToken(subject)
+	if err != nil {
+		return "", "", err
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(JWT_SECRET)
+	refreshTokenString, err := s.SignRefreshToken(subject)
 	if err != nil {
 		return "", "", err
 	}
 
+	return accessTokenString, refreshTokenString, nil
+}
+
+// SignRefreshToken issues a refresh token and stores it, only stored refresh tokens are redeemed
+func (s *AuthService) SignRefreshToken(subject TokenSubject) (string, error) {
+	policy := session.PolicyFor(subject.Role)
+
 	refreshTokenID := uuid.New().String()
 	refreshClaims := &shared.Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    subject.UserID,
+		Username:  subject.Username,
+		Role:      subject.Role,
+		SessionID: subject.SessionID,
+		ClientID:  subject.ClientID,
+		Scope:     subject.Scope,
+		TokenType: shared.TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        refreshTokenID,
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(policy.RefreshTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(JWT_SECRET)
+	refreshTokenString, err := config.SignJWT(refreshClaims)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 
 	// store refresh token in Redis
-	key := fmt.Sprintf("refresh_token:%s:%s", userID, refreshTokenID)
-	err = s.redisClient.Set(context.Background(), key, refreshTokenString, 7*24*time.Hour).Err()
+	key := session.RefreshTokenKey(subject.UserID, refreshTokenID)
+	err = s.redisClient.Set(context.Background(), key, refreshTokenString, policy.RefreshTTL).Err()
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 
-	return accessTokenString, refreshTokenString, nil
+	return refreshTokenString, nil
+}
+
+// SignAccessToken issues a short lived access token. Tokens without a user (OAuth client
+// credentials) have the client as subject.
+func (s *AuthService) SignAccessToken(subject TokenSubject) (string, error) {
+	sub := subject.UserID
+	if sub == "" {
+		sub = subject.ClientID
+	}
+
+	jti := uuid.New().String()
+	expiresAt := time.Now().Add(session.PolicyFor(subject.Role).AccessTTL)
+
+	// the jti lets a single token be revoked through the denylist
+	tokenString, err := config.SignJWT(&shared.Claims{
+		UserID:    subject.UserID,
+		Username:  subject.Username,
+		Role:      subject.Role,
+		SessionID: subject.SessionID,
+		ClientID:  subject.ClientID,
+		Scope:     subject.Scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   sub,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// a client's token stays valid as long as the user's session, it is tracked so a password
+	// change can deny it
+	if subject.ClientID != "" && subject.UserID != "" {
+		if err := session.TrackClientToken(context.Background(), s.redisClient, subject.UserID, jti, expiresAt); err != nil {
+			return "", err
+		}
+	}
+	return tokenString, nil
+}
+
+// RedeemRefreshToken removes a refresh token verified by VerifyRefreshToken, so it cannot be
+// used again once it was rotated. It returns ErrRefreshTokenRevoked when another request
+// redeemed or revoked it first.
+func (s *AuthService) RedeemRefreshToken(ctx context.Context, claims *shared.Claims, refreshToken string) error {
+	key := session.RefreshTokenKey(claims.UserID, claims.ID)
+	redeemed, err := redeemRefreshTokenScript.Run(ctx, s.redisClient, []string{key}, refreshToken).Int()
+	if err != nil {
+		return err
+	}
+	if redeemed == 0 {
+		return ErrRefreshTokenRevoked
+	}
+	return nil
+}
+
+// VerifyRefreshToken checks the signature of a refresh token, that it has not been revoked
+// and that the login it belongs to is still the user's live session
+func (s *AuthService) VerifyRefreshToken(ctx context.Context, refreshToken string) (*shared.Claims, error) {
+	claims := &shared.Claims{}
+	token, err := jwt.ParseWithClaims(refreshToken, claims, config.JWTKeyFunc)
+	if err != nil || !token.Valid || claims.ID == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	key := session.RefreshTokenKey(claims.UserID, claims.ID)
+	storedToken, err := s.redisClient.Get(ctx, key).Result()
+	if err != nil || storedToken != refreshToken {
+		return nil, ErrRefreshTokenRevoked
+	}
+
+	sessionID, err := s.redisClient.HGet(ctx, session.Key(claims.UserID), "sid").Result()
+	if err != nil || !session.SameSession(map[string]string{"sid": sessionID}, claims.SessionID) {
+		return nil, ErrSessionExpired
+	}
+
+	return claims, nil
 }
 
 func (s *AuthService) LoginHandler(c *fiber.Ctx) error {
@@ -87,27 +235,39 @@ func (s *AuthService) LoginHandler(c *fiber.Ctx) error {
 			Message:   "Username and password are required",
 		})
 	}
+	if !validTransport(req.Transport) {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_TRANSPORT",
+			Message:   "Transport must be bearer or cookie",
+		})
+	}
 
-	// check user
-	user, exists := users[req.Username]
-	if !exists {
+	// verify password against the configured backends
+	user, err := s.passwords.VerifyPassword(context.Background(), req.Username, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
 		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
 			ErrorCode: "INVALID_CREDENTIALS",
 			Message:   "Invalid username or password",
 		})
 	}
-
-	// verify password
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
-			ErrorCode: "INVALID_CREDENTIALS",
-			Message:   "Invalid username or password",
+		log.Printf("Password verification for %s failed: %v", req.Username, err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(shared.ErrorResponse{
+			ErrorCode: "AUTH_BACKEND_UNAVAILABLE",
+			Message:   "Sign-in is temporarily unavailable",
 		})
 	}
 
+	return s.startSession(c, user, req.Transport)
+}
+
+// startSession issues the tokens and stores the session of an authenticated user, over the
+// requested transport
+func (s *AuthService) startSession(c *fiber.Ctx, user User, transport string) error {
 	// generate tokens (access and refresh)
-	accessToken, refreshToken, err := s.GenerateToken(user.UserId, user.Username)
+	// every login is a new session, tokens of an earlier one stop working
+	sessionID := uuid.New().String()
+	accessToken, refreshToken, err := s.GenerateToken(user.UserId, user.Username, user.Role, sessionID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
 			ErrorCode: "TOKEN_GENERATION_FAILED",
@@ -116,12 +276,38 @@ func (s *AuthService) LoginHandler(c *fiber.Ctx) error {
 	}
 
 	// store session in Redis
-	sessionKey := fmt.Sprintf("session:%s", user.UserId)
+	now := time.Now()
+	sessionKey := session.Key(user.UserId)
 	sessionData := map[string]interface{}{
-		"username":  user.Username,
-		"loginTime": time.Now().Unix(),
-		"ip":        c.IP(),
-		"userAgent": c.Get("User-Agent"),
+		"sid":          sessionID,
+		"username":     user.Username,
+		"loginTime":    now.Unix(),
+		"lastActivity": now.Unix(),
+		"locked":       false,
+		"lockedAt":     0,
+		"ip":           c.IP(),
+		"userAgent":    c.Get("User-Agent"),
+	}
+
+	// cookie sessions get a synchronizer token required on every state-changing request
+	var csrfToken string
+	if transport == TransportCookie {
+		csrfToken, err = newCSRFToken()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+				ErrorCode: "TOKEN_GENERATION_FAILED",
+				Message:   "Failed to generate tokens",
+			})
+		}
+	}
+	sessionData["csrfToken"] = csrfToken
+
+	err = fieldcrypt.EncryptFields(context.Background(), s.cipher, sessionData, EncryptedSessionFields...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "SESSION_STORAGE_FAILED",
+			Message:   "Failed to store session data",
+		})
 	}
 
 	err = s.redisClient.HSet(context.Background(), sessionKey, sessionData).Err()
@@ -131,7 +317,16 @@ func (s *AuthService) LoginHandler(c *fiber.Ctx) error {
 			Message:   "Failed to store session data",
 		})
 	}
-	s.redisClient.Expire(context.Background(), sessionKey, 24*7*time.Hour)
+	policy := session.PolicyFor(user.Role)
+	s.redisClient.Expire(context.Background(), sessionKey, session.TTL(policy, now, now))
+
+	if transport == TransportCookie {
+		setAuthCookies(c, accessToken, refreshToken, csrfToken, policy.AccessTTL, policy.RefreshTTL)
+		return c.JSON(TokenResponse{
+			CSRFToken: csrfToken,
+			User:      fiber.Map{"id": user.UserId, "username": user.Username},
+		})
+	}
 
 	return c.JSON(TokenResponse{
 		AccessToken:  accessToken,
@@ -142,11 +337,20 @@ func (s *AuthService) LoginHandler(c *fiber.Ctx) error {
 
 func (s *AuthService) RefreshTokenHandler(c *fiber.Ctx) error {
 	var req RefreshTokenRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
-			ErrorCode: "INVALID_REQUEST",
-			Message:   "Invalid request body",
-		})
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+				ErrorCode: "INVALID_REQUEST",
+				Message:   "Invalid request body",
+			})
+		}
+	}
+
+	// cookie clients send no body, their refresh token comes from the HttpOnly cookie
+	fromCookie := false
+	if req.RefreshToken == "" {
+		req.RefreshToken = c.Cookies(shared.RefreshTokenCookie)
+		fromCookie = req.RefreshToken != ""
 	}
 
 	if req.RefreshToken == "" {
@@ -156,50 +360,48 @@ func (s *AuthService) RefreshTokenHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	cfg := config.GetConfig()
-	JWT_SECRET := []byte(cfg.Secrets.JWT_SECRET)
-	claims := &shared.Claims{}
-	token, err := jwt.ParseWithClaims(req.RefreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return JWT_SECRET, nil
-	})
+	claims, err := s.VerifyRefreshToken(context.Background(), req.RefreshToken)
 
-	if err != nil || !token.Valid {
+	// refresh tokens of OAuth clients are redeemed at the OAuth token endpoint
+	if errors.Is(err, ErrInvalidRefreshToken) || (err == nil && claims.ClientID != "") {
 		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
 			ErrorCode: "INVALID_REFRESH_TOKEN",
 			Message:   "Refresh token is invalid or expired",
 		})
 	}
-
-	key := fmt.Sprintf("refresh_token:%s:%s", claims.UserID, claims.ID)
-	storedToken, err := s.redisClient.Get(context.Background(), key).Result()
-	if err != nil || storedToken != req.RefreshToken {
+	if errors.Is(err, ErrRefreshTokenRevoked) {
 		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
 			ErrorCode: "REFRESH_TOKEN_NOT_FOUND",
 			Message:   "Refresh token not found or has been revoked",
 		})
 	}
-
-	sessionKey := fmt.Sprintf("session:%s", claims.UserID)
-	exists, err := s.redisClient.Exists(context.Background(), sessionKey).Result()
-	if err != nil || exists == 0 {
+	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
 			ErrorCode: "SESSION_EXPIRED",
 			Message:   "Session has expired, please login again",
 		})
 	}
+	sessionKey := session.Key(claims.UserID)
 
-	// Generate new access tokens
-	accessClaims := &shared.Claims{
-		UserID:   claims.UserID,
-		Username: claims.Username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	// the refresh cookie is sent automatically, so the request must prove it comes from our frontend
+	var csrfToken string
+	if fromCookie {
+		csrfToken, _ = s.redisClient.HGet(context.Background(), sessionKey, "csrfToken").Result()
+		if !middleware.ValidCSRF(c, csrfToken) {
+			return c.Status(fiber.StatusForbidden).JSON(shared.ErrorResponse{
+				ErrorCode: "INVALID_CSRF_TOKEN",
+				Message:   "CSRF token is missing or invalid",
+			})
+		}
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(JWT_SECRET)
+	// Generate new access tokens
+	accessTokenString, err := s.SignAccessToken(TokenSubject{
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
 			ErrorCode: "TOKEN_GENERATION_FAILED",
@@ -207,6 +409,14 @@ func (s *AuthService) RefreshTokenHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	if fromCookie {
+		policy := session.PolicyFor(claims.Role)
+		setAuthCookies(c, accessTokenString, "", csrfToken, policy.AccessTTL, policy.RefreshTTL)
+		return c.JSON(TokenResponse{
+			CSRFToken: csrfToken,
+		})
+	}
+
 	return c.JSON(TokenResponse{
 		AccessToken: accessTokenString,
 	})
@@ -215,16 +425,13 @@ func (s *AuthService) RefreshTokenHandler(c *fiber.Ctx) error {
 func (s *AuthService) LogoutHandler(c *fiber.Ctx) error {
 	userId := c.Locals("userId").(string)
 
-	// delete all refresh tokens for the user
-	pattern := fmt.Sprintf("refresh_token:%s:*", userId)
-	keys, err := s.redisClient.Keys(context.Background(), pattern).Result()
-	if err == nil && len(keys) > 0 {
-		s.redisClient.Del(context.Background(), keys...)
+	// deny the presented token right away, then delete refresh tokens and session so other
+	// tabs are signed out too
+	if expiresAt, ok := c.Locals("tokenExpiresAt").(time.Time); ok && c.Locals("tokenId").(string) != "" {
+		session.DenyToken(context.Background(), s.redisClient, c.Locals("tokenId").(string), expiresAt)
 	}
-
-	// delete session
-	sessionKey := fmt.Sprintf("session:%s", userId)
-	s.redisClient.Del(context.Background(), sessionKey)
+	session.Revoke(context.Background(), s.redisClient, userId, session.ReasonLogout)
+	clearAuthCookies(c)
 
 	return c.JSON(fiber.Map{
 		"message": "Logged out successfully",
@@ -234,10 +441,14 @@ func (s *AuthService) LogoutHandler(c *fiber.Ctx) error {
 func (s *AuthService) ProfileHandler(c *fiber.Ctx) error {
 	userId := c.Locals("userId").(string)
 	username := c.Locals("username").(string)
+	role := c.Locals("role").(string)
 
 	// get session info
-	sessionKey := fmt.Sprintf("session:%s", userId)
+	sessionKey := session.Key(userId)
 	sessionData, err := s.redisClient.HGetAll(context.Background(), sessionKey).Result()
+	if err == nil {
+		err = fieldcrypt.DecryptFields(context.Background(), s.cipher, sessionData, EncryptedSessionFields...)
+	}
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
@@ -246,25 +457,120 @@ func (s *AuthService) ProfileHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	avatarURLs, err := s.avatarService.URLs(context.Background(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "AVATAR_RETRIEVAL_FAILED",
+			Message:   "Failed to retrieve avatar",
+		})
+	}
+
+	usage, err := s.quotaService.Usage(context.Background(), userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "USAGE_RETRIEVAL_FAILED",
+			Message:   "Failed to retrieve storage usage",
+		})
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"user": fiber.Map{
 			"userId":   userId,
 			"username": username,
+			"avatar":   avatarURLs,
 		},
 		"session": sessionData,
+		"storage": fiber.Map{
+			"usage":  usage,
+			"limits": s.quotaService.LimitsFor(userId, role),
+		},
+	})
+}
+
+func (s *AuthService) UploadAvatarHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	role := c.Locals("role").(string)
+
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "MISSING_AVATAR",
+			Message:   "Avatar file is required",
+		})
+	}
+
+	if fileHeader.Size > avatar.MaxUploadSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(shared.ErrorResponse{
+			ErrorCode: "AVATAR_TOO_LARGE",
+			Message:   fmt.Sprintf("Avatar must be at most %d bytes", avatar.MaxUploadSize),
+		})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_REQUEST",
+			Message:   "Failed to read avatar file",
+		})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, avatar.MaxUploadSize))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_REQUEST",
+			Message:   "Failed to read avatar file",
+		})
+	}
+
+	avatarURLs, err := s.avatarService.Upload(context.Background(), userId, role, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, quota.ErrQuotaExceeded):
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(shared.ErrorResponse{
+				ErrorCode: "QUOTA_EXCEEDED",
+				Message:   "Storage quota exceeded",
+			})
+		case errors.Is(err, avatar.ErrUnsupportedFormat):
+			return c.Status(fiber.StatusUnsupportedMediaType).JSON(shared.ErrorResponse{
+				ErrorCode: "UNSUPPORTED_IMAGE_FORMAT",
+				Message:   "Avatar must be a PNG, JPEG, WebP or GIF image",
+			})
+		case errors.Is(err, avatar.ErrImageTooLarge):
+			return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+				ErrorCode: "IMAGE_TOO_LARGE",
+				Message:   fmt.Sprintf("Avatar dimensions must be at most %dx%d", avatar.MaxDimension, avatar.MaxDimension),
+			})
+		case errors.Is(err, avatar.ErrInvalidImage):
+			return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+				ErrorCode: "INVALID_IMAGE",
+				Message:   "Avatar image could not be decoded",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "AVATAR_UPLOAD_FAILED",
+			Message:   "Failed to store avatar",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Avatar updated successfully",
+		"avatar":  avatarURLs,
 	})
 }
 
 func (s *AuthService) LockSessionHandler(c *fiber.Ctx) error {
 	userId := c.Locals("userId").(string)
-	sessionKey := fmt.Sprintf("session:%s", userId)
 
 	// update session to locked
-	err := s.redisClient.HSet(context.Background(), sessionKey, map[string]interface{}{
-		"locked":   true,
-		"lockedAt": time.Now().Unix(),
-	}).Err()
-
+	now := time.Now()
+	err := session.Lock(context.Background(), s.redisClient, userId, now)
+	if errors.Is(err, session.ErrNotFound) {
+		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+			ErrorCode: "SESSION_NOT_FOUND",
+			Message:   "User session not found or has expired",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
 			ErrorCode: "SESSION_LOCK_FAILED",
@@ -274,13 +580,14 @@ func (s *AuthService) LockSessionHandler(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{
 		"message":  "Session locked successfully",
-		"lockedAt": time.Now().Unix(),
+		"lockedAt": now.Unix(),
 	})
 }
 
 func (s *AuthService) UnlockSessionHandler(c *fiber.Ctx) error {
 	userId := c.Locals("userId").(string)
 	username := c.Locals("username").(string)
+	role := c.Locals("role").(string)
 
 	var req UnlockRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -298,7 +605,7 @@ func (s *AuthService) UnlockSessionHandler(c *fiber.Ctx) error {
 	}
 
 	// check session
-	sessionKey := fmt.Sprintf("session:%s", userId)
+	sessionKey := session.Key(userId)
 	sessionData, err := s.redisClient.HGetAll(context.Background(), sessionKey).Result()
 
 	if err != nil || len(sessionData) == 0 {
@@ -309,49 +616,45 @@ func (s *AuthService) UnlockSessionHandler(c *fiber.Ctx) error {
 	}
 
 	// check if session is locked
-	if sessionData["locked"] != "1" && sessionData["locked"] != "true" {
+	if !session.IsLocked(sessionData) {
 		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
 			ErrorCode: "SESSION_NOT_LOCKED",
 			Message:   "Session is not locked",
 		})
 	}
 
-	// check lock over 10 min
-	if lockedAtStr, exists := sessionData["lockedAt"]; exists {
-		lockedAt, _ := strconv.ParseInt(lockedAtStr, 10, 64)
-		lockDuration := time.Now().Unix() - lockedAt
-
-		if lockDuration > 600 {
-			s.deleteUserSession(userId)
-			return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
-				ErrorCode: "LOCK_TIMEOUT",
-				Message:   "Session lock timeout. Please login again.",
-			})
-		}
-	}
-
-	// verify password
-	user, exists := users[username]
-	if !exists {
+	// check lock timeout
+	if session.LockRemaining(sessionData, session.PolicyFor(role), time.Now()) < 0 {
+		session.Revoke(context.Background(), s.redisClient, userId, session.ReasonLockTimeout)
 		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
-			ErrorCode: "USER_NOT_FOUND",
-			Message:   "User not found",
+			ErrorCode: "LOCK_TIMEOUT",
+			Message:   "Session lock timeout. Please login again.",
 		})
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
-	if err != nil {
+	// verify password, with the same backends as the login
+	user, err := s.passwords.VerifyPassword(context.Background(), username, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) || (err == nil && user.UserId != userId) {
 		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
 			ErrorCode: "INVALID_PASSWORD",
 			Message:   "Invalid password",
 		})
 	}
+	if err != nil {
+		log.Printf("Password verification for %s failed: %v", username, err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(shared.ErrorResponse{
+			ErrorCode: "AUTH_BACKEND_UNAVAILABLE",
+			Message:   "Password verification is temporarily unavailable",
+		})
+	}
 
-	// unlock session
+	// unlock session, the idle clock restarts from the unlock
+	now := time.Now()
 	err = s.redisClient.HSet(context.Background(), sessionKey, map[string]interface{}{
-		"locked":     false,
-		"lockedAt":   0,
-		"unlockedAt": time.Now().Unix(),
+		"locked":       false,
+		"lockedAt":     0,
+		"unlockedAt":   now.Unix(),
+		"lastActivity": now.Unix(),
 	}).Err()
 
 	if err != nil {
@@ -360,6 +663,7 @@ func (s *AuthService) UnlockSessionHandler(c *fiber.Ctx) error {
 			Message:   "Failed to unlock session",
 		})
 	}
+	session.Publish(context.Background(), s.redisClient, userId, session.Event{Type: session.EventUnlocked, At: now.Unix()})
 
 	return c.JSON(fiber.Map{
 		"message": "Unlocked successfully",
@@ -370,25 +674,12 @@ func (s *AuthService) UnlockSessionHandler(c *fiber.Ctx) error {
 	})
 }
 
-func (s *AuthService) deleteUserSession(userId string) {
-	// delete all refresh tokens for the user
-	pattern := fmt.Sprintf("refresh_token:%s:*", userId)
-	keys, err := s.redisClient.Keys(context.Background(), pattern).Result()
-
-	if err == nil && len(keys) > 0 {
-		s.redisClient.Del(context.Background(), keys...)
-	}
-
-	// delete session
-	sessionKey := fmt.Sprintf("session:%s", userId)
-	s.redisClient.Del(context.Background(), sessionKey)
-}
-
 // Handler สำหรับเช็คสถานะ session
 func (s *AuthService) CheckSessionHandler(c *fiber.Ctx) error {
 	userId := c.Locals("userId").(string)
+	role := c.Locals("role").(string)
 
-	sessionKey := fmt.Sprintf("session:%s", userId)
+	sessionKey := session.Key(userId)
 	sessionData, err := s.redisClient.HGetAll(context.Background(), sessionKey).Result()
 
 	if err != nil || len(sessionData) == 0 {
@@ -398,30 +689,74 @@ func (s *AuthService) CheckSessionHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	isLocked := sessionData["locked"] == "1" || sessionData["locked"] == "true"
+	isLocked := session.IsLocked(sessionData)
 
 	response := fiber.Map{
 		"locked": isLocked,
 	}
 
 	if isLocked {
-		if lockedAtStr, exists := sessionData["lockedAt"]; exists {
-			lockedAt, _ := strconv.ParseInt(lockedAtStr, 10, 64)
-			lockDuration := time.Now().Unix() - lockedAt
-
-			// ถ้า lock เกิน 10 นาที ให้ logout
-			if lockDuration > 600 {
-				s.deleteUserSession(userId)
-				return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
-					ErrorCode: "LOCK_TIMEOUT",
-					Message:   "Session expired due to inactivity",
-				})
-			}
-
-			response["lockedAt"] = lockedAt
-			response["timeRemaining"] = 600 - lockDuration
+		policy := session.PolicyFor(role)
+		remaining := session.LockRemaining(sessionData, policy, time.Now())
+
+		// ถ้า lock เกิน lock timeout ให้ logout
+		if remaining < 0 {
+			session.Revoke(context.Background(), s.redisClient, userId, session.ReasonLockTimeout)
+			return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+				ErrorCode: "LOCK_TIMEOUT",
+				Message:   "Session expired due to inactivity",
+			})
+		}
+
+		lockedAt, _ := strconv.ParseInt(sessionData["lockedAt"], 10, 64)
+		response["lockedAt"] = lockedAt
+		if policy.LockTimeout > 0 {
+			response["timeRemaining"] = int64(remaining.Seconds())
 		}
 	}
 
 	return c.JSON(response)
 }
+
+// EventsHandler streams the session events of the user as Server-Sent Events, so every tab
+// learns about a lock, unlock or revocation without polling. The stream ends when the access
+// token expires, clients reconnect with the refreshed token. A lock that times out while the
+// stream is open revokes the session right away.
+func (s *AuthService) EventsHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	sessionId, _ := c.Locals("sessionId").(string)
+	policy := session.PolicyFor(c.Locals("role").(string))
+	tokenExpiresAt, ok := c.Locals("tokenExpiresAt").(time.Time)
+	if !ok {
+		tokenExpiresAt = time.Now().Add(policy.AccessTTL)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), tokenExpiresAt)
+	sub, err := session.Subscribe(ctx, s.redisClient, userId)
+	if err != nil {
+		cancel()
+		return c.Status(fiber.StatusServiceUnavailable).JSON(shared.ErrorResponse{
+			ErrorCode: "EVENTS_UNAVAILABLE",
+			Message:   "Session events are unavailable",
+		})
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		defer sub.Close()
+
+		session.Stream(ctx, w, sub, tokenExpiresAt, &session.LockWatch{
+			RedisClient: s.redisClient,
+			UserID:      userId,
+			SessionID:   sessionId,
+			Policy:      policy,
+		})
+	})
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+)
+
+// UserStore is the local user store. It is still an in-memory mock database, guarded so
+// accounts can be provisioned and updated while serving.
+type UserStore struct {
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+func NewUserStore(users ...User) *UserStore {
+	s := &UserStore{users: map[string]User{}}
+	for _, user := range users {
+		s.users[user.Username] = user
+	}
+	return s
+}
+
+func (s *UserStore) Get(username string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	return user, ok
+}
+
+// FindByEmail returns the account with email, compared case-insensitively
+func (s *UserStore) FindByEmail(email string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email != "" && strings.EqualFold(user.Email, email) {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// Update creates or changes the account of username atomically. fn gets the current
+// account, if any, and returns the one to store, or false to leave the store unchanged.
+func (s *UserStore) Update(username string, fn func(user User, exists bool) (User, bool)) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.users[username]
+	user, ok := fn(current, exists)
+	if !ok {
+		return current, false
+	}
+	s.users[username] = user
+	return user, true
+}
@@ -0,0 +1,246 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MaxUploadSize = 2 * 1024 * 1024
+	MaxDimension  = 4096
+)
+
+// ThumbnailSizes are the square edge lengths (in pixels) generated for every avatar
+var ThumbnailSizes = []int{64, 128, 256}
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrImageTooLarge     = errors.New("image dimensions too large")
+	ErrInvalidImage      = errors.New("invalid image data")
+)
+
+// content type (from sniffing) -> format name (from image.Decode)
+var allowedTypes = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Processed holds a metadata-free re-encoded avatar and its thumbnails
+type Processed struct {
+	ContentType string
+	Extension   string
+	Original    []byte
+	Thumbnails  map[int][]byte
+}
+
+// Sniff detects the image type from the content itself, ignoring any client supplied content type
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := allowedTypes[contentType]; !ok {
+		return "", ErrUnsupportedFormat
+	}
+	return contentType, nil
+}
+
+// Process validates the image and re-encodes it from raw pixels, which drops EXIF and any other
+// embedded metadata. JPEG orientation is applied before the metadata is discarded.
+func Process(data []byte) (*Processed, error) {
+	contentType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// check dimensions before decoding to avoid decompression bombs
+	imgConfig, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != allowedTypes[contentType] {
+		return nil, ErrInvalidImage
+	}
+	if imgConfig.Width > MaxDimension || imgConfig.Height > MaxDimension {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	// jpeg stays jpeg, everything else becomes png to keep transparency
+	encode := encodePNG
+	result := &Processed{
+		ContentType: "image/png",
+		Extension:   "png",
+		Thumbnails:  make(map[int][]byte, len(ThumbnailSizes)),
+	}
+	if format == "jpeg" {
+		encode = encodeJPEG
+		result.ContentType = "image/jpeg"
+		result.Extension = "jpg"
+	}
+
+	result.Original, err = encode(img)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, size := range ThumbnailSizes {
+		thumb, err := encode(thumbnail(img, size))
+		if err != nil {
+			return nil, err
+		}
+		result.Thumbnails[size] = thumb
+	}
+
+	return result, nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// thumbnail center-crops the image to a square and scales it to size x size
+func thumbnail(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	edge := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-edge)/2
+	y0 := b.Min.Y + (b.Dy()-edge)/2
+	crop := image.Rect(x0, y0, x0+edge, y0+edge)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) from a JPEG, returning 1 when absent
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		segLen := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || segLen < 2 || pos+2+segLen > len(data) {
+			return 1
+		}
+
+		segment := data[pos+4 : pos+2+segLen]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + segLen
+	}
+
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// applyOrientation transforms the image so it displays upright once the EXIF tag is gone
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation <= 1 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	swap := orientation >= 5
+
+	dw, dh := w, h
+	if swap {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,194 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+func encodeTestPNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeTestGIF(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeTestJPEGWithExif inserts an APP1 Exif segment carrying the given orientation and a marker string
+func encodeTestJPEGWithExif(t *testing.T, img image.Image, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, []byte("SECRET-GPS-DATA")...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, raw[:2]...)
+	out = append(out, segment...)
+	return append(out, raw[2:]...)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "PNG",
+			input: encodeTestPNG(t, testImage(4, 4)),
+			want:  "image/png",
+		},
+		{
+			name:  "GIF",
+			input: encodeTestGIF(t, testImage(4, 4)),
+			want:  "image/gif",
+		},
+		{
+			name:  "WebP header",
+			input: []byte("RIFF\x00\x00\x00\x00WEBPVP8 "),
+			want:  "image/webp",
+		},
+		{
+			name:    "Plain text",
+			input:   []byte("hello world"),
+			wantErr: true,
+		},
+		{
+			name:    "SVG is rejected",
+			input:   []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sniff(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Sniff() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Sniff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           []byte
+		wantContentType string
+		wantWidth       int
+		wantHeight      int
+		wantErr         error
+	}{
+		{
+			name:            "PNG stays PNG",
+			input:           encodeTestPNG(t, testImage(40, 20)),
+			wantContentType: "image/png",
+			wantWidth:       40,
+			wantHeight:      20,
+		},
+		{
+			name:            "GIF becomes PNG",
+			input:           encodeTestGIF(t, testImage(10, 10)),
+			wantContentType: "image/png",
+			wantWidth:       10,
+			wantHeight:      10,
+		},
+		{
+			name:            "JPEG with EXIF rotation is rotated and stripped",
+			input:           encodeTestJPEGWithExif(t, testImage(40, 20), 6),
+			wantContentType: "image/jpeg",
+			wantWidth:       20,
+			wantHeight:      40,
+		},
+		{
+			name:    "Truncated PNG",
+			input:   encodeTestPNG(t, testImage(40, 20))[:60],
+			wantErr: ErrInvalidImage,
+		},
+		{
+			name:    "Oversized dimensions",
+			input:   encodeTestPNG(t, image.NewGray(image.Rect(0, 0, MaxDimension+1, 1))),
+			wantErr: ErrImageTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Process(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Process() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.ContentType != tt.wantContentType {
+				t.Errorf("Process() content type = %v, want %v", got.ContentType, tt.wantContentType)
+			}
+			if bytes.Contains(got.Original, []byte("Exif")) || bytes.Contains(got.Original, []byte("SECRET-GPS-DATA")) {
+				t.Errorf("Process() kept EXIF metadata")
+			}
+
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(got.Original))
+			if err != nil {
+				t.Fatalf("decode original: %v", err)
+			}
+			if cfg.Width != tt.wantWidth || cfg.Height != tt.wantHeight {
+				t.Errorf("Process() original = %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantWidth, tt.wantHeight)
+			}
+
+			for _, size := range ThumbnailSizes {
+				cfg, _, err := image.DecodeConfig(bytes.NewReader(got.Thumbnails[size]))
+				if err != nil {
+					t.Fatalf("decode thumbnail %d: %v", size, err)
+				}
+				if cfg.Width != size || cfg.Height != size {
+					t.Errorf("Process() thumbnail = %dx%d, want %dx%d", cfg.Width, cfg.Height, size, size)
+				}
+			}
+		})
+	}
+}
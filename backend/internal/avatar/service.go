@@ -0,0 +1,174 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go-backend/internal/quota"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/redis/go-redis/v9"
+)
+
+const urlExpiry = 1 * time.Hour
+
+// swapScript stores the new version and returns the one it replaced in the same step, so of two
+// concurrent uploads each cleans up exactly the version it replaced
+var swapScript = redis.NewScript(`
+local previous = redis.call('HMGET', KEYS[1], 'version', 'bytes', 'objects')
+redis.call('HSET', KEYS[1], 'version', ARGV[1], 'extension', ARGV[2], 'bytes', ARGV[3], 'objects', ARGV[4], 'updatedAt', ARGV[5])
+return previous
+`)
+
+// storedVersion is one uploaded version of an avatar as recorded in avatar:<userId>
+type storedVersion struct {
+	Version   string
+	Extension string
+	Bytes     int64
+	Objects   int64
+}
+
+type AvatarService struct {
+	redisClient  *redis.Client
+	minioClient  *minio.Client
+	bucket       string
+	quotaService *quota.QuotaService
+}
+
+func NewAvatarService(redisClient *redis.Client, minioClient *minio.Client, bucket string, quotaService *quota.QuotaService) *AvatarService {
+	return &AvatarService{
+		redisClient:  redisClient,
+		minioClient:  minioClient,
+		bucket:       bucket,
+		quotaService: quotaService,
+	}
+}
+
+// Upload processes the image and stores the original and every thumbnail under a new version,
+// then removes the objects of the previous version. All variants count against the user's quota.
+func (s *AvatarService) Upload(ctx context.Context, userId, role string, data []byte) (map[string]string, error) {
+	processed, err := Process(data)
+	if err != nil {
+		return nil, err
+	}
+
+	version := uuid.New().String()
+	objects := map[string][]byte{
+		objectName(userId, version, "original", processed.Extension): processed.Original,
+	}
+	for size, thumb := range processed.Thumbnails {
+		objects[objectName(userId, version, strconv.Itoa(size), processed.Extension)] = thumb
+	}
+
+	var totalBytes int64
+	for _, content := range objects {
+		totalBytes += int64(len(content))
+	}
+
+	if err := s.quotaService.Reserve(ctx, userId, role, totalBytes, int64(len(objects))); err != nil {
+		return nil, err
+	}
+
+	for name, content := range objects {
+		_, err := s.minioClient.PutObject(ctx, s.bucket, name, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{
+			ContentType:  processed.ContentType,
+			CacheControl: "private, max-age=31536000, immutable",
+		})
+		if err != nil {
+			s.removeVersion(ctx, userId, version)
+			s.quotaService.Cancel(ctx, userId, totalBytes, int64(len(objects)))
+			return nil, err
+		}
+	}
+
+	previous, err := s.swap(ctx, userId, storedVersion{
+		Version:   version,
+		Extension: processed.Extension,
+		Bytes:     totalBytes,
+		Objects:   int64(len(objects)),
+	})
+	if err != nil {
+		s.removeVersion(ctx, userId, version)
+		s.quotaService.Cancel(ctx, userId, totalBytes, int64(len(objects)))
+		return nil, err
+	}
+	s.quotaService.Commit(ctx, userId)
+
+	if previous.Version != "" {
+		s.removeVersion(ctx, userId, previous.Version)
+		s.quotaService.Release(ctx, userId, previous.Bytes, previous.Objects)
+	}
+
+	return s.URLs(ctx, userId)
+}
+
+// URLs returns presigned URLs keyed by "original" and thumbnail size, or nil when the user has no avatar
+func (s *AvatarService) URLs(ctx context.Context, userId string) (map[string]string, error) {
+	avatarData, err := s.redisClient.HGetAll(ctx, fmt.Sprintf("avatar:%s", userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if avatarData["version"] == "" {
+		return nil, nil
+	}
+
+	variants := []string{"original"}
+	for _, size := range ThumbnailSizes {
+		variants = append(variants, strconv.Itoa(size))
+	}
+
+	urls := make(map[string]string, len(variants))
+	for _, variant := range variants {
+		name := objectName(userId, avatarData["version"], variant, avatarData["extension"])
+		u, err := s.minioClient.PresignedGetObject(ctx, s.bucket, name, urlExpiry, nil)
+		if err != nil {
+			return nil, err
+		}
+		urls[variant] = u.String()
+	}
+
+	return urls, nil
+}
+
+// swap makes current the user's avatar and returns the version it replaced, whose Version is
+// empty for a first upload
+func (s *AvatarService) swap(ctx context.Context, userId string, current storedVersion) (storedVersion, error) {
+	values, err := swapScript.Run(ctx, s.redisClient, []string{fmt.Sprintf("avatar:%s", userId)},
+		current.Version, current.Extension, current.Bytes, current.Objects, time.Now().Unix()).Slice()
+	if err != nil {
+		return storedVersion{}, err
+	}
+
+	fields := make([]string, len(values))
+	for i, value := range values {
+		fields[i], _ = value.(string)
+	}
+
+	var previous storedVersion
+	previous.Version = fields[0]
+	previous.Bytes, _ = strconv.ParseInt(fields[1], 10, 64)
+	previous.Objects, _ = strconv.ParseInt(fields[2], 10, 64)
+	return previous, nil
+}
+
+func (s *AvatarService) removeVersion(ctx context.Context, userId, version string) {
+	prefix := fmt.Sprintf("%savatar/%s/", quota.UserPrefix(userId), version)
+	for object := range s.minioClient.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			log.Printf("avatar cleanup list failed for %s: %v", prefix, object.Err)
+			return
+		}
+		if err := s.minioClient.RemoveObject(ctx, s.bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("avatar cleanup failed for %s: %v", object.Key, err)
+		}
+	}
+}
+
+func objectName(userId, version, variant, extension string) string {
+	return fmt.Sprintf("%savatar/%s/%s.%s", quota.UserPrefix(userId), version, variant, extension)
+}
@@ -0,0 +1,59 @@
+package avatar
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSwap(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	s := &AvatarService{redisClient: redisClient}
+
+	first, err := s.swap(ctx, "u1", storedVersion{Version: "v1", Extension: "png", Bytes: 100, Objects: 4})
+	if err != nil || first != (storedVersion{}) {
+		t.Fatalf("swap() = %+v, %v, want no previous version", first, err)
+	}
+
+	second, err := s.swap(ctx, "u1", storedVersion{Version: "v2", Extension: "jpg", Bytes: 200, Objects: 4})
+	if err != nil || second != (storedVersion{Version: "v1", Bytes: 100, Objects: 4}) {
+		t.Fatalf("swap() = %+v, %v, want v1 with 100 bytes and 4 objects", second, err)
+	}
+	if got := mr.HGet("avatar:u1", "extension"); got != "jpg" {
+		t.Errorf("extension = %q, want jpg", got)
+	}
+
+	// concurrent uploads each get back a different version, every replaced one is cleaned up once
+	var mu sync.Mutex
+	var replaced []string
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			previous, err := s.swap(ctx, "u1", storedVersion{Version: fmt.Sprintf("c%d", i), Extension: "png", Bytes: 1, Objects: 1})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			replaced = append(replaced, previous.Version)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	replaced = append(replaced, mr.HGet("avatar:u1", "version"))
+	slices.Sort(replaced)
+	if len(slices.Compact(slices.Clone(replaced))) != 21 || !slices.Contains(replaced, "v2") {
+		t.Errorf("replaced versions = %v, want v2 and every concurrent version exactly once", replaced)
+	}
+}
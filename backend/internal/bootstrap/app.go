@@ -2,13 +2,19 @@ package bootstrap
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"time"
 
+	"go-backend/internal/apikey"
 	"go-backend/internal/auth"
 	"go-backend/internal/config"
+	"go-backend/internal/fieldcrypt"
+	"go-backend/internal/files"
 	"go-backend/internal/middleware"
+	"go-backend/internal/oauth"
+	"go-backend/internal/quota"
+	"go-backend/internal/scan"
+	"go-backend/internal/session"
 	"go-backend/internal/shared"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,32 +22,44 @@ import (
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 )
 
-func InitializeApp(app *fiber.App) {
+// InitializeApp wires every dependency and route. The returned function stops background
+// workers and releases clients, and must be called after the server has stopped.
+func InitializeApp(app *fiber.App) func() {
 	// ******* Initialize Config *******
 	config.InitConfig()
-	config.LoadEnv()
+	if _, err := config.LoadEnv(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
 
 	cfg := config.GetConfig()
 
-	if cfg.Env.APP_ENV == "" ||
-		cfg.Env.VAULT_HOST == "" ||
-		cfg.Env.VAULT_PORT == "" ||
-		(cfg.Env.VAULT_TOKEN == "" && cfg.Env.VAULT_DEV_MODE) ||
-		(cfg.Env.VAULT_ROLE == "" && !cfg.Env.VAULT_DEV_MODE) {
-		log.Fatal("Missing required environment variables")
+	if err := session.LoadPolicies(); err != nil {
+		log.Fatal(err)
 	}
 
+	// ******* Background Workers Context *******
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// ******* Initialize Vault Client *******
-	vaultClient, err := InitializeVault()
+	vaultClient, tokenManager, err := InitializeVault()
 	if err != nil {
 		log.Fatal(err)
 	}
+	if tokenManager != nil {
+		tokenManager.Start(ctx)
+	}
 
-	// ******* Load Secrets from Vault *******
-	err = config.LoadSecrets(vaultClient)
+	// ******* Load Secrets *******
+	secretChain, err := config.NewSecretChain(vaultClient)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = config.LoadSecrets(secretChain)
 	if err != nil {
 		log.Fatal(err)
 	}
+	go config.WatchSecrets(ctx, secretChain, cfg.Env.SECRETS_RELOAD_INTERVAL)
+	go reloadSecretsOnSignal(ctx, secretChain)
 
 	// ******* Initialize Redis *******
 	redisClient, err := InitializeRedis()
@@ -49,11 +67,77 @@ func InitializeApp(app *fiber.App) {
 		log.Fatal(err)
 	}
 
+	// ******* Initialize OIDC Login *******
+	relyingParty, err := InitializeOIDC(redisClient, secretChain)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ******* Initialize LDAP Directory *******
+	directory, err := InitializeLDAP()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ******* Initialize Password Policy *******
+	passwordPolicy, err := InitializePasswordPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ******* Initialize OAuth Authorization Server *******
+	oauthClients, oauthSigner, err := InitializeOAuth(secretChain)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// ******* Initialize MinIO *******
-	_, err = InitializeMinio()
+	minioClient, err := InitializeMinio()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ******* Initialize Database *******
+	db, dbCredentials, err := InitializeDatabase(vaultClient)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dbCredentials != nil {
+		dbCredentials.Start(ctx, DatabaseRotator(db))
+	}
+
+	// ******* Initialize Field Encryption *******
+	cipher, err := InitializeFieldEncryption(vaultClient)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rewrapper := fieldcrypt.NewRewrapper(redisClient, cipher, fieldcrypt.Target{
+		Pattern: "session:*",
+		Fields:  auth.EncryptedSessionFields,
+	})
+	go rewrapper.Start(ctx, cfg.Env.FIELD_REWRAP_INTERVAL)
+
+	// ******* Initialize Storage Quota *******
+	quotaService, err := quota.NewQuotaService(redisClient, minioClient)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go quotaService.StartReconciler(ctx, cfg.Env.QUOTA_RECONCILE_INTERVAL)
+
+	// ******* Initialize Upload Scanner *******
+	scanner, err := scan.NewScanner()
+	if err != nil {
+		log.Fatal(err)
+	}
+	scanPipeline := files.NewScanPipeline(redisClient, minioClient, cfg.Env.MINIO_BUCKET, scanner, quotaService, cfg.Env.SCAN_LEASE)
+	scanPipeline.Start(ctx, cfg.Env.SCAN_WORKERS)
+
+	// ******* Initialize Notifications *******
+	outbox, err := InitializeNotifications(redisClient)
 	if err != nil {
 		log.Fatal(err)
 	}
+	outbox.Start(ctx, cfg.Env.NOTIFY_WORKERS)
 
 	// ******* Setup Swagger and Static File Serving *******
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
@@ -62,9 +146,10 @@ func InitializeApp(app *fiber.App) {
 
 	// ******* CORS Middleware *******
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "http://localhost:3000, http://localhost:5173",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST",
+		AllowOrigins:     "http://localhost:3000, http://localhost:5173",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, " + shared.CSRFHeader,
+		AllowMethods:     "GET, POST, DELETE",
+		AllowCredentials: true, // cookie transport
 	}))
 
 	// ******* Security Header Protocol *******
@@ -87,8 +172,117 @@ func InitializeApp(app *fiber.App) {
 		})
 	})
 
+	// ******* Readiness Endpoint *******
+	api.Get("/ready", func(c *fiber.Ctx) error {
+		redisErr := verifyRedis(redisClient)
+
+		status := fiber.StatusOK
+		if redisErr != nil {
+			status = fiber.StatusServiceUnavailable
+		}
+
+		redisStatus := "OK"
+		if redisErr != nil {
+			redisStatus = redisErr.Error()
+		}
+
+		body := fiber.Map{
+			"Redis":      redisStatus,
+			"ServerTime": time.Now(),
+		}
+
+		if tokenManager != nil {
+			body["Vault"] = tokenManager.Status()
+			if !tokenManager.Ready() {
+				status = fiber.StatusServiceUnavailable
+			}
+		}
+
+		if db != nil {
+			ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+			defer cancel()
+
+			body["Database"] = "OK"
+			if err := db.Ping(ctx); err != nil {
+				body["Database"] = err.Error()
+				status = fiber.StatusServiceUnavailable
+			}
+		}
+
+		return c.Status(status).JSON(body)
+	})
+
+	// ******* Admin routes *******
+	admin := api.Group("/admin", middleware.ScopedAuthMiddleware(redisClient, shared.ScopeAdmin), middleware.RequireRole("admin"))
+
+	admin.Post("/secrets/reload", func(c *fiber.Ctx) error {
+		changed, err := config.ReloadSecrets(secretChain)
+		if err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(shared.ErrorResponse{
+				ErrorCode: "SECRETS_RELOAD_FAILED",
+				Message:   "Failed to reload secrets",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"changed": changed,
+		})
+	})
+
+	admin.Get("/debug/config", func(c *fiber.Ctx) error {
+		env, secrets := config.Effective()
+
+		return c.JSON(fiber.Map{
+			"env":     env,
+			"secrets": secrets,
+		})
+	})
+
+	admin.Post("/sessions/:userId/revoke", func(c *fiber.Ctx) error {
+		session.Revoke(c.Context(), redisClient, c.Params("userId"), session.ReasonAdmin)
+
+		return c.JSON(fiber.Map{
+			"message": "Session revoked",
+		})
+	})
+
+	admin.Post("/fieldcrypt/rewrap", func(c *fiber.Ctx) error {
+		rewrapped, err := rewrapper.Run(c.Context())
+		if err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(shared.ErrorResponse{
+				ErrorCode: "REWRAP_FAILED",
+				Message:   "Failed to re-wrap encrypted fields",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"rewrapped": rewrapped,
+		})
+	})
+
+	// service accounts are managed by a signed-in admin, an admin API key cannot mint more keys
+	apiKeyHandler := auth.NewAPIKeyHandler(apikey.NewStore(redisClient))
+	serviceAccounts := admin.Group("/service-accounts", middleware.RequireSession())
+	serviceAccounts.Get("/", apiKeyHandler.ServiceAccountsHandler)
+	serviceAccounts.Post("/", apiKeyHandler.CreateServiceAccountHandler)
+	serviceAccounts.Delete("/:accountId", apiKeyHandler.DeleteServiceAccountHandler)
+	serviceAccounts.Get("/:accountId/api-keys", apiKeyHandler.ServiceAccountKeysHandler)
+	serviceAccounts.Post("/:accountId/api-keys", apiKeyHandler.CreateServiceAccountKeyHandler)
+	serviceAccounts.Delete("/:accountId/api-keys/:keyId", apiKeyHandler.RevokeServiceAccountKeyHandler)
+
 	// ******* Register Auth routes *******
-	auth.RegisterRoutes(&api, redisClient)
+	authService, err := auth.RegisterRoutes(&api, redisClient, minioClient, quotaService, cipher, relyingParty, directory, passwordPolicy, InitializePasswordHasher(), outbox)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// ******* Register OAuth routes *******
+	if oauthClients != nil {
+		oauth.RegisterRoutes(&api, redisClient, authService, oauthClients, oauthSigner, cfg.Env.OAUTH_ISSUER, cfg.Env.OAUTH_CONSENT_URL)
+	}
+
+	// ******* Register File routes *******
+	files.RegisterRoutes(&api, redisClient, minioClient, quotaService, scanPipeline)
 
 	// ******* Create protected routes group *******
 	protected := api.Group("/", middleware.AuthMiddleware(redisClient))
@@ -99,8 +293,11 @@ func InitializeApp(app *fiber.App) {
 		username := c.Locals("username").(string)
 
 		// get session info
-		sessionKey := fmt.Sprintf("session:%s", userId)
+		sessionKey := session.Key(userId)
 		sessionData, err := redisClient.HGetAll(context.Background(), sessionKey).Result()
+		if err == nil {
+			err = fieldcrypt.DecryptFields(context.Background(), cipher, sessionData, auth.EncryptedSessionFields...)
+		}
 
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
@@ -118,4 +315,21 @@ func InitializeApp(app *fiber.App) {
 		})
 	})
 
+	return func() {
+		cancel()
+		if dbCredentials != nil {
+			dbCredentials.Stop()
+		}
+		if db != nil {
+			db.Close()
+		}
+		if tokenManager != nil {
+			tokenManager.Stop()
+		}
+		if directory != nil {
+			directory.Close()
+		}
+		redisClient.Close()
+		log.Println("✓ Background workers stopped")
+	}
 }
@@ -1 +1,113 @@
 package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/database"
+	"go-backend/internal/vault"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// InitializeDatabase connects to Postgres when DB_HOST is set and returns nil otherwise.
+// With DB_CREDENTIALS=vault the credentials are leased from the database secrets engine and
+// the returned manager has to be started to keep them renewed and rotated.
+func InitializeDatabase(vaultClient *api.Client) (*database.DB, *vault.DatabaseCredentialManager, error) {
+	cfg := config.GetConfig()
+
+	if cfg.Env.DB_HOST == "" {
+		log.Println("Database not configured, skipping")
+		return nil, nil, nil
+	}
+
+	var manager *vault.DatabaseCredentialManager
+	switch cfg.Env.DB_CREDENTIALS {
+	case "static":
+	case "vault":
+		if vaultClient == nil {
+			return nil, nil, fmt.Errorf("DB_CREDENTIALS=vault requires VAULT_HOST")
+		}
+		if cfg.Env.VAULT_DB_ROLE == "" {
+			return nil, nil, fmt.Errorf("DB_CREDENTIALS=vault requires VAULT_DB_ROLE")
+		}
+		manager = vault.NewDatabaseCredentialManager(vaultClient, cfg.Env.VAULT_DB_MOUNT, cfg.Env.VAULT_DB_ROLE)
+	default:
+		return nil, nil, fmt.Errorf("unknown DB_CREDENTIALS %q", cfg.Env.DB_CREDENTIALS)
+	}
+
+	maxRetry := cfg.Env.INIT_MAX_RETRY
+
+	var err error
+	for attempt := 1; attempt <= maxRetry; attempt++ {
+		var db *database.DB
+		db, err = openDatabase(manager)
+
+		if err == nil {
+			if manager == nil {
+				config.OnSecretsChange(func(old, new config.SecretsConfig) {
+					if old.DB_PASSWORD != new.DB_PASSWORD {
+						rotateDatabase(db, config.GetConfig().Env.DB_USER, new.DB_PASSWORD.Reveal())
+					}
+				})
+			}
+
+			log.Println("✓ Database client initialized successfully")
+			return db, manager, nil
+		}
+
+		log.Printf("Database not ready (%d/%d): %v\n", attempt, maxRetry, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+
+	return nil, nil, fmt.Errorf("Database initialization failed after %d attempts: %w", maxRetry, err)
+}
+
+// DatabaseRotator swaps the pool over to leased credentials once the previous lease runs out
+func DatabaseRotator(db *database.DB) vault.RotateFunc {
+	return func(creds vault.DatabaseCredentials) error {
+		return db.Rotate(databaseDSN(creds.Username, creds.Password))
+	}
+}
+
+func openDatabase(manager *vault.DatabaseCredentialManager) (*database.DB, error) {
+	cfg := config.GetConfig()
+
+	username, password := cfg.Env.DB_USER, cfg.Secrets.DB_PASSWORD.Reveal()
+	if manager != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		creds, err := manager.Fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		username, password = creds.Username, creds.Password
+	}
+
+	return database.Open("pgx", databaseDSN(username, password))
+}
+
+func rotateDatabase(db *database.DB, username, password string) {
+	if err := db.Rotate(databaseDSN(username, password)); err != nil {
+		log.Printf("Database rejected the reloaded password, keeping existing connections: %v", err)
+	}
+}
+
+func databaseDSN(username, password string) string {
+	env := config.GetConfig().Env
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(username, password),
+		Host:     net.JoinHostPort(env.DB_HOST, env.DB_PORT),
+		Path:     "/" + env.DB_NAME,
+		RawQuery: url.Values{"sslmode": {env.DB_SSLMODE}}.Encode(),
+	}
+	return dsn.String()
+}
@@ -0,0 +1,43 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/fieldcrypt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// InitializeFieldEncryption uses the Vault transit key when Vault is configured and falls back
+// to a local key from the field_encryption_key secret otherwise
+func InitializeFieldEncryption(vaultClient *api.Client) (fieldcrypt.Cipher, error) {
+	cfg := config.GetConfig()
+
+	if vaultClient == nil {
+		key, err := base64.StdEncoding.DecodeString(cfg.Secrets.FIELD_ENCRYPTION_KEY.Reveal())
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("field encryption without Vault requires the field_encryption_key secret (base64, 32 bytes)")
+		}
+
+		log.Println("✓ Field encryption initialized with a local key")
+		return fieldcrypt.NewLocalCipher(key)
+	}
+
+	cipher := fieldcrypt.NewTransitCipher(vaultClient, cfg.Env.TRANSIT_MOUNT, cfg.Env.TRANSIT_KEY)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	version, err := cipher.LatestVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("✓ Field encryption initialized with transit key %s (v%d)", cfg.Env.TRANSIT_KEY, version)
+	return cipher, nil
+}
@@ -0,0 +1,71 @@
+package bootstrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	"go-backend/internal/config"
+	"go-backend/internal/ldapauth"
+)
+
+// InitializeLDAP returns the directory used by the ldap password backend, nil when LDAP_URL
+// is not set
+func InitializeLDAP() (*ldapauth.Directory, error) {
+	cfg := config.GetConfig()
+	env := cfg.Env
+
+	if env.LDAP_URL == "" {
+		log.Println("LDAP not configured, skipping")
+		return nil, nil
+	}
+
+	groupRoles, err := ldapauth.ParseGroupRoles(env.LDAP_GROUP_ROLES)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP_GROUP_ROLES: %w", err)
+	}
+	if len(groupRoles) == 0 && env.LDAP_DEFAULT_ROLE == "" {
+		return nil, fmt.Errorf("LDAP needs LDAP_GROUP_ROLES or LDAP_DEFAULT_ROLE, otherwise no user could sign in")
+	}
+
+	var tlsConfig *tls.Config
+	if env.LDAP_CA_CERT != "" {
+		pem, err := os.ReadFile(env.LDAP_CA_CERT)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("LDAP_CA_CERT %s holds no PEM certificate", env.LDAP_CA_CERT)
+		}
+		u, err := url.Parse(env.LDAP_URL)
+		if err != nil {
+			return nil, fmt.Errorf("LDAP_URL: %w", err)
+		}
+		tlsConfig = &tls.Config{RootCAs: roots, ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+
+	directory := ldapauth.New(ldapauth.Config{
+		URL:               env.LDAP_URL,
+		StartTLS:          env.LDAP_START_TLS,
+		TLSConfig:         tlsConfig,
+		BindDN:            env.LDAP_BIND_DN,
+		BindPassword:      cfg.Secrets.LDAP_BIND_PASSWORD.Reveal(),
+		BaseDN:            env.LDAP_BASE_DN,
+		UserFilter:        env.LDAP_USER_FILTER,
+		UsernameAttribute: env.LDAP_USERNAME_ATTRIBUTE,
+		EmailAttribute:    env.LDAP_EMAIL_ATTRIBUTE,
+		GroupAttribute:    env.LDAP_GROUP_ATTRIBUTE,
+		IDAttribute:       env.LDAP_ID_ATTRIBUTE,
+		GroupRoles:        groupRoles,
+		DefaultRole:       env.LDAP_DEFAULT_ROLE,
+		PoolSize:          env.LDAP_POOL_SIZE,
+		Timeout:           env.LDAP_TIMEOUT,
+	})
+
+	log.Println("✓ LDAP directory configured")
+	return directory, nil
+}
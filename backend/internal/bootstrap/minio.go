@@ -19,7 +19,7 @@ func InitializeMinio() (*minio.Client, error) {
 		return nil, fmt.Errorf("invalid minio endpoint")
 	}
 	minioClient, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.Secrets.MINIO_ROOT_USER, cfg.Secrets.MINIO_ROOT_PASSWORD, ""),
+		Creds:  credentials.New(&reloadableMinioCredentials{}),
 		Secure: cfg.Env.MINIO_USE_SSL,
 	})
 
@@ -46,3 +46,24 @@ func InitializeMinio() (*minio.Client, error) {
 
 	return nil, fmt.Errorf("MinIO initialization failed after %d attempts", maxRetry)
 }
+
+// reloadableMinioCredentials reads the credentials from the current config on every request,
+// so reloaded secrets take effect without recreating the client
+type reloadableMinioCredentials struct{}
+
+func (p *reloadableMinioCredentials) Retrieve() (credentials.Value, error) {
+	secrets := config.GetConfig().Secrets
+	return credentials.Value{
+		AccessKeyID:     secrets.MINIO_ROOT_USER.Reveal(),
+		SecretAccessKey: secrets.MINIO_ROOT_PASSWORD.Reveal(),
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+func (p *reloadableMinioCredentials) RetrieveWithCredContext(_ *credentials.CredContext) (credentials.Value, error) {
+	return p.Retrieve()
+}
+
+func (p *reloadableMinioCredentials) IsExpired() bool {
+	return true
+}
@@ -0,0 +1,59 @@
+package bootstrap
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+
+	"go-backend/internal/config"
+	"go-backend/internal/notify"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InitializeNotifications returns the outbox notifications are queued in, sent over SMTP or
+// written to NOTIFY_FILE_DIR
+func InitializeNotifications(redisClient *redis.Client) (*notify.Outbox, error) {
+	cfg := config.GetConfig()
+	env := cfg.Env
+
+	if _, err := mail.ParseAddress(env.NOTIFY_FROM); err != nil {
+		return nil, fmt.Errorf("NOTIFY_FROM: %w", err)
+	}
+
+	templates, err := notify.LoadTemplates(env.NOTIFY_DEFAULT_LOCALE)
+	if err != nil {
+		return nil, err
+	}
+
+	var sender notify.Sender
+	switch env.NOTIFY_SINK {
+	case "smtp":
+		if env.SMTP_HOST == "" {
+			return nil, fmt.Errorf("NOTIFY_SINK=smtp needs SMTP_HOST")
+		}
+		sender = notify.NewSMTPSender(notify.SMTPConfig{
+			Host:     env.SMTP_HOST,
+			Port:     env.SMTP_PORT,
+			Username: env.SMTP_USERNAME,
+			Password: cfg.Secrets.SMTP_PASSWORD.Reveal(),
+			From:     env.NOTIFY_FROM,
+			Security: env.SMTP_SECURITY,
+			Timeout:  env.SMTP_TIMEOUT,
+		})
+		log.Printf("✓ Notifications sent through %s:%d", env.SMTP_HOST, env.SMTP_PORT)
+	default:
+		sender, err = notify.NewFileSender(env.NOTIFY_FILE_DIR, env.NOTIFY_FROM)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("✓ Notifications written to %s", env.NOTIFY_FILE_DIR)
+	}
+
+	return notify.NewOutbox(redisClient, templates, sender, notify.RetryPolicy{
+		MaxAttempts: env.NOTIFY_MAX_ATTEMPTS,
+		BaseDelay:   env.NOTIFY_RETRY_BASE,
+		MaxDelay:    env.NOTIFY_RETRY_MAX,
+		Lease:       env.NOTIFY_LEASE,
+	}), nil
+}
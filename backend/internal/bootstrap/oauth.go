@@ -0,0 +1,41 @@
+package bootstrap
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/oauth"
+)
+
+// InitializeOAuth loads the client registry and ID token signing key of the authorization
+// server, it returns nils when OAUTH_CLIENTS_FILE is not set
+func InitializeOAuth(secretChain *config.SecretChain) (*oauth.Registry, *oauth.Signer, error) {
+	cfg := config.GetConfig()
+
+	if cfg.Env.OAUTH_CLIENTS_FILE == "" {
+		log.Println("OAuth authorization server not configured, skipping")
+		return nil, nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clients, err := oauth.LoadRegistry(ctx, cfg.Env.OAUTH_CLIENTS_FILE, secretChain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signingKey := cfg.Secrets.OAUTH_SIGNING_KEY.Reveal()
+	if signingKey == "" {
+		log.Println("oauth_signing_key is not set, ID tokens are signed with a key generated for this process")
+	}
+	signer, err := oauth.NewSigner(signingKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Println("✓ OAuth authorization server initialized")
+	return clients, signer, nil
+}
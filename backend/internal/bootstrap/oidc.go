@@ -0,0 +1,62 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/oidc"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InitializeOIDC discovers the providers listed in OIDC_PROVIDERS_FILE and returns nil when
+// OIDC login is not configured. A provider whose discovery fails is skipped so an outage at
+// one identity provider does not keep the API from starting.
+func InitializeOIDC(redisClient *redis.Client, secretChain *config.SecretChain) (*oidc.RelyingParty, error) {
+	env := config.GetConfig().Env
+
+	if env.OIDC_PROVIDERS_FILE == "" {
+		log.Println("OIDC login not configured, skipping")
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(env.OIDC_PROVIDERS_FILE)
+	if err != nil {
+		return nil, err
+	}
+	var configs []oidc.ProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("oidc providers %s: %w", env.OIDC_PROVIDERS_FILE, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var providers []*oidc.Provider
+	for _, cfg := range configs {
+		if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("oidc providers %s: name, issuer and clientId are required", env.OIDC_PROVIDERS_FILE)
+		}
+
+		// public clients relying on PKCE alone have no secret
+		secret, _, err := secretChain.Lookup(ctx, "oidc_"+cfg.Name+"_client_secret")
+		if err != nil {
+			return nil, err
+		}
+
+		provider, err := oidc.NewProvider(ctx, cfg, secret, fmt.Sprintf("%s/%s/callback", env.OIDC_REDIRECT_URL, cfg.Name))
+		if err != nil {
+			log.Printf("Skipping %v", err)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+
+	log.Printf("✓ OIDC login initialized with %d provider(s)", len(providers))
+	return oidc.NewRelyingParty(oidc.NewRedisStateStore(redisClient), providers...), nil
+}
@@ -0,0 +1,57 @@
+package bootstrap
+
+import (
+	"log"
+
+	"go-backend/internal/config"
+	"go-backend/internal/password"
+)
+
+// InitializePasswordHasher returns the hasher for new passwords, existing hashes are upgraded
+// to it on login
+func InitializePasswordHasher() password.Hasher {
+	env := config.GetConfig().Env
+
+	return password.Hasher{
+		Algorithm:  env.PASSWORD_HASH_ALGORITHM,
+		BcryptCost: env.PASSWORD_BCRYPT_COST,
+		Argon2: password.Argon2Params{
+			Memory:      uint32(env.PASSWORD_ARGON2_MEMORY),
+			Iterations:  uint32(env.PASSWORD_ARGON2_ITERATIONS),
+			Parallelism: uint8(env.PASSWORD_ARGON2_PARALLELISM),
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+}
+
+// InitializePasswordPolicy builds the policy new passwords are checked against
+func InitializePasswordPolicy() (password.Policy, error) {
+	env := config.GetConfig().Env
+
+	policy := password.Policy{
+		MinLength:        env.PASSWORD_MIN_LENGTH,
+		MaxLength:        env.PASSWORD_MAX_LENGTH,
+		RequiredClasses:  env.PASSWORD_REQUIRED_CLASSES,
+		DisallowUserInfo: env.PASSWORD_DISALLOW_USER_INFO,
+		HistorySize:      env.PASSWORD_HISTORY_SIZE,
+	}
+	// a character may take up to 4 bytes, a max length within the characters is not enough
+	if env.PASSWORD_HASH_ALGORITHM == password.AlgorithmBcrypt {
+		policy.MaxBytes = password.BcryptMaxBytes
+	}
+
+	if env.PASSWORD_BREACH_DATASET == "" {
+		log.Println("Breached password dataset not configured, skipping the check")
+		return policy, nil
+	}
+
+	breached, err := password.OpenBreachList(env.PASSWORD_BREACH_DATASET)
+	if err != nil {
+		return password.Policy{}, err
+	}
+	policy.Breached = breached
+
+	log.Println("✓ Breached password dataset loaded")
+	return policy, nil
+}
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"go-backend/internal/config"
 	"log"
-	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -14,25 +14,34 @@ import (
 func InitializeRedis() (*redis.Client, error) {
 	cfg := config.GetConfig()
 
-	dbParsed, err := strconv.Atoi(cfg.Env.REDIS_DB)
-	if err != nil {
-		return nil, err
-	}
-
 	endpoint := fmt.Sprintf("%s:%s", cfg.Env.REDIS_HOST, cfg.Env.REDIS_PORT)
 	if endpoint == ":" {
 		return nil, fmt.Errorf("invalid redis endpoint")
 	}
+	// credentials are resolved per connection from the last password Redis accepted, so a
+	// reloaded password is used by every new connection once it is known to work
+	var password atomic.Pointer[string]
+	initial := cfg.Secrets.REDIS_PASSWORD.Reveal()
+	password.Store(&initial)
+
 	redisClient := redis.NewClient(&redis.Options{
-		Addr:     endpoint,
-		Password: cfg.Secrets.REDIS_PASSWORD,
-		DB:       dbParsed,
+		Addr: endpoint,
+		CredentialsProvider: func() (string, string) {
+			return "", *password.Load()
+		},
+		DB:              cfg.Env.REDIS_DB,
+		ConnMaxLifetime: 30 * time.Minute,
+	})
+	config.OnSecretsChange(func(old, new config.SecretsConfig) {
+		if old.REDIS_PASSWORD != new.REDIS_PASSWORD {
+			reconnectRedis(redisClient, endpoint, cfg.Env.REDIS_DB, new.REDIS_PASSWORD.Reveal(), &password)
+		}
 	})
 
 	maxRetry := cfg.Env.INIT_MAX_RETRY
 
 	for attempt := 1; attempt <= maxRetry; attempt++ {
-		err = verifyRedis(redisClient)
+		err := verifyRedis(redisClient)
 
 		if err == nil {
 			log.Println("✓ Redis client initialized successfully")
@@ -46,6 +55,26 @@ func InitializeRedis() (*redis.Client, error) {
 	return nil, fmt.Errorf("Redis initialization failed after %d attempts", maxRetry)
 }
 
+// reconnectRedis checks the new password on a fresh connection and only then makes it the one
+// new connections use. Pooled connections keep the session they authenticated with and are
+// replaced within ConnMaxLifetime.
+func reconnectRedis(client *redis.Client, endpoint string, db int, newPassword string, password *atomic.Pointer[string]) {
+	probe := redis.NewClient(&redis.Options{
+		Addr:     endpoint,
+		Password: newPassword,
+		DB:       db,
+	})
+	defer probe.Close()
+
+	if err := verifyRedis(probe); err != nil {
+		log.Printf("Redis rejected the reloaded password, keeping the previous one: %v", err)
+		return
+	}
+	password.Store(&newPassword)
+
+	log.Printf("✓ Redis password reloaded (%d pooled connections will be recycled)", client.PoolStats().TotalConns)
+}
+
 func verifyRedis(client *redis.Client) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
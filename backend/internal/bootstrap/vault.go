@@ -1,101 +1,93 @@
 package bootstrap
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"go-backend/internal/config"
+	"go-backend/internal/vault"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/hashicorp/vault/api"
 )
 
-func InitializeVault() (*api.Client, error) {
+// InitializeVault logs in to Vault when VAULT_HOST is set and returns nil otherwise
+func InitializeVault() (*api.Client, *vault.TokenManager, error) {
 	cfg := config.GetConfig()
 
+	if cfg.Env.VAULT_HOST == "" {
+		log.Println("Vault not configured, skipping")
+		return nil, nil, nil
+	}
+
 	apiConfig := api.DefaultConfig()
 	endpoint := fmt.Sprintf("%s:%s", cfg.Env.VAULT_HOST, cfg.Env.VAULT_PORT)
-	if endpoint == ":" {
-		return nil, fmt.Errorf("invalid vault endpoint")
+	if cfg.Env.VAULT_PORT == "" {
+		return nil, nil, fmt.Errorf("invalid vault endpoint")
 	}
 	apiConfig.Address = endpoint
 
+	if cfg.Env.VAULT_CACERT != "" || cfg.Env.VAULT_CLIENT_CERT != "" {
+		err := apiConfig.ConfigureTLS(&api.TLSConfig{
+			CACert:     cfg.Env.VAULT_CACERT,
+			ClientCert: cfg.Env.VAULT_CLIENT_CERT,
+			ClientKey:  cfg.Env.VAULT_CLIENT_KEY,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	client, err := api.NewClient(apiConfig)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	auth, err := vault.NewAuthMethod()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a static token cannot be replaced once it expires, every other method can log in again
+	var login vault.LoginFunc
+	if _, static := auth.(*vault.TokenAuth); !static {
+		login = func(ctx context.Context) (*api.Secret, error) {
+			return auth.Login(ctx, client)
+		}
 	}
 
 	maxRetry := cfg.Env.INIT_MAX_RETRY
 
 	for attempt := 1; attempt <= maxRetry; attempt++ {
-		var token string = cfg.Env.VAULT_TOKEN
-		err = nil
-
-		if !cfg.Env.VAULT_DEV_MODE {
-			token, err = LoginWithK8s(cfg.Env.VAULT_HOST, cfg.Env.VAULT_ROLE)
-		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		secret, err := auth.Login(ctx, client)
+		cancel()
 
 		if err != nil {
-			log.Printf("Vault login failed (%d/%d): %v", attempt, maxRetry, err)
+			log.Printf("Vault %s login failed (%d/%d): %v", auth.Name(), attempt, maxRetry, err)
 			time.Sleep(time.Duration(attempt) * time.Second)
 			continue
 		}
 
 		// set the token
-		client.SetToken(token)
+		client.SetToken(secret.Auth.ClientToken)
 
 		// verify the token
 		err = verifyVault(client)
 
 		if err == nil {
-			log.Println("✓ Vault client initialized successfully")
-			return client, nil
+			log.Printf("✓ Vault client initialized successfully (%s auth)", auth.Name())
+			return client, vault.NewTokenManager(client, secret, login), nil
 		}
 
 		log.Printf("Vault not ready (%d/%d): %v", attempt, maxRetry, err)
 		time.Sleep(time.Duration(attempt) * time.Second)
 	}
 
-	return nil, fmt.Errorf("vault initialization failed after %d attempts", maxRetry)
-}
-
-func LoginWithK8s(address string, role string) (string, error) {
-	jwt, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
-	if err != nil {
-		return "", err
-	}
-
-	data := map[string]interface{}{
-		"role": role,
-		"jwt":  string(jwt),
-	}
-
-	b, _ := json.Marshal(data)
-
-	resp, err := http.Post(
-		address+"/v1/auth/kubernetes/login",
-		"application/json",
-		bytes.NewBuffer(b),
-	)
-
-	if err != nil {
-		return "", err
-	}
-
-	defer resp.Body.Close()
-
-	var result struct {
-		Auth struct {
-			ClientToken string `json:"client_token"`
-		} `json:"auth"`
-	}
-
-	json.NewDecoder(resp.Body).Decode(&result)
-	return result.Auth.ClientToken, nil
+	return nil, nil, fmt.Errorf("vault initialization failed after %d attempts", maxRetry)
 }
 
 func verifyVault(client *api.Client) error {
@@ -105,3 +97,21 @@ func verifyVault(client *api.Client) error {
 
 	return err
 }
+
+// reloadSecretsOnSignal re-resolves the secrets whenever the process receives SIGHUP
+func reloadSecretsOnSignal(ctx context.Context, chain *config.SecretChain) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if _, err := config.ReloadSecrets(chain); err != nil {
+				log.Printf("Secrets reload on SIGHUP failed: %v", err)
+			}
+		}
+	}
+}
@@ -2,15 +2,9 @@ package config
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"go-backend/internal/shared"
 	"log"
-	"os"
-	"sync"
-
-	"github.com/hashicorp/vault/api"
-	"github.com/joho/godotenv"
+	"sync/atomic"
+	"time"
 )
 
 type Config struct {
@@ -18,144 +12,246 @@ type Config struct {
 	Secrets SecretsConfig
 }
 
+// EnvironmentConfig is loaded by loadEnvironment: `env` names the variable (or the flattened
+// config file key), `default` applies when no source sets it and `validate` lists its rules
 type EnvironmentConfig struct {
-	APP_ENV        string
-	INIT_MAX_RETRY int
-	// vault
-	VAULT_DEV_MODE bool
-	VAULT_HOST     string
-	VAULT_PORT     string
-	VAULT_TOKEN    string
-	VAULT_ROLE     string
+	APP_ENV        string `env:"APP_ENV" validate:"required,oneof=development test staging production"`
+	INIT_MAX_RETRY int    `env:"INIT_MAX_RETRY" default:"5" validate:"min=1"`
+	// vault, skipped when VAULT_HOST is empty
+	VAULT_DEV_MODE bool   `env:"VAULT_DEV_MODE"`
+	VAULT_HOST     string `env:"VAULT_HOST"`
+	VAULT_PORT     string `env:"VAULT_PORT" default:"8200"`
+	VAULT_TOKEN    Secret `env:"VAULT_TOKEN"`
+	VAULT_ROLE     string `env:"VAULT_ROLE"`
+	// vault auth method: token | kubernetes | approle | userpass | cert
+	VAULT_AUTH_METHOD               string `env:"VAULT_AUTH_METHOD" validate:"oneof=token kubernetes approle userpass cert"`
+	VAULT_AUTH_MOUNT                string `env:"VAULT_AUTH_MOUNT"`
+	VAULT_K8S_TOKEN_PATH            string `env:"VAULT_K8S_TOKEN_PATH"`
+	VAULT_APPROLE_ROLE_ID           string `env:"VAULT_APPROLE_ROLE_ID"`
+	VAULT_APPROLE_SECRET_ID         Secret `env:"VAULT_APPROLE_SECRET_ID"`
+	VAULT_APPROLE_SECRET_ID_WRAPPED bool   `env:"VAULT_APPROLE_SECRET_ID_WRAPPED"`
+	VAULT_USERNAME                  string `env:"VAULT_USERNAME"`
+	VAULT_PASSWORD                  Secret `env:"VAULT_PASSWORD"`
+	VAULT_CACERT                    string `env:"VAULT_CACERT"`
+	VAULT_CLIENT_CERT               string `env:"VAULT_CLIENT_CERT"`
+	VAULT_CLIENT_KEY                string `env:"VAULT_CLIENT_KEY"`
+	// secrets, providers in order of precedence
+	SECRET_PROVIDERS []string `env:"SECRET_PROVIDERS" default:"vault" validate:"required,oneof=vault env file encrypted-file"`
+	VAULT_KV_MOUNT   string   `env:"VAULT_KV_MOUNT" default:"secret"`
+	VAULT_KV_PATH    string   `env:"VAULT_KV_PATH" default:"fiber-app"`
+	SECRETS_DIR      string   `env:"SECRETS_DIR" default:"/var/run/secrets/fiber-app"`
+	SECRETS_FILE     string   `env:"SECRETS_FILE" default:"secrets.enc"`
+	// JSON file overriding where each provider looks up a secret
+	SECRETS_MAPPING string `env:"SECRETS_MAPPING"`
+	// interval between secret reloads, 0 disables polling
+	SECRETS_RELOAD_INTERVAL time.Duration `env:"SECRETS_RELOAD_INTERVAL" default:"5m" validate:"min=0"`
 	// redis
-	REDIS_HOST string
-	REDIS_PORT string
-	REDIS_DB   string
+	REDIS_HOST string `env:"REDIS_HOST" validate:"required"`
+	REDIS_PORT string `env:"REDIS_PORT" default:"6379"`
+	REDIS_DB   int    `env:"REDIS_DB" default:"0" validate:"min=0"`
 	// minio
-	MINIO_HOST    string
-	MINIO_PORT    string
-	MINIO_BUCKET  string
-	MINIO_USE_SSL bool
+	MINIO_HOST    string `env:"MINIO_HOST" validate:"required"`
+	MINIO_PORT    string `env:"MINIO_PORT" default:"9000"`
+	MINIO_BUCKET  string `env:"MINIO_BUCKET" validate:"required"`
+	MINIO_USE_SSL bool   `env:"MINIO_USE_SSL"`
+	// database, skipped when DB_HOST is empty
+	DB_HOST    string `env:"DB_HOST"`
+	DB_PORT    string `env:"DB_PORT" default:"5432"`
+	DB_NAME    string `env:"DB_NAME"`
+	DB_USER    string `env:"DB_USER"`
+	DB_SSLMODE string `env:"DB_SSLMODE" default:"disable" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+	// static uses DB_USER and the db_password secret, vault leases credentials from VAULT_DB_ROLE
+	DB_CREDENTIALS string `env:"DB_CREDENTIALS" default:"static" validate:"oneof=static vault"`
+	VAULT_DB_MOUNT string `env:"VAULT_DB_MOUNT"`
+	VAULT_DB_ROLE  string `env:"VAULT_DB_ROLE"`
+	// field encryption
+	TRANSIT_MOUNT string `env:"TRANSIT_MOUNT" default:"transit"`
+	TRANSIT_KEY   string `env:"TRANSIT_KEY" default:"fiber-app-pii"`
+	// interval between re-wrap runs moving ciphertexts to the latest key version, 0 disables
+	FIELD_REWRAP_INTERVAL time.Duration `env:"FIELD_REWRAP_INTERVAL" default:"1h" validate:"min=0"`
+	// auth timing policy, AUTH_ROLE_POLICIES overrides it per role: "admin=access_ttl:5m;idle_timeout:30m"
+	AUTH_ACCESS_TTL       time.Duration `env:"AUTH_ACCESS_TTL" default:"15m" validate:"min=1s"`
+	AUTH_REFRESH_TTL      time.Duration `env:"AUTH_REFRESH_TTL" default:"168h" validate:"min=1s"`
+	AUTH_IDLE_TIMEOUT     time.Duration `env:"AUTH_IDLE_TIMEOUT" default:"168h" validate:"min=0"`
+	AUTH_SESSION_LIFETIME time.Duration `env:"AUTH_SESSION_LIFETIME" default:"168h" validate:"min=1s"`
+	AUTH_AUTO_LOCK_AFTER  time.Duration `env:"AUTH_AUTO_LOCK_AFTER" default:"15m" validate:"min=0"`
+	AUTH_LOCK_TIMEOUT     time.Duration `env:"AUTH_LOCK_TIMEOUT" default:"10m" validate:"min=0"`
+	AUTH_ROLE_POLICIES    string        `env:"AUTH_ROLE_POLICIES"`
+	// password backends tried in order on login and unlock
+	AUTH_PASSWORD_BACKENDS []string `env:"AUTH_PASSWORD_BACKENDS" default:"local" validate:"min=1,oneof=local ldap"`
+	// policy for new passwords, the max counts characters. With bcrypt hashing passwords are also
+	// held to its 72 bytes.
+	PASSWORD_MIN_LENGTH         int      `env:"PASSWORD_MIN_LENGTH" default:"12" validate:"min=1"`
+	PASSWORD_MAX_LENGTH         int      `env:"PASSWORD_MAX_LENGTH" default:"64" validate:"min=1"`
+	PASSWORD_REQUIRED_CLASSES   []string `env:"PASSWORD_REQUIRED_CLASSES" default:"lower,upper,digit" validate:"oneof=upper lower digit symbol"`
+	PASSWORD_DISALLOW_USER_INFO bool     `env:"PASSWORD_DISALLOW_USER_INFO" default:"true"`
+	PASSWORD_HISTORY_SIZE       int      `env:"PASSWORD_HISTORY_SIZE" default:"5" validate:"min=0,max=24"`
+	// hashing of new passwords, weaker stored hashes are upgraded on the next login.
+	// Argon2 memory is in KiB, the defaults follow the OWASP minimum.
+	PASSWORD_HASH_ALGORITHM     string `env:"PASSWORD_HASH_ALGORITHM" default:"argon2id" validate:"oneof=bcrypt argon2id"`
+	PASSWORD_BCRYPT_COST        int    `env:"PASSWORD_BCRYPT_COST" default:"12" validate:"min=10,max=31"`
+	PASSWORD_ARGON2_MEMORY      int    `env:"PASSWORD_ARGON2_MEMORY" default:"19456" validate:"min=8192,max=4194304"`
+	PASSWORD_ARGON2_ITERATIONS  int    `env:"PASSWORD_ARGON2_ITERATIONS" default:"2" validate:"min=1,max=64"`
+	PASSWORD_ARGON2_PARALLELISM int    `env:"PASSWORD_ARGON2_PARALLELISM" default:"1" validate:"min=1,max=255"`
+	// directory of Pwned Passwords range files (<PREFIX> holding SUFFIX:COUNT lines), empty
+	// skips the breached-password check
+	PASSWORD_BREACH_DATASET string `env:"PASSWORD_BREACH_DATASET"`
+	// cookie transport, used when the login request asks for "transport": "cookie"
+	AUTH_COOKIE_DOMAIN   string `env:"AUTH_COOKIE_DOMAIN"`
+	AUTH_COOKIE_SECURE   bool   `env:"AUTH_COOKIE_SECURE" default:"true"`
+	AUTH_COOKIE_SAMESITE string `env:"AUTH_COOKIE_SAMESITE" default:"Strict" validate:"oneof=Strict Lax None"`
+	// LDAP / Active Directory password backend, the bind password is the secret
+	// ldap_bind_password. {username} in the filter is replaced by the escaped login name.
+	LDAP_URL                string `env:"LDAP_URL"`
+	LDAP_START_TLS          bool   `env:"LDAP_START_TLS" default:"false"`
+	LDAP_CA_CERT            string `env:"LDAP_CA_CERT"`
+	LDAP_BIND_DN            string `env:"LDAP_BIND_DN"`
+	LDAP_BASE_DN            string `env:"LDAP_BASE_DN"`
+	LDAP_USER_FILTER        string `env:"LDAP_USER_FILTER" default:"(&(objectClass=person)(uid={username}))"`
+	LDAP_USERNAME_ATTRIBUTE string `env:"LDAP_USERNAME_ATTRIBUTE" default:"uid"`
+	LDAP_EMAIL_ATTRIBUTE    string `env:"LDAP_EMAIL_ATTRIBUTE" default:"mail"`
+	LDAP_GROUP_ATTRIBUTE    string `env:"LDAP_GROUP_ATTRIBUTE" default:"memberOf"`
+	// immutable entry id user ids are derived from, objectGUID on AD, the DN when missing
+	LDAP_ID_ATTRIBUTE string `env:"LDAP_ID_ATTRIBUTE" default:"entryUUID"`
+	// "role=groupDN;role=groupDN", the first group the user is in decides the role
+	LDAP_GROUP_ROLES  string        `env:"LDAP_GROUP_ROLES"`
+	LDAP_DEFAULT_ROLE string        `env:"LDAP_DEFAULT_ROLE"`
+	LDAP_POOL_SIZE    int           `env:"LDAP_POOL_SIZE" default:"4" validate:"min=1,max=64"`
+	LDAP_TIMEOUT      time.Duration `env:"LDAP_TIMEOUT" default:"5s" validate:"min=1s"`
+	// longest lifetime a new API key may be given
+	API_KEY_MAX_TTL time.Duration `env:"API_KEY_MAX_TTL" default:"8760h" validate:"min=24h"`
+	// OIDC login, providers are a JSON list of {name, issuer, clientId, scopes} and each
+	// client secret is the secret oidc_<name>_client_secret
+	OIDC_PROVIDERS_FILE string `env:"OIDC_PROVIDERS_FILE"`
+	// callbacks are <OIDC_REDIRECT_URL>/<name>/callback
+	OIDC_REDIRECT_URL string `env:"OIDC_REDIRECT_URL" default:"http://localhost:8080/api/v1/auth/oidc"`
+	// the browser is sent here with ?code= (or ?error=) once the provider login completes
+	OIDC_FRONTEND_URL string `env:"OIDC_FRONTEND_URL" default:"http://localhost:5173/auth/oidc/callback"`
+	// OAuth authorization server, clients are a JSON list of {id, name, redirectUris, scopes,
+	// grantTypes, public, role} and confidential clients authenticate with oauth_<id>_client_secret.
+	// role (user or admin, default user) is what client_credentials tokens act as.
+	OAUTH_CLIENTS_FILE string `env:"OAUTH_CLIENTS_FILE"`
+	OAUTH_ISSUER       string `env:"OAUTH_ISSUER" default:"http://localhost:8080/api/v1/oauth"`
+	// the browser is sent here with ?request_id= to sign in and consent
+	OAUTH_CONSENT_URL string `env:"OAUTH_CONSENT_URL" default:"http://localhost:5173/oauth/consent"`
+	// quota
+	QUOTA_DEFAULT_BYTES      string        `env:"QUOTA_DEFAULT_BYTES" default:"100MB"`
+	QUOTA_DEFAULT_OBJECTS    int           `env:"QUOTA_DEFAULT_OBJECTS" default:"1000" validate:"min=0"`
+	QUOTA_ROLE_LIMITS        string        `env:"QUOTA_ROLE_LIMITS"`
+	QUOTA_USER_LIMITS        string        `env:"QUOTA_USER_LIMITS"`
+	QUOTA_RECONCILE_INTERVAL time.Duration `env:"QUOTA_RECONCILE_INTERVAL" default:"1h" validate:"min=0"`
+	// upload scanning
+	SCANNER       string        `env:"SCANNER" default:"stub" validate:"oneof=stub clamd"`
+	SCAN_WORKERS  int           `env:"SCAN_WORKERS" default:"2" validate:"min=1,max=64"`
+	CLAMD_ADDRESS string        `env:"CLAMD_ADDRESS" default:"localhost:3310"`
+	CLAMD_TIMEOUT time.Duration `env:"CLAMD_TIMEOUT" default:"30s" validate:"min=1s"`
+	// a job not scanned within this time is handed to another worker
+	SCAN_LEASE time.Duration `env:"SCAN_LEASE" default:"5m" validate:"min=10s"`
+	// notifications, the file sink writes .eml files for development instead of sending
+	NOTIFY_SINK           string        `env:"NOTIFY_SINK" default:"file" validate:"oneof=smtp file"`
+	NOTIFY_FILE_DIR       string        `env:"NOTIFY_FILE_DIR" default:"./mail"`
+	NOTIFY_FROM           string        `env:"NOTIFY_FROM" default:"Go Backend <no-reply@localhost>"`
+	NOTIFY_DEFAULT_LOCALE string        `env:"NOTIFY_DEFAULT_LOCALE" default:"en"`
+	NOTIFY_WORKERS        int           `env:"NOTIFY_WORKERS" default:"2" validate:"min=1,max=64"`
+	NOTIFY_MAX_ATTEMPTS   int           `env:"NOTIFY_MAX_ATTEMPTS" default:"8" validate:"min=1"`
+	NOTIFY_RETRY_BASE     time.Duration `env:"NOTIFY_RETRY_BASE" default:"30s" validate:"min=1s"`
+	NOTIFY_RETRY_MAX      time.Duration `env:"NOTIFY_RETRY_MAX" default:"1h" validate:"min=1s"`
+	// a message not sent within this time is handed to another worker
+	NOTIFY_LEASE time.Duration `env:"NOTIFY_LEASE" default:"2m" validate:"min=10s"`
+	// SMTP relay, the password is the secret smtp_password
+	SMTP_HOST     string        `env:"SMTP_HOST"`
+	SMTP_PORT     int           `env:"SMTP_PORT" default:"587" validate:"min=1,max=65535"`
+	SMTP_USERNAME string        `env:"SMTP_USERNAME"`
+	SMTP_SECURITY string        `env:"SMTP_SECURITY" default:"starttls" validate:"oneof=starttls tls none"`
+	SMTP_TIMEOUT  time.Duration `env:"SMTP_TIMEOUT" default:"30s" validate:"min=1s"`
 }
 
+// SecretsConfig fields are resolved through the SecretChain by their `secret` key
 type SecretsConfig struct {
-	JWT_SECRET  string
-	DB_PASSWORD string
+	JWT_SECRET  Secret `secret:"jwt_secret"`
+	DB_PASSWORD Secret `secret:"db_password,optional"`
 
 	// redis
-	REDIS_PASSWORD string
+	REDIS_PASSWORD Secret `secret:"redis_password,optional"`
+
+	// service account searching the LDAP directory
+	LDAP_BIND_PASSWORD Secret `secret:"ldap_bind_password,optional"`
+
+	// SMTP relay login, only used with SMTP_USERNAME
+	SMTP_PASSWORD Secret `secret:"smtp_password,optional"`
+
+	// PEM RSA key signing OAuth ID tokens, generated at startup when unset
+	OAUTH_SIGNING_KEY Secret `secret:"oauth_signing_key,optional"`
 
 	// minio
-	MINIO_ROOT_USER     string
-	MINIO_ROOT_PASSWORD string
+	MINIO_ROOT_USER     Secret `secret:"minio_root_user"`
+	MINIO_ROOT_PASSWORD Secret `secret:"minio_root_password"`
+
+	// local field encryption key (base64, 32 bytes), only used without Vault transit
+	FIELD_ENCRYPTION_KEY Secret `secret:"field_encryption_key,optional"`
 }
 
-var (
-	cfg  *Config
-	once sync.Once
-)
+// cfg is replaced as a whole on every change, so a *Config returned by GetConfig
+// is an immutable snapshot that never mixes old and new secrets
+var cfg atomic.Pointer[Config]
 
 func InitConfig() {
-	if cfg == nil {
-		cfg = &Config{}
-	}
+	cfg.CompareAndSwap(nil, &Config{})
 }
 
 func GetConfig() *Config {
-	return cfg
+	return cfg.Load()
 }
 
-func LoadEnv() {
-	// Load .env file
-	if err := godotenv.Load(); err != nil {
-		log.Printf("No .env file found: %v", err)
-	}
-
-	APP_ENV := os.Getenv("APP_ENV")
-
-	if APP_ENV != "production" {
-		log.Printf("Warning: Application is running in %s mode (non-production)", APP_ENV)
-	}
-
-	cfg.Env = EnvironmentConfig{
-		APP_ENV:        APP_ENV,
-		INIT_MAX_RETRY: shared.StringToIntWithDefault(os.Getenv("INIT_MAX_RETRY"), 5),
-		VAULT_DEV_MODE: os.Getenv("VAULT_DEV_MODE") == "true",
-		VAULT_HOST:     os.Getenv("VAULT_HOST"),
-		VAULT_PORT:     os.Getenv("VAULT_PORT"),
-		VAULT_TOKEN:    os.Getenv("VAULT_TOKEN"),
-		VAULT_ROLE:     os.Getenv("VAULT_ROLE"),
-		REDIS_HOST:     os.Getenv("REDIS_HOST"),
-		REDIS_PORT:     os.Getenv("REDIS_PORT"),
-		REDIS_DB:       os.Getenv("REDIS_DB"),
-		MINIO_HOST:     os.Getenv("MINIO_HOST"),
-		MINIO_PORT:     os.Getenv("MINIO_PORT"),
-		MINIO_BUCKET:   os.Getenv("MINIO_BUCKET"),
-		MINIO_USE_SSL:  os.Getenv("MINIO_USE_SSL") == "true",
-	}
-
-	log.Println("✓ Environment variables loaded successfully")
-	if cfg.Env.APP_ENV != "production" {
-		envJson, _ := json.MarshalIndent(cfg.Env, "", "  ")
-		fmt.Printf("Loaded Environment Config: %s\n", envJson)
+func update(fn func(next *Config)) {
+	for {
+		current := cfg.Load()
+		next := *current
+		fn(&next)
+		if cfg.CompareAndSwap(current, &next) {
+			return
+		}
 	}
 }
 
-func LoadSecrets(client *api.Client) error {
-	var err error
-
-	jwt, err := getKV(client, "secret", "fiber-app", "jwt_secret")
+// LoadEnv loads and validates the environment config. The returned settings record the
+// source of every variable.
+func LoadEnv() ([]Setting, error) {
+	env, settings, err := loadEnvironment()
 	if err != nil {
-		return err
+		return settings, err
 	}
 
-	dbPassword, err := getKV(client, "secret", "fiber-app", "db_password")
-	if err != nil {
-		return err
+	if env.APP_ENV != "production" {
+		log.Printf("Warning: Application is running in %s mode (non-production)", env.APP_ENV)
 	}
 
-	redisPassword, err := getKV(client, "secret", "fiber-app", "redis_password")
-	if err != nil {
-		return err
-	}
+	update(func(next *Config) {
+		next.Env = env
+	})
+	recordSources(&envSources, settings)
 
-	minioRootUser, err := getKV(client, "secret", "fiber-app", "minio_root_user")
-	if err != nil {
-		return err
-	}
+	log.Println("✓ Environment variables loaded successfully")
+	return settings, nil
+}
+
+// LoadSecrets resolves the secrets for the first time. Values are never logged, the
+// admin /debug/config endpoint shows where each one came from.
+func LoadSecrets(chain *SecretChain) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	minioRootPassword, err := getKV(client, "secret", "fiber-app", "minio_root_password")
+	secrets, settings, err := chain.Resolve(ctx)
 	if err != nil {
 		return err
 	}
 
-	cfg.Secrets = SecretsConfig{
-		JWT_SECRET:          jwt,
-		DB_PASSWORD:         dbPassword,
-		REDIS_PASSWORD:      redisPassword,
-		MINIO_ROOT_USER:     minioRootUser,
-		MINIO_ROOT_PASSWORD: minioRootPassword,
-	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
 
-	log.Println("✓ Secrets loaded from Vault successfully")
-	if cfg.Env.APP_ENV != "production" {
-		secretJson, _ := json.MarshalIndent(cfg.Secrets, "", "  ")
-		fmt.Printf("Loaded Secrets: %s\n", secretJson)
-	}
+	swapSecrets(secrets)
+	recordSources(&secretSources, settings)
 
+	log.Printf("✓ Secrets loaded successfully (%s)", chain.names())
 	return nil
 }
-
-func getKV(client *api.Client, mount, path, key string) (string, error) {
-	secret, err := client.KVv2(mount).Get(context.Background(), path)
-	if err != nil {
-		return "", err
-	}
-
-	val, ok := secret.Data[key]
-	if !ok {
-		return "", fmt.Errorf("getKV key %s not found", key)
-	}
-
-	return fmt.Sprintf("%v", val), nil
-}
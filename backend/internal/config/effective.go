@@ -0,0 +1,67 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	sourcesMu     sync.RWMutex
+	envSources    map[string]string
+	secretSources map[string]string
+)
+
+// Entry is one effective setting, safe to display: secret values are redacted
+type Entry struct {
+	Name   string      `json:"name"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+func recordSources(target *map[string]string, settings []Setting) {
+	sources := make(map[string]string, len(settings))
+	for _, setting := range settings {
+		sources[setting.Name] = setting.Source
+	}
+
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	*target = sources
+}
+
+// Effective lists the current environment config and secrets with the source of each value
+func Effective() (env []Entry, secrets []Entry) {
+	current := GetConfig()
+
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	v := reflect.ValueOf(current.Env)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		var value interface{} = v.Field(i).Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		env = append(env, Entry{Name: name, Value: value, Source: envSources[name]})
+	}
+
+	v = reflect.ValueOf(current.Secrets)
+	for i := 0; i < v.NumField(); i++ {
+		key, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("secret"), ",")
+		if key == "" {
+			continue
+		}
+
+		// every secrets field is a Secret, so the value is redacted when serialised
+		secrets = append(secrets, Entry{Name: key, Value: v.Field(i).Interface(), Source: secretSources[key]})
+	}
+
+	return env, secrets
+}
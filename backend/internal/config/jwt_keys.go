@@ -0,0 +1,111 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type jwtKey struct {
+	id        string
+	secret    []byte
+	retiredAt time.Time
+}
+
+var (
+	jwtKeysMu sync.RWMutex
+	// jwtKeys[0] is the active signing key, the rest are retired verification-only keys
+	jwtKeys []jwtKey
+	// retired keys stay valid for verification as long as the longest lived token signed with
+	// them, the default refresh TTL until SetJWTKeyRetention is told the real one
+	jwtKeyRetention = 7 * 24 * time.Hour
+)
+
+var ErrUnknownJWTKey = errors.New("unknown jwt signing key")
+
+func addJWTKey(secret string) {
+	id := jwtKeyID(secret)
+	now := time.Now()
+
+	jwtKeysMu.Lock()
+	defer jwtKeysMu.Unlock()
+
+	if len(jwtKeys) > 0 && jwtKeys[0].id == id {
+		return
+	}
+
+	keys := []jwtKey{{id: id, secret: []byte(secret)}}
+	for _, key := range jwtKeys {
+		if key.id == id {
+			continue
+		}
+		if key.retiredAt.IsZero() {
+			key.retiredAt = now
+		}
+		if now.Sub(key.retiredAt) < jwtKeyRetention {
+			keys = append(keys, key)
+		}
+	}
+	jwtKeys = keys
+}
+
+// SetJWTKeyRetention sets how long retired keys verify tokens, it must cover the longest TTL of
+// any token the service signs
+func SetJWTKeyRetention(retention time.Duration) {
+	jwtKeysMu.Lock()
+	defer jwtKeysMu.Unlock()
+	jwtKeyRetention = retention
+}
+
+// SignJWT signs claims with the active key and records its id in the kid header
+func SignJWT(claims jwt.Claims) (string, error) {
+	jwtKeysMu.RLock()
+	if len(jwtKeys) == 0 {
+		jwtKeysMu.RUnlock()
+		return "", ErrUnknownJWTKey
+	}
+	key := jwtKeys[0]
+	jwtKeysMu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.secret)
+}
+
+// JWTKeyFunc resolves the verification key from the kid header, accepting retired keys
+// within their retention. Tokens without a kid predate key rotation and use the active key.
+func JWTKeyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	jwtKeysMu.RLock()
+	defer jwtKeysMu.RUnlock()
+
+	if len(jwtKeys) == 0 {
+		return nil, ErrUnknownJWTKey
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return jwtKeys[0].secret, nil
+	}
+
+	for _, key := range jwtKeys {
+		if key.id == kid && (key.retiredAt.IsZero() || time.Since(key.retiredAt) < jwtKeyRetention) {
+			return key.secret, nil
+		}
+	}
+
+	return nil, ErrUnknownJWTKey
+}
+
+func jwtKeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
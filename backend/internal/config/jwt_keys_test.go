@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWTKeyRotation(t *testing.T) {
+	jwtKeys = nil
+	t.Cleanup(func() { jwtKeys = nil })
+
+	claims := func() jwt.Claims {
+		return jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+	}
+
+	addJWTKey("old-secret")
+	oldToken, err := SignJWT(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addJWTKey("new-secret")
+	newToken, err := SignJWT(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	legacyToken, _ := legacy.SignedString([]byte("new-secret"))
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	forged.Header["kid"] = jwtKeyID("attacker-secret")
+	forgedToken, _ := forged.SignedString([]byte("attacker-secret"))
+
+	tests := []struct {
+		name      string
+		token     string
+		wantValid bool
+	}{
+		{name: "Token signed with active key", token: newToken, wantValid: true},
+		{name: "Token signed with retired key", token: oldToken, wantValid: true},
+		{name: "Token without kid uses active key", token: legacyToken, wantValid: true},
+		{name: "Token with unknown kid", token: forgedToken, wantValid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.Parse(tt.token, JWTKeyFunc)
+			valid := err == nil && token.Valid
+			if valid != tt.wantValid {
+				t.Errorf("Parse() valid = %v, want %v (err %v)", valid, tt.wantValid, err)
+			}
+		})
+	}
+
+	// retired keys are dropped once their retention has passed
+	jwtKeys[1].retiredAt = time.Now().Add(-jwtKeyRetention - time.Second)
+	if _, err := jwt.Parse(oldToken, JWTKeyFunc); err == nil {
+		t.Errorf("Parse() accepted a token signed with an expired key")
+	}
+}
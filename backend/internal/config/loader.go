@@ -0,0 +1,314 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"go.yaml.in/yaml/v3"
+)
+
+// configFiles are looked up in the working directory when CONFIG_FILE is not set
+var configFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
+// Setting is where the effective value of a variable came from
+type Setting struct {
+	Name   string
+	Source string
+}
+
+// layer is one configuration source, keyed by variable name
+type layer struct {
+	name   string
+	values map[string]string
+}
+
+// loadEnvironment resolves EnvironmentConfig from, in increasing precedence, the `default`
+// tags, the config file, its APP_ENV overlay, .env and the process environment. Every
+// variable is checked against its `validate` tag and all errors are returned together.
+func loadEnvironment() (EnvironmentConfig, []Setting, error) {
+	processEnv := map[string]string{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		processEnv[name] = value
+	}
+
+	dotenv, err := godotenv.Read()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return EnvironmentConfig{}, nil, fmt.Errorf(".env: %w", err)
+	}
+	// .env is still exported for code reading the environment directly, e.g. the env secret provider
+	for name, value := range dotenv {
+		if _, ok := processEnv[name]; !ok {
+			os.Setenv(name, value)
+		}
+	}
+
+	layers, err := fileLayers()
+	if err != nil {
+		return EnvironmentConfig{}, nil, err
+	}
+	layers = append(layers, layer{name: ".env", values: dotenv}, layer{name: "env", values: processEnv})
+
+	return decodeEnvironment(layers)
+}
+
+func fileLayers() ([]layer, error) {
+	base := os.Getenv("CONFIG_FILE")
+	if base == "" {
+		for _, name := range configFiles {
+			if _, err := os.Stat(name); err == nil {
+				base = name
+				break
+			}
+		}
+	}
+	if base == "" {
+		return nil, nil
+	}
+
+	values, err := readConfigFile(base)
+	if err != nil {
+		return nil, err
+	}
+	layers := []layer{{name: base, values: values}}
+
+	appEnv := os.Getenv("APP_ENV")
+	if appEnv == "" {
+		appEnv = values["APP_ENV"]
+	}
+	if appEnv == "" {
+		return layers, nil
+	}
+
+	ext := filepath.Ext(base)
+	overlay := strings.TrimSuffix(base, ext) + "." + appEnv + ext
+	if _, err := os.Stat(overlay); err != nil {
+		return layers, nil
+	}
+
+	values, err = readConfigFile(overlay)
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, layer{name: overlay, values: values}), nil
+}
+
+// readConfigFile flattens a YAML or TOML document into variable names, so both
+// `redis_host: x` and `redis: {host: x}` set REDIS_HOST
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file format", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	flatten("", doc, values)
+	return values, nil
+}
+
+func flatten(prefix string, node map[string]interface{}, out map[string]string) {
+	for key, value := range node {
+		name := strings.ToUpper(key)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(name, v, out)
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[name] = strings.Join(items, ",")
+		case nil:
+			out[name] = ""
+		default:
+			out[name] = fmt.Sprint(v)
+		}
+	}
+}
+
+// decodeEnvironment takes each variable from the last layer setting it to a non-empty value
+func decodeEnvironment(layers []layer) (EnvironmentConfig, []Setting, error) {
+	var env EnvironmentConfig
+	var settings []Setting
+	var errs []error
+
+	v := reflect.ValueOf(&env).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+
+		raw, source := field.Tag.Get("default"), "default"
+		for _, l := range layers {
+			if value := l.values[name]; value != "" {
+				raw, source = value, l.name
+			}
+		}
+		settings = append(settings, Setting{Name: name, Source: source})
+
+		if err := setField(v.Field(i), raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if err := validateField(v.Field(i), raw, field.Tag.Get("validate")); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return env, settings, errors.Join(errs...)
+}
+
+func setField(field reflect.Value, raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	switch field.Interface().(type) {
+	case string, Secret:
+		field.SetString(raw)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		field.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		field.SetBool(b)
+	case time.Duration:
+		d, err := ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+// ParseDuration accepts Go durations ("90s", "5m") and bare numbers as seconds
+func ParseDuration(raw string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration", raw)
+	}
+	return d, nil
+}
+
+// validateField applies comma separated rules: required, min=N, max=N and oneof=a b c.
+// min/max compare numbers and durations by value, and lists and strings by length.
+// Rules other than required are skipped for unset values.
+func validateField(field reflect.Value, raw, rules string) error {
+	if rules == "" {
+		return nil
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		if name == "required" {
+			if raw == "" {
+				return errors.New("is required")
+			}
+			continue
+		}
+		if raw == "" {
+			continue
+		}
+
+		switch name {
+		case "min", "max":
+			limit, err := parseLimit(field, arg)
+			if err != nil {
+				return fmt.Errorf("invalid %s rule: %w", name, err)
+			}
+
+			value := measure(field)
+			if name == "min" && value < limit {
+				return fmt.Errorf("must be at least %s", arg)
+			}
+			if name == "max" && value > limit {
+				return fmt.Errorf("must be at most %s", arg)
+			}
+		case "oneof":
+			allowed := strings.Fields(arg)
+			values := []string{raw}
+			if list, ok := field.Interface().([]string); ok {
+				values = list
+			}
+			for _, value := range values {
+				if !slices.Contains(allowed, value) {
+					return fmt.Errorf("%q must be one of %s", value, strings.Join(allowed, ", "))
+				}
+			}
+		default:
+			return fmt.Errorf("unknown validation rule %q", name)
+		}
+	}
+
+	return nil
+}
+
+func parseLimit(field reflect.Value, arg string) (int64, error) {
+	if _, ok := field.Interface().(time.Duration); ok {
+		d, err := ParseDuration(arg)
+		return int64(d), err
+	}
+	return strconv.ParseInt(arg, 10, 64)
+}
+
+func measure(field reflect.Value) int64 {
+	switch field.Kind() {
+	case reflect.String, reflect.Slice:
+		return int64(field.Len())
+	default:
+		return field.Int()
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"config.yaml": "app_env: staging\nredis:\n  host: redis.internal\n  db: 2\nsecret_providers: [env, vault]\n",
+		"config.toml": "app_env = \"staging\"\nsecret_providers = [\"env\", \"vault\"]\n[redis]\nhost = \"redis.internal\"\ndb = 2\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			os.WriteFile(path, []byte(content), 0o600)
+
+			values, err := readConfigFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]string{
+				"APP_ENV":          "staging",
+				"REDIS_HOST":       "redis.internal",
+				"REDIS_DB":         "2",
+				"SECRET_PROVIDERS": "env,vault",
+			}
+			for key, value := range want {
+				if values[key] != value {
+					t.Errorf("readConfigFile() %s = %q, want %q", key, values[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeEnvironment(t *testing.T) {
+	required := map[string]string{
+		"APP_ENV":      "production",
+		"REDIS_HOST":   "localhost",
+		"MINIO_HOST":   "localhost",
+		"MINIO_BUCKET": "bucket",
+	}
+
+	t.Run("Later layers win and defaults fill the rest", func(t *testing.T) {
+		env, settings, err := decodeEnvironment([]layer{
+			{name: "config.yaml", values: required},
+			{name: "config.production.yaml", values: map[string]string{"SCAN_WORKERS": "8", "REDIS_DB": "3"}},
+			{name: ".env", values: map[string]string{"SCAN_WORKERS": "4", "SECRETS_RELOAD_INTERVAL": "90"}},
+			{name: "env", values: map[string]string{"SCAN_WORKERS": "6", "CLAMD_TIMEOUT": "", "SECRET_PROVIDERS": "env, vault"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if env.SCAN_WORKERS != 6 || env.REDIS_DB != 3 {
+			t.Errorf("decodeEnvironment() SCAN_WORKERS = %d, REDIS_DB = %d, want 6, 3", env.SCAN_WORKERS, env.REDIS_DB)
+		}
+		if env.SECRETS_RELOAD_INTERVAL != 90*time.Second || env.CLAMD_TIMEOUT != 30*time.Second {
+			t.Errorf("decodeEnvironment() durations = %v, %v", env.SECRETS_RELOAD_INTERVAL, env.CLAMD_TIMEOUT)
+		}
+		if !slices.Equal(env.SECRET_PROVIDERS, []string{"env", "vault"}) {
+			t.Errorf("decodeEnvironment() SECRET_PROVIDERS = %v", env.SECRET_PROVIDERS)
+		}
+
+		sources := map[string]string{}
+		for _, setting := range settings {
+			sources[setting.Name] = setting.Source
+		}
+		for name, source := range map[string]string{
+			"SCAN_WORKERS":            "env",
+			"REDIS_DB":                "config.production.yaml",
+			"SECRETS_RELOAD_INTERVAL": ".env",
+			"CLAMD_TIMEOUT":           "default",
+		} {
+			if sources[name] != source {
+				t.Errorf("decodeEnvironment() source of %s = %q, want %q", name, sources[name], source)
+			}
+		}
+	})
+
+	t.Run("All errors are reported together", func(t *testing.T) {
+		_, _, err := decodeEnvironment([]layer{{name: "env", values: map[string]string{
+			"APP_ENV":                 "prod",
+			"REDIS_DB":                "zero",
+			"SCAN_WORKERS":            "0",
+			"CLAMD_TIMEOUT":           "500ms",
+			"SECRETS_RELOAD_INTERVAL": "soon",
+			"SECRET_PROVIDERS":        "vault,consul",
+		}}})
+		if err == nil {
+			t.Fatal("decodeEnvironment() error = nil")
+		}
+
+		for _, want := range []string{
+			`APP_ENV: "prod" must be one of`,
+			`REDIS_DB: "zero" is not an integer`,
+			"SCAN_WORKERS: must be at least 1",
+			"CLAMD_TIMEOUT: must be at least 1s",
+			`SECRETS_RELOAD_INTERVAL: "soon" is not a duration`,
+			`SECRET_PROVIDERS: "consul" must be one of`,
+			"REDIS_HOST: is required",
+			"MINIO_BUCKET: is required",
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("decodeEnvironment() error is missing %q:\n%v", want, err)
+			}
+		}
+	})
+}
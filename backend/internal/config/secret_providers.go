@@ -0,0 +1,310 @@
+package config
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// SecretProvider resolves secrets from one backend. A ref is the provider specific location
+// of a secret, e.g. "secret/fiber-app#jwt_secret" for Vault or "JWT_SECRET" for env.
+type SecretProvider interface {
+	Name() string
+	// DefaultRef is the location of a secret when the mapping file does not override it
+	DefaultRef(key string) string
+	// Get reports ok=false when the backend does not hold the secret
+	Get(ctx context.Context, ref string) (value string, ok bool, err error)
+}
+
+// SecretChain resolves every secret from the first provider that holds it
+type SecretChain struct {
+	providers []SecretProvider
+	// mapping[key][provider] overrides the provider's DefaultRef
+	mapping map[string]map[string]string
+}
+
+// NewSecretChain builds the providers listed in SECRET_PROVIDERS in order of precedence.
+// vaultClient may be nil when the vault provider is not used.
+func NewSecretChain(vaultClient *api.Client) (*SecretChain, error) {
+	env := GetConfig().Env
+
+	chain := &SecretChain{mapping: map[string]map[string]string{}}
+
+	for _, name := range env.SECRET_PROVIDERS {
+		switch name {
+		case "vault":
+			if vaultClient == nil {
+				return nil, errors.New("vault secret provider requires VAULT_HOST")
+			}
+			chain.providers = append(chain.providers, &VaultKVProvider{
+				client: vaultClient,
+				mount:  env.VAULT_KV_MOUNT,
+				path:   env.VAULT_KV_PATH,
+			})
+		case "env":
+			chain.providers = append(chain.providers, EnvProvider{})
+		case "file":
+			chain.providers = append(chain.providers, FileProvider{Dir: env.SECRETS_DIR})
+		case "encrypted-file":
+			key, err := base64.StdEncoding.DecodeString(os.Getenv("SECRETS_FILE_KEY"))
+			if err != nil || len(key) != 32 {
+				return nil, errors.New("encrypted-file secret provider requires SECRETS_FILE_KEY (base64, 32 bytes)")
+			}
+			chain.providers = append(chain.providers, &EncryptedFileProvider{Path: env.SECRETS_FILE, Key: key})
+		default:
+			return nil, fmt.Errorf("unknown secret provider %q", name)
+		}
+	}
+
+	if len(chain.providers) == 0 {
+		return nil, errors.New("SECRET_PROVIDERS is empty")
+	}
+
+	if env.SECRETS_MAPPING != "" {
+		data, err := os.ReadFile(env.SECRETS_MAPPING)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &chain.mapping); err != nil {
+			return nil, fmt.Errorf("secrets mapping %s: %w", env.SECRETS_MAPPING, err)
+		}
+	}
+
+	return chain, nil
+}
+
+// Resolve fills every field of SecretsConfig tagged with `secret:"<key>"` and reports which
+// provider each came from. Fields tagged optional may be missing from all providers; any
+// other missing secret is an error.
+func (c *SecretChain) Resolve(ctx context.Context) (SecretsConfig, []Setting, error) {
+	var secrets SecretsConfig
+	var settings []Setting
+
+	v := reflect.ValueOf(&secrets).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		tag := v.Type().Field(i).Tag.Get("secret")
+		if tag == "" {
+			continue
+		}
+		key, opts, _ := strings.Cut(tag, ",")
+
+		value, source, err := c.get(ctx, key)
+		if err != nil {
+			return SecretsConfig{}, nil, err
+		}
+		if source == "" {
+			if opts != "optional" {
+				return SecretsConfig{}, nil, fmt.Errorf("secret %s not found in %s", key, c.names())
+			}
+			source = "unset"
+		}
+		v.Field(i).SetString(value)
+		settings = append(settings, Setting{Name: key, Source: source})
+	}
+
+	return secrets, settings, nil
+}
+
+// Lookup resolves a secret that is not part of SecretsConfig, e.g. one per configured
+// OIDC provider. ok is false when no provider holds it.
+func (c *SecretChain) Lookup(ctx context.Context, key string) (string, bool, error) {
+	value, source, err := c.get(ctx, key)
+	return value, source != "", err
+}
+
+// get returns the value and the name of the provider holding it, or an empty source if none does
+func (c *SecretChain) get(ctx context.Context, key string) (string, string, error) {
+	for _, provider := range c.providers {
+		ref, ok := c.mapping[key][provider.Name()]
+		if !ok {
+			ref = provider.DefaultRef(key)
+		}
+
+		value, found, err := provider.Get(ctx, ref)
+		if err != nil {
+			return "", "", fmt.Errorf("secret %s from %s: %w", key, provider.Name(), err)
+		}
+		if found {
+			return value, provider.Name(), nil
+		}
+	}
+
+	return "", "", nil
+}
+
+func (c *SecretChain) names() string {
+	names := make([]string, len(c.providers))
+	for i, provider := range c.providers {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// VaultKVProvider reads KV v2 secrets, refs are "<mount>/<path>#<field>"
+type VaultKVProvider struct {
+	client *api.Client
+	mount  string
+	path   string
+}
+
+func (p *VaultKVProvider) Name() string { return "vault" }
+
+func (p *VaultKVProvider) DefaultRef(key string) string {
+	return fmt.Sprintf("%s/%s#%s", p.mount, p.path, key)
+}
+
+func (p *VaultKVProvider) Get(ctx context.Context, ref string) (string, bool, error) {
+	location, field, ok := strings.Cut(ref, "#")
+	mount, path, ok2 := strings.Cut(location, "/")
+	if !ok || !ok2 {
+		return "", false, fmt.Errorf("invalid vault ref %q, want <mount>/<path>#<field>", ref)
+	}
+
+	kv, err := p.client.KVv2(mount).Get(ctx, path)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	value, ok := kv.Data[field]
+	if !ok {
+		return "", false, nil
+	}
+
+	return fmt.Sprintf("%v", value), true, nil
+}
+
+// EnvProvider reads environment variables, by default the upper-cased key
+type EnvProvider struct{}
+
+func (EnvProvider) Name() string { return "env" }
+
+func (EnvProvider) DefaultRef(key string) string { return strings.ToUpper(key) }
+
+func (EnvProvider) Get(ctx context.Context, ref string) (string, bool, error) {
+	value, ok := os.LookupEnv(ref)
+	return value, ok && value != "", nil
+}
+
+// FileProvider reads one file per secret, the layout of a mounted Kubernetes secret volume
+type FileProvider struct {
+	Dir string
+}
+
+func (FileProvider) Name() string { return "file" }
+
+func (FileProvider) DefaultRef(key string) string { return key }
+
+func (p FileProvider) Get(ctx context.Context, ref string) (string, bool, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, ref))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// EncryptedFileProvider reads a JSON object of secrets sealed with SealSecretsFile.
+// The file is decrypted on every lookup so edits are picked up by a reload.
+type EncryptedFileProvider struct {
+	Path string
+	Key  []byte
+}
+
+func (*EncryptedFileProvider) Name() string { return "encrypted-file" }
+
+func (*EncryptedFileProvider) DefaultRef(key string) string { return key }
+
+func (p *EncryptedFileProvider) Get(ctx context.Context, ref string) (string, bool, error) {
+	sealed, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", false, err
+	}
+
+	secrets, err := OpenSecretsFile(p.Key, sealed)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %w", p.Path, err)
+	}
+
+	value, ok := secrets[ref]
+	return value, ok, nil
+}
+
+const sealedSecretsHeader = "fiber-secrets:v1:"
+
+// SealSecretsFile encrypts secrets with AES-256-GCM into the format read by EncryptedFileProvider
+func SealSecretsFile(key []byte, secrets map[string]string) ([]byte, error) {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newSecretsAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(sealedSecretsHeader))
+	return []byte(sealedSecretsHeader + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+func OpenSecretsFile(key []byte, data []byte) (map[string]string, error) {
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(string(data)), sealedSecretsHeader)
+	if !ok {
+		return nil, errors.New("not a sealed secrets file")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newSecretsAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed secrets file is truncated")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(sealedSecretsHeader))
+	if err != nil {
+		return nil, errors.New("sealed secrets file cannot be decrypted with this key")
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+func newSecretsAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
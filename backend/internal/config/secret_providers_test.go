@@ -0,0 +1,89 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretChain_Resolve(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "jwt_secret"), []byte("jwt-from-file\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "minio_root_user"), []byte("minio-from-file"), 0o600)
+	os.WriteFile(filepath.Join(dir, "storage-password"), []byte("minio-password-from-file"), 0o600)
+
+	key := bytes.Repeat([]byte{7}, 32)
+	sealed, err := SealSecretsFile(key, map[string]string{
+		"jwt_secret":          "jwt-from-encrypted-file",
+		"minio_root_password": "minio-password-from-encrypted-file",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedPath := filepath.Join(dir, "secrets.enc")
+	os.WriteFile(sealedPath, sealed, 0o600)
+
+	t.Setenv("JWT_SECRET", "jwt-from-env")
+	t.Setenv("MINIO_ROOT_USER", "")
+
+	tests := []struct {
+		name      string
+		providers []SecretProvider
+		mapping   map[string]map[string]string
+		want      SecretsConfig
+		wantErr   string
+	}{
+		{
+			name:      "First provider holding a secret wins",
+			providers: []SecretProvider{EnvProvider{}, FileProvider{Dir: dir}, &EncryptedFileProvider{Path: sealedPath, Key: key}},
+			want: SecretsConfig{
+				JWT_SECRET:          "jwt-from-env",
+				MINIO_ROOT_USER:     "minio-from-file",
+				MINIO_ROOT_PASSWORD: "minio-password-from-encrypted-file",
+			},
+		},
+		{
+			name:      "Mapping overrides the default ref",
+			providers: []SecretProvider{FileProvider{Dir: dir}},
+			mapping:   map[string]map[string]string{"minio_root_password": {"file": "storage-password"}},
+			want: SecretsConfig{
+				JWT_SECRET:          "jwt-from-file",
+				MINIO_ROOT_USER:     "minio-from-file",
+				MINIO_ROOT_PASSWORD: "minio-password-from-file",
+			},
+		},
+		{
+			name:      "Missing required secret",
+			providers: []SecretProvider{FileProvider{Dir: dir}},
+			wantErr:   "secret minio_root_password not found in file",
+		},
+		{
+			name:      "Encrypted file with wrong key",
+			providers: []SecretProvider{&EncryptedFileProvider{Path: sealedPath, Key: bytes.Repeat([]byte{8}, 32)}},
+			wantErr:   "cannot be decrypted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := &SecretChain{providers: tt.providers, mapping: tt.mapping}
+
+			got, _, err := chain.Resolve(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSecret_NeverPrinted(t *testing.T) {
+	const value = "hunter2-super-secret"
+
+	config := Config{
+		Env:     EnvironmentConfig{APP_ENV: "development", VAULT_TOKEN: value},
+		Secrets: SecretsConfig{JWT_SECRET: value, REDIS_PASSWORD: value},
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	logger.Info("config", "token", config.Env.VAULT_TOKEN, "secrets", config.Secrets)
+
+	jsonOut, _ := json.Marshal(config)
+
+	outputs := map[string]string{
+		"%v":    fmt.Sprintf("%v", config),
+		"%+v":   fmt.Sprintf("%+v", config),
+		"%#v":   fmt.Sprintf("%#v", config),
+		"%s":    fmt.Sprintf("%s", config.Secrets.JWT_SECRET),
+		"%q":    fmt.Sprintf("%q", config.Secrets.JWT_SECRET),
+		"%x":    fmt.Sprintf("%x", config.Secrets.JWT_SECRET),
+		"Print": fmt.Sprint(config.Secrets.JWT_SECRET),
+		"JSON":  string(jsonOut),
+		"slog":  logs.String(),
+	}
+
+	for name, out := range outputs {
+		if strings.Contains(out, value) || strings.Contains(out, fmt.Sprintf("%x", value)) {
+			t.Errorf("%s leaks the secret: %s", name, out)
+		}
+		if !strings.Contains(out, redacted) {
+			t.Errorf("%s does not show the secret as redacted: %s", name, out)
+		}
+	}
+
+	if config.Secrets.JWT_SECRET.Reveal() != value {
+		t.Errorf("Reveal() = %q, want %q", config.Secrets.JWT_SECRET.Reveal(), value)
+	}
+	if Secret("").String() != "" {
+		t.Errorf("String() of an unset secret = %q, want empty", Secret("").String())
+	}
+}
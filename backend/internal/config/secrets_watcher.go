@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// SecretsListener is notified after the secrets have been swapped
+type SecretsListener func(old, new SecretsConfig)
+
+var (
+	secretsMu   sync.Mutex
+	listenersMu sync.RWMutex
+	listeners   []SecretsListener
+)
+
+// OnSecretsChange registers a listener called whenever a reload finds changed secrets
+func OnSecretsChange(listener SecretsListener) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	listeners = append(listeners, listener)
+}
+
+// ReloadSecrets resolves the secrets again and swaps them when any value changed.
+// It reports whether anything changed.
+func ReloadSecrets(chain *SecretChain) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	secrets, settings, err := chain.Resolve(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	recordSources(&secretSources, settings)
+	if secrets == GetConfig().Secrets {
+		return false, nil
+	}
+
+	old := GetConfig().Secrets
+	swapSecrets(secrets)
+	log.Println("✓ Secrets reloaded")
+
+	listenersMu.RLock()
+	defer listenersMu.RUnlock()
+	for _, listener := range listeners {
+		listener(old, secrets)
+	}
+
+	return true, nil
+}
+
+// WatchSecrets polls the secret providers for changes until ctx is done
+func WatchSecrets(ctx context.Context, chain *SecretChain, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ReloadSecrets(chain); err != nil {
+				log.Printf("Secrets reload failed: %v", err)
+			}
+		}
+	}
+}
+
+// swapSecrets must be called with secretsMu held
+func swapSecrets(secrets SecretsConfig) {
+	update(func(next *Config) {
+		next.Secrets = secrets
+	})
+	addJWTKey(secrets.JWT_SECRET.Reveal())
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// drainPeriod is how long a replaced pool keeps serving callers that fetched it before the swap
+var drainPeriod = 30 * time.Second
+
+// DB holds a connection pool that can be swapped for one using new credentials.
+// Callers should fetch the pool with Get for every unit of work instead of keeping it.
+type DB struct {
+	driver  string
+	current atomic.Pointer[sql.DB]
+
+	mu      sync.Mutex
+	retired map[*sql.DB]*time.Timer
+}
+
+func Open(driver, dsn string) (*DB, error) {
+	pool, err := openPool(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DB{driver: driver, retired: map[*sql.DB]*time.Timer{}}
+	db.current.Store(pool)
+	return db, nil
+}
+
+func (d *DB) Get() *sql.DB {
+	return d.current.Load()
+}
+
+func (d *DB) Ping(ctx context.Context) error {
+	return d.Get().PingContext(ctx)
+}
+
+// Rotate connects with the new DSN and only swaps once the new pool is reachable. The old pool
+// is closed after drainPeriod; sql.DB.Close waits for queries already running on it to finish.
+func (d *DB) Rotate(dsn string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pool, err := openPool(d.driver, dsn)
+	if err != nil {
+		return err
+	}
+
+	old := d.current.Swap(pool)
+
+	d.retired[old] = time.AfterFunc(drainPeriod, func() {
+		d.mu.Lock()
+		delete(d.retired, old)
+		d.mu.Unlock()
+
+		if err := old.Close(); err != nil {
+			log.Printf("Closing rotated database pool failed: %v", err)
+		}
+	})
+
+	log.Println("✓ Database connection pool rotated")
+	return nil
+}
+
+// Close closes the current pool and any rotated pool still draining
+func (d *DB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for pool, timer := range d.retired {
+		timer.Stop()
+		pool.Close()
+		delete(d.retired, pool)
+	}
+
+	return d.Get().Close()
+}
+
+func openPool(driver, dsn string) (*sql.DB, error) {
+	pool, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	pool.SetMaxOpenConns(25)
+	pool.SetMaxIdleConns(5)
+	pool.SetConnMaxLifetime(30 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pool.PingContext(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
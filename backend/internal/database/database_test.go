@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver accepts any DSN except "unreachable" and counts the connections open per DSN
+type fakeDriver struct {
+	mu   sync.Mutex
+	open map[string]int
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	if dsn == "unreachable" {
+		return nil, errors.New("connection refused")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.open[dsn]++
+	return &fakeConn{driver: d, dsn: dsn}, nil
+}
+
+func (d *fakeDriver) openConns(dsn string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.open[dsn]
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+	dsn    string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	c.driver.open[c.dsn]--
+	return nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	return nil
+}
+
+var testDriver = &fakeDriver{open: map[string]int{}}
+
+func init() {
+	sql.Register("fake", testDriver)
+}
+
+func TestRotate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dsn     string
+		wantErr bool
+	}{
+		{name: "Reachable credentials", dsn: "user=v-app-2"},
+		{name: "Unreachable credentials keep the old pool", dsn: "unreachable", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := Open("fake", "user=v-app-1")
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer db.Close()
+			old := db.Get()
+
+			err = db.Rotate(tt.dsn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rotate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if swapped := db.Get() != old; swapped == tt.wantErr {
+				t.Errorf("Rotate() swapped = %v, want %v", swapped, !tt.wantErr)
+			}
+			if err := db.Ping(context.Background()); err != nil {
+				t.Errorf("Ping() error = %v", err)
+			}
+			// callers still holding the old pool keep working until it is drained
+			if err := old.Ping(); err != nil {
+				t.Errorf("old pool Ping() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRotate_DrainsOldPool(t *testing.T) {
+	defer func(period time.Duration) { drainPeriod = period }(drainPeriod)
+	drainPeriod = 50 * time.Millisecond
+
+	db, err := Open("fake", "user=drain-1")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	old := db.Get()
+
+	if err := db.Rotate("user=drain-2"); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if got := testDriver.openConns("user=drain-1"); got != 1 {
+		t.Fatalf("old pool connections = %d before the drain period, want 1", got)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if err := old.Ping(); err == nil {
+		t.Error("old pool Ping() after the drain period error = nil, want closed")
+	}
+	if got := testDriver.openConns("user=drain-1"); got != 0 {
+		t.Errorf("old pool connections = %d after the drain period, want 0", got)
+	}
+	if err := db.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}
+
+func TestClose_ClosesDrainingPools(t *testing.T) {
+	db, err := Open("fake", "user=close-1")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	old := db.Get()
+
+	if err := db.Rotate("user=close-2"); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	for dsn, pool := range map[string]*sql.DB{"user=close-1": old, "user=close-2": db.Get()} {
+		if err := pool.Ping(); err == nil {
+			t.Errorf("%s Ping() after Close() error = nil, want closed", dsn)
+		}
+		if got := testDriver.openConns(dsn); got != 0 {
+			t.Errorf("%s connections = %d after Close(), want 0", dsn, got)
+		}
+	}
+}
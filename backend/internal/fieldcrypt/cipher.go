@@ -0,0 +1,41 @@
+package fieldcrypt
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// Cipher encrypts single values under a versioned key. Ciphertexts carry the key version in a
+// "<prefix>:v<version>:" header, so values written before a key rotation can be found and
+// re-wrapped without decrypting them in the application.
+type Cipher interface {
+	Encrypt(ctx context.Context, plaintext []byte) (string, error)
+	Decrypt(ctx context.Context, ciphertext string) ([]byte, error)
+	// Rewrap re-encrypts a ciphertext under the latest key version
+	Rewrap(ctx context.Context, ciphertext string) (string, error)
+	LatestVersion(ctx context.Context) (int, error)
+}
+
+// KeyVersion returns the key version of a ciphertext, or false if value is not a ciphertext
+func KeyVersion(value string) (int, bool) {
+	prefix, rest, ok := strings.Cut(value, ":")
+	if !ok || prefix == "" {
+		return 0, false
+	}
+
+	version, _, ok := strings.Cut(rest, ":")
+	if !ok || !strings.HasPrefix(version, "v") {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(version[1:])
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return n, true
+}
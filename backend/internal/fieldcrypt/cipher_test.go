@@ -0,0 +1,114 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestKeyVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantVersion int
+		wantOK      bool
+	}{
+		{name: "Transit ciphertext", value: "vault:v3:AbCd==", wantVersion: 3, wantOK: true},
+		{name: "Local ciphertext", value: "local:v1:AbCd==", wantVersion: 1, wantOK: true},
+		{name: "Plain IPv4 address", value: "203.0.113.7", wantOK: false},
+		{name: "Plain IPv6 address", value: "2001:db8::1", wantOK: false},
+		{name: "User agent", value: "Mozilla/5.0 (X11; Linux x86_64)", wantOK: false},
+		{name: "Version zero", value: "vault:v0:AbCd==", wantOK: false},
+		{name: "Empty", value: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, ok := KeyVersion(tt.value)
+			if ok != tt.wantOK || version != tt.wantVersion {
+				t.Errorf("KeyVersion(%q) = %d, %v, want %d, %v", tt.value, version, ok, tt.wantVersion, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLocalCipher_Rotation(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := NewLocalCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := c.Encrypt(ctx, []byte("203.0.113.7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Rotate(bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	rewrapped, err := c.Rewrap(ctx, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := KeyVersion(rewrapped); version != 2 {
+		t.Errorf("Rewrap() version = %d, want 2", version)
+	}
+
+	for _, ciphertext := range []string{old, rewrapped} {
+		plaintext, err := c.Decrypt(ctx, ciphertext)
+		if err != nil || string(plaintext) != "203.0.113.7" {
+			t.Errorf("Decrypt(%q) = %q, %v", ciphertext, plaintext, err)
+		}
+	}
+
+	tampered := old[:len(old)-4] + "AAA="
+	if _, err := c.Decrypt(ctx, tampered); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Errorf("Decrypt() of tampered ciphertext error = %v, want ErrInvalidCiphertext", err)
+	}
+}
+
+func TestFields_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := NewLocalCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := map[string]interface{}{
+		"username":  "user1",
+		"ip":        "203.0.113.7",
+		"userAgent": "Mozilla/5.0",
+	}
+	if err := EncryptFields(ctx, c, session, "ip", "userAgent", "email"); err != nil {
+		t.Fatal(err)
+	}
+	if session["ip"] == "203.0.113.7" || session["username"] != "user1" {
+		t.Fatalf("EncryptFields() = %v", session)
+	}
+
+	stored := map[string]string{"legacyIp": "198.51.100.1"}
+	for field, value := range session {
+		stored[field] = value.(string)
+	}
+
+	if err := DecryptFields(ctx, c, stored, "ip", "userAgent", "legacyIp"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"username":  "user1",
+		"ip":        "203.0.113.7",
+		"userAgent": "Mozilla/5.0",
+		"legacyIp":  "198.51.100.1",
+	}
+	for field, value := range want {
+		if stored[field] != value {
+			t.Errorf("DecryptFields() %s = %q, want %q", field, stored[field], value)
+		}
+	}
+}
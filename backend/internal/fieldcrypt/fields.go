@@ -0,0 +1,47 @@
+package fieldcrypt
+
+import (
+	"context"
+	"fmt"
+)
+
+// EncryptFields replaces the named fields of a hash in place with their ciphertext.
+// Missing fields are skipped.
+func EncryptFields(ctx context.Context, c Cipher, values map[string]interface{}, fields ...string) error {
+	for _, field := range fields {
+		value, ok := values[field]
+		if !ok {
+			continue
+		}
+
+		ciphertext, err := c.Encrypt(ctx, []byte(fmt.Sprint(value)))
+		if err != nil {
+			return fmt.Errorf("encrypt %s: %w", field, err)
+		}
+		values[field] = ciphertext
+	}
+
+	return nil
+}
+
+// DecryptFields replaces the named fields of a hash in place with their plaintext.
+// Values that are not ciphertexts were written before encryption was enabled and are kept.
+func DecryptFields(ctx context.Context, c Cipher, values map[string]string, fields ...string) error {
+	for _, field := range fields {
+		value, ok := values[field]
+		if !ok {
+			continue
+		}
+		if _, encrypted := KeyVersion(value); !encrypted {
+			continue
+		}
+
+		plaintext, err := c.Decrypt(ctx, value)
+		if err != nil {
+			return fmt.Errorf("decrypt %s: %w", field, err)
+		}
+		values[field] = string(plaintext)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const localPrefix = "local"
+
+// LocalCipher is an in-process AES-GCM keyring with the same versioning semantics as transit.
+// Keys only live in memory, it is meant for tests and local development.
+type LocalCipher struct {
+	mu   sync.RWMutex
+	keys [][]byte
+}
+
+// NewLocalCipher creates a keyring with key as version 1. Keys must be 16, 24 or 32 bytes.
+func NewLocalCipher(key []byte) (*LocalCipher, error) {
+	l := &LocalCipher{}
+	if err := l.Rotate(key); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Rotate adds key as the new latest version, older versions stay available for decryption
+func (l *LocalCipher) Rotate(key []byte) error {
+	if _, err := aes.NewCipher(key); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keys = append(l.keys, key)
+	return nil
+}
+
+func (l *LocalCipher) Encrypt(ctx context.Context, plaintext []byte) (string, error) {
+	l.mu.RLock()
+	version := len(l.keys)
+	key := l.keys[version-1]
+	l.mu.RUnlock()
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return fmt.Sprintf("%s:v%d:%s", localPrefix, version, base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+func (l *LocalCipher) Decrypt(ctx context.Context, ciphertext string) ([]byte, error) {
+	version, ok := KeyVersion(ciphertext)
+	if !ok || !strings.HasPrefix(ciphertext, localPrefix+":") {
+		return nil, ErrInvalidCiphertext
+	}
+
+	l.mu.RLock()
+	if version > len(l.keys) {
+		l.mu.RUnlock()
+		return nil, fmt.Errorf("%w: unknown key version %d", ErrInvalidCiphertext, version)
+	}
+	key := l.keys[version-1]
+	l.mu.RUnlock()
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext[strings.LastIndex(ciphertext, ":")+1:])
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
+
+func (l *LocalCipher) Rewrap(ctx context.Context, ciphertext string) (string, error) {
+	plaintext, err := l.Decrypt(ctx, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return l.Encrypt(ctx, plaintext)
+}
+
+func (l *LocalCipher) LatestVersion(ctx context.Context) (int, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.keys), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,124 @@
+package fieldcrypt
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Target names the encrypted fields of every Redis hash matching Pattern
+type Target struct {
+	Pattern string
+	Fields  []string
+}
+
+// swapScript replaces a field only if it still holds the ciphertext that was re-wrapped,
+// so a value written concurrently is never overwritten with stale data
+var swapScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// Rewrapper moves ciphertexts stored in Redis to the latest key version after a rotation,
+// so old key versions can eventually be retired
+type Rewrapper struct {
+	redisClient *redis.Client
+	cipher      Cipher
+	targets     []Target
+}
+
+func NewRewrapper(redisClient *redis.Client, cipher Cipher, targets ...Target) *Rewrapper {
+	return &Rewrapper{
+		redisClient: redisClient,
+		cipher:      cipher,
+		targets:     targets,
+	}
+}
+
+// Run re-wraps every designated field below the latest key version and returns how many
+// values were updated
+func (r *Rewrapper) Run(ctx context.Context) (int, error) {
+	latest, err := r.cipher.LatestVersion(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rewrapped := 0
+	for _, target := range r.targets {
+		iter := r.redisClient.Scan(ctx, 0, target.Pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			n, err := r.rewrapKey(ctx, iter.Val(), target.Fields, latest)
+			rewrapped += n
+			if err != nil {
+				return rewrapped, err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return rewrapped, err
+		}
+	}
+
+	return rewrapped, nil
+}
+
+func (r *Rewrapper) rewrapKey(ctx context.Context, key string, fields []string, latest int) (int, error) {
+	values, err := r.redisClient.HMGet(ctx, key, fields...).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	rewrapped := 0
+	for i, value := range values {
+		ciphertext, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if version, encrypted := KeyVersion(ciphertext); !encrypted || version >= latest {
+			continue
+		}
+
+		updated, err := r.cipher.Rewrap(ctx, ciphertext)
+		if err != nil {
+			return rewrapped, err
+		}
+
+		swapped, err := swapScript.Run(ctx, r.redisClient, []string{key}, fields[i], ciphertext, updated).Int()
+		if err != nil {
+			return rewrapped, err
+		}
+		rewrapped += swapped
+	}
+
+	return rewrapped, nil
+}
+
+// Start runs the re-wrap job every interval until ctx is cancelled
+func (r *Rewrapper) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := r.Run(ctx)
+			if err != nil {
+				log.Printf("Field re-wrap failed after %d values: %v", n, err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("✓ Re-wrapped %d encrypted fields", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package fieldcrypt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// TransitCipher delegates encryption to Vault's transit engine, the key never leaves Vault
+type TransitCipher struct {
+	client *api.Client
+	mount  string
+	key    string
+}
+
+func NewTransitCipher(client *api.Client, mount, key string) *TransitCipher {
+	if mount == "" {
+		mount = "transit"
+	}
+
+	return &TransitCipher{
+		client: client,
+		mount:  mount,
+		key:    key,
+	}
+}
+
+func (t *TransitCipher) Encrypt(ctx context.Context, plaintext []byte) (string, error) {
+	return t.write(ctx, "encrypt", "plaintext", base64.StdEncoding.EncodeToString(plaintext), "ciphertext")
+}
+
+func (t *TransitCipher) Decrypt(ctx context.Context, ciphertext string) ([]byte, error) {
+	encoded, err := t.write(ctx, "decrypt", "ciphertext", ciphertext, "plaintext")
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+func (t *TransitCipher) Rewrap(ctx context.Context, ciphertext string) (string, error) {
+	return t.write(ctx, "rewrap", "ciphertext", ciphertext, "ciphertext")
+}
+
+func (t *TransitCipher) LatestVersion(ctx context.Context) (int, error) {
+	secret, err := t.client.Logical().ReadWithContext(ctx, fmt.Sprintf("%s/keys/%s", t.mount, t.key))
+	if err != nil {
+		return 0, fmt.Errorf("transit read key: %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return 0, fmt.Errorf("transit key %s not found", t.key)
+	}
+
+	version, ok := secret.Data["latest_version"].(json.Number)
+	if !ok {
+		return 0, errors.New("transit read key: response has no latest_version")
+	}
+
+	n, err := version.Int64()
+	return int(n), err
+}
+
+func (t *TransitCipher) write(ctx context.Context, op, inField, in, outField string) (string, error) {
+	secret, err := t.client.Logical().WriteWithContext(ctx, fmt.Sprintf("%s/%s/%s", t.mount, op, t.key), map[string]interface{}{
+		inField: in,
+	})
+	if err != nil {
+		return "", fmt.Errorf("transit %s: %w", op, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return "", fmt.Errorf("transit %s: empty response", op)
+	}
+
+	out, ok := secret.Data[outField].(string)
+	if !ok {
+		return "", fmt.Errorf("transit %s: response has no %s", op, outField)
+	}
+
+	return out, nil
+}
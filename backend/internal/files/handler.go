@@ -0,0 +1,24 @@
+package files
+
+import (
+	"go-backend/internal/config"
+	"go-backend/internal/middleware"
+	"go-backend/internal/quota"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minio/minio-go/v7"
+	"github.com/redis/go-redis/v9"
+)
+
+func RegisterRoutes(app *fiber.Router, redisClient *redis.Client, minioClient *minio.Client, quotaService *quota.QuotaService, scanPipeline *ScanPipeline) {
+	cfg := config.GetConfig()
+	fileService := NewFileService(redisClient, minioClient, cfg.Env.MINIO_BUCKET, quotaService, scanPipeline)
+
+	files := (*app).Group("/files", middleware.ScopedAuthMiddleware(redisClient, shared.ScopeFiles))
+
+	files.Get("/", fileService.ListHandler)
+	files.Post("/", fileService.UploadHandler)
+	files.Get("/:fileId", fileService.GetHandler)
+	files.Delete("/:fileId", fileService.DeleteHandler)
+}
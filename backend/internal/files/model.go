@@ -0,0 +1,13 @@
+package files
+
+type FileInfo struct {
+	FileId      string `json:"fileId"`
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+	UploadedAt  int64  `json:"uploadedAt"`
+
+	ScanStatus    string `json:"scanStatus"`
+	ScanSignature string `json:"scanSignature,omitempty"`
+	ScannedAt     int64  `json:"scannedAt,omitempty"`
+}
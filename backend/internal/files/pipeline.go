@@ -0,0 +1,274 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/quota"
+	"go-backend/internal/scan"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanFailed   = "failed"
+
+	scanQueueKey = "scan_queue"
+	// jobs being scanned, scored by when their lease runs out in unix milliseconds
+	scanLeasesKey   = "scan_queue:leases"
+	scanMaxAttempts = 3
+
+	scanPollInterval = time.Second
+)
+
+// claimScanScript leases the next job, so it is scanned by one worker at a time
+var claimScanScript = redis.NewScript(`
+local job = redis.call('RPOP', KEYS[1])
+if not job then
+	return false
+end
+redis.call('ZADD', KEYS[2], ARGV[1], job)
+return job
+`)
+
+// releaseScanScript drops a lease unless it ran out and the job was claimed again since
+var releaseScanScript = redis.NewScript(`
+if tonumber(redis.call('ZSCORE', KEYS[1], ARGV[1])) == tonumber(ARGV[2]) then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// retryScanScript counts a failed attempt of a pending file and queues the job again, or marks
+// the file failed once it used all attempts. A file deleted or scanned meanwhile is left alone
+// and 0 returned.
+var retryScanScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'scanStatus') ~= ARGV[1] then
+	return 0
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'scanAttempts', 1)
+if attempts >= tonumber(ARGV[2]) then
+	redis.call('HSET', KEYS[1], 'scanStatus', ARGV[3])
+else
+	redis.call('LPUSH', KEYS[2], ARGV[4])
+end
+return attempts
+`)
+
+// recoverScanScript queues jobs whose lease ran out again, their worker died mid-scan. The
+// lost scan counts as an attempt, so a file crashing workers ends up failed.
+var recoverScanScript = redis.NewScript(`
+local jobs = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, job in ipairs(jobs) do
+	redis.call('ZREM', KEYS[2], job)
+	local key = 'file:' .. job
+	if redis.call('HGET', key, 'scanStatus') == ARGV[2] then
+		if redis.call('HINCRBY', key, 'scanAttempts', 1) >= tonumber(ARGV[3]) then
+			redis.call('HSET', key, 'scanStatus', ARGV[4])
+		else
+			redis.call('RPUSH', KEYS[1], job)
+		end
+	end
+end
+return #jobs
+`)
+
+// markScannedScript records the scan result only while the file is still pending, returning 0
+// when another worker or a delete got there first
+var markScannedScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'scanStatus') ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+return 1
+`)
+
+// ScanPipeline moves uploaded objects out of quarantine once the scanner has cleared them.
+// Jobs live in a Redis list and are leased while scanned. A job whose worker crashed is queued
+// again once its lease runs out, while jobs other replicas are still scanning are left alone.
+type ScanPipeline struct {
+	redisClient  *redis.Client
+	minioClient  *minio.Client
+	bucket       string
+	scanner      scan.Scanner
+	quotaService *quota.QuotaService
+	lease        time.Duration
+}
+
+func NewScanPipeline(redisClient *redis.Client, minioClient *minio.Client, bucket string, scanner scan.Scanner, quotaService *quota.QuotaService, lease time.Duration) *ScanPipeline {
+	return &ScanPipeline{
+		redisClient:  redisClient,
+		minioClient:  minioClient,
+		bucket:       bucket,
+		scanner:      scanner,
+		quotaService: quotaService,
+		lease:        lease,
+	}
+}
+
+// Enqueue adds the scan job to pipe so it is queued in the same transaction as the file metadata
+func (p *ScanPipeline) Enqueue(ctx context.Context, pipe redis.Pipeliner, userId, fileId string) {
+	pipe.LPush(ctx, scanQueueKey, scanJob(userId, fileId))
+}
+
+func (p *ScanPipeline) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go p.worker(ctx)
+	}
+
+	log.Printf("✓ Upload scan pipeline started with %d workers", workers)
+}
+
+func (p *ScanPipeline) worker(ctx context.Context) {
+	for {
+		now := time.Now()
+		if err := p.recoverExpired(ctx, now); err != nil && ctx.Err() == nil {
+			log.Printf("Scan lease recovery failed: %v", err)
+		}
+
+		job, lease, err := p.claim(ctx, now)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				log.Printf("Scan queue read failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(scanPollInterval):
+			}
+			continue
+		}
+
+		if err := p.process(ctx, job); err != nil {
+			log.Printf("Scan of %s failed: %v", job, err)
+		}
+		p.release(ctx, job, lease)
+	}
+}
+
+// recoverExpired queues jobs whose lease ran out by now again
+func (p *ScanPipeline) recoverExpired(ctx context.Context, now time.Time) error {
+	return recoverScanScript.Run(ctx, p.redisClient, []string{scanQueueKey, scanLeasesKey},
+		now.UnixMilli(), ScanPending, scanMaxAttempts, ScanFailed).Err()
+}
+
+// claim leases the next job and returns it with the lease it holds, redis.Nil when there is none
+func (p *ScanPipeline) claim(ctx context.Context, now time.Time) (string, int64, error) {
+	lease := now.Add(p.lease).UnixMilli()
+	job, err := claimScanScript.Run(ctx, p.redisClient, []string{scanQueueKey, scanLeasesKey}, lease).Text()
+	return job, lease, err
+}
+
+func (p *ScanPipeline) release(ctx context.Context, job string, lease int64) error {
+	return releaseScanScript.Run(ctx, p.redisClient, []string{scanLeasesKey}, job, lease).Err()
+}
+
+func (p *ScanPipeline) process(ctx context.Context, job string) error {
+	userId, fileId, ok := strings.Cut(job, ":")
+	if !ok {
+		return fmt.Errorf("malformed scan job %q", job)
+	}
+
+	key := fileKey(userId, fileId)
+	fileData, err := p.redisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	// deleted while waiting for the scan
+	if len(fileData) == 0 {
+		p.minioClient.RemoveObject(ctx, p.bucket, quarantineObjectName(userId, fileId), minio.RemoveObjectOptions{})
+		return nil
+	}
+	if fileData["scanStatus"] != ScanPending {
+		return nil
+	}
+
+	object, err := p.minioClient.GetObject(ctx, p.bucket, quarantineObjectName(userId, fileId), minio.GetObjectOptions{})
+	if err != nil {
+		return p.retry(ctx, userId, fileId, err)
+	}
+	result, err := p.scanner.Scan(ctx, object)
+	object.Close()
+	if err != nil {
+		return p.retry(ctx, userId, fileId, err)
+	}
+
+	if !result.Clean {
+		if err := p.minioClient.RemoveObject(ctx, p.bucket, quarantineObjectName(userId, fileId), minio.RemoveObjectOptions{}); err != nil {
+			return p.retry(ctx, userId, fileId, err)
+		}
+
+		marked, err := p.markScanned(ctx, userId, fileId, "scanStatus", ScanInfected, "scanSignature", result.Signature, "scannedAt", time.Now().Unix())
+		if err != nil || !marked {
+			return err
+		}
+
+		// only the worker that recorded the result releases, the quota is freed once
+		size, _ := strconv.ParseInt(fileData["size"], 10, 64)
+		p.quotaService.Release(ctx, userId, size, 1)
+
+		log.Printf("Upload %s of user %s rejected: %s", fileId, userId, result.Signature)
+		return nil
+	}
+
+	_, err = p.minioClient.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: p.bucket, Object: liveObjectName(userId, fileId)},
+		minio.CopySrcOptions{Bucket: p.bucket, Object: quarantineObjectName(userId, fileId)},
+	)
+	if err != nil {
+		return p.retry(ctx, userId, fileId, err)
+	}
+	p.minioClient.RemoveObject(ctx, p.bucket, quarantineObjectName(userId, fileId), minio.RemoveObjectOptions{})
+
+	marked, err := p.markScanned(ctx, userId, fileId, "scanStatus", ScanClean, "scannedAt", time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	// deleted while it was copied: the delete removed nothing live yet and will not run again.
+	// A file another worker marked first keeps its metadata and its live object.
+	if !marked {
+		if exists, err := p.redisClient.Exists(ctx, fileKey(userId, fileId)).Result(); err == nil && exists == 0 {
+			p.minioClient.RemoveObject(ctx, p.bucket, liveObjectName(userId, fileId), minio.RemoveObjectOptions{})
+		}
+	}
+	return nil
+}
+
+// markScanned sets fields of a file that is still pending and reports whether it did
+func (p *ScanPipeline) markScanned(ctx context.Context, userId, fileId string, fields ...interface{}) (bool, error) {
+	marked, err := markScannedScript.Run(ctx, p.redisClient, []string{fileKey(userId, fileId)},
+		append([]interface{}{ScanPending}, fields...)...).Int()
+	return marked == 1, err
+}
+
+// retry re-queues the job until scanMaxAttempts, after which the file stays quarantined as failed
+func (p *ScanPipeline) retry(ctx context.Context, userId, fileId string, cause error) error {
+	attempts, err := retryScanScript.Run(ctx, p.redisClient, []string{fileKey(userId, fileId), scanQueueKey},
+		ScanPending, scanMaxAttempts, ScanFailed, scanJob(userId, fileId)).Int()
+	if err != nil {
+		return err
+	}
+
+	if attempts >= scanMaxAttempts {
+		return fmt.Errorf("giving up after %d attempts: %w", attempts, cause)
+	}
+	return cause
+}
+
+func scanJob(userId, fileId string) string {
+	return fmt.Sprintf("%s:%s", userId, fileId)
+}
@@ -0,0 +1,171 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestPipeline(t *testing.T) (*ScanPipeline, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	return NewScanPipeline(redisClient, nil, "test", nil, nil, time.Minute), mr
+}
+
+func queueFile(t *testing.T, p *ScanPipeline, userId, fileId string) {
+	t.Helper()
+	ctx := context.Background()
+	pipe := p.redisClient.TxPipeline()
+	pipe.HSet(ctx, fileKey(userId, fileId), "size", 10, "scanStatus", ScanPending)
+	p.Enqueue(ctx, pipe, userId, fileId)
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanPipeline_Claim(t *testing.T) {
+	ctx := context.Background()
+	p, mr := newTestPipeline(t)
+	now := time.Now()
+
+	if _, _, err := p.claim(ctx, now); !errors.Is(err, redis.Nil) {
+		t.Fatalf("claim() on an empty queue error = %v, want redis.Nil", err)
+	}
+
+	queueFile(t, p, "7", "a")
+	queueFile(t, p, "7", "b")
+	job, lease, err := p.claim(ctx, now)
+	if err != nil || job != "7:a" {
+		t.Fatalf("claim() = %q, %v, want the oldest job 7:a", job, err)
+	}
+	if score, _ := mr.ZScore(scanLeasesKey, job); int64(score) != lease || lease != now.Add(time.Minute).UnixMilli() {
+		t.Errorf("lease = %v, returned %d, want %d", score, lease, now.Add(time.Minute).UnixMilli())
+	}
+	if queued, _ := mr.List(scanQueueKey); len(queued) != 1 || queued[0] != "7:b" {
+		t.Errorf("queue = %q, want only 7:b", queued)
+	}
+
+	if err := p.release(ctx, job, lease); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(scanLeasesKey) {
+		t.Error("lease kept after release")
+	}
+}
+
+func TestScanPipeline_RecoverExpired(t *testing.T) {
+	ctx := context.Background()
+	p, mr := newTestPipeline(t)
+	now := time.Now()
+
+	// a job of a worker that died and one another replica is still scanning
+	queueFile(t, p, "7", "dead")
+	queueFile(t, p, "7", "busy")
+	_, deadLease, _ := p.claim(ctx, now)
+	p.claim(ctx, now.Add(30*time.Second))
+
+	if err := p.recoverExpired(ctx, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if queued, _ := mr.List(scanQueueKey); len(queued) != 1 || queued[0] != "7:dead" {
+		t.Errorf("queue = %q, want only the expired job", queued)
+	}
+	if leased, _ := mr.ZMembers(scanLeasesKey); len(leased) != 1 || leased[0] != "7:busy" {
+		t.Errorf("leases = %q, want the running job kept", leased)
+	}
+	if attempts := mr.HGet(fileKey("7", "dead"), "scanAttempts"); attempts != "1" {
+		t.Errorf("scanAttempts = %q, want the lost scan counted", attempts)
+	}
+
+	// the late worker finishing does not drop the lease of the next claim
+	job, lease, _ := p.claim(ctx, now.Add(2*time.Minute))
+	p.release(ctx, job, deadLease)
+	if score, err := mr.ZScore(scanLeasesKey, job); err != nil || int64(score) != lease {
+		t.Errorf("lease = %v, %v, want the new claim's lease kept", score, err)
+	}
+}
+
+func TestScanPipeline_RecoverExpiredGivesUp(t *testing.T) {
+	ctx := context.Background()
+	p, mr := newTestPipeline(t)
+	now := time.Now()
+	queueFile(t, p, "7", "a")
+
+	for attempt := 1; attempt <= scanMaxAttempts; attempt++ {
+		claimedAt := now.Add(time.Duration(attempt) * 2 * time.Minute)
+		if job, _, err := p.claim(ctx, claimedAt); err != nil || job != "7:a" {
+			t.Fatalf("claim() attempt %d = %q, %v", attempt, job, err)
+		}
+		p.recoverExpired(ctx, claimedAt.Add(time.Minute))
+	}
+
+	if status := mr.HGet(fileKey("7", "a"), "scanStatus"); status != ScanFailed {
+		t.Errorf("scanStatus = %q, want %q", status, ScanFailed)
+	}
+	if mr.Exists(scanQueueKey) || mr.Exists(scanLeasesKey) {
+		t.Error("failed job still queued or leased")
+	}
+}
+
+func TestScanPipeline_Retry(t *testing.T) {
+	ctx := context.Background()
+	p, mr := newTestPipeline(t)
+	queueFile(t, p, "7", "a")
+	p.claim(ctx, time.Now())
+	cause := errors.New("scanner unavailable")
+
+	for attempt := 1; attempt < scanMaxAttempts; attempt++ {
+		if err := p.retry(ctx, "7", "a", cause); !errors.Is(err, cause) {
+			t.Fatalf("retry() error = %v, want the cause", err)
+		}
+	}
+	if queued, _ := mr.List(scanQueueKey); len(queued) != scanMaxAttempts-1 {
+		t.Errorf("queue = %q, want the job queued after each failure", queued)
+	}
+
+	if err := p.retry(ctx, "7", "a", cause); err == nil {
+		t.Fatal("retry() error = nil, want giving up")
+	}
+	if status := mr.HGet(fileKey("7", "a"), "scanStatus"); status != ScanFailed {
+		t.Errorf("scanStatus = %q, want %q", status, ScanFailed)
+	}
+
+	// a file deleted while scanned is not recreated
+	p.retry(ctx, "7", "gone", cause)
+	if mr.Exists(fileKey("7", "gone")) {
+		t.Error("retry() recreated a deleted file")
+	}
+}
+
+func TestScanPipeline_MarkScanned(t *testing.T) {
+	ctx := context.Background()
+	p, mr := newTestPipeline(t)
+	queueFile(t, p, "7", "a")
+
+	marked, err := p.markScanned(ctx, "7", "a", "scanStatus", ScanInfected, "scanSignature", "Eicar-Test-Signature")
+	if err != nil || !marked {
+		t.Fatalf("markScanned() = %v, %v, want true", marked, err)
+	}
+	if signature := mr.HGet(fileKey("7", "a"), "scanSignature"); signature != "Eicar-Test-Signature" {
+		t.Errorf("scanSignature = %q, want the result stored", signature)
+	}
+
+	// a second worker scanning the same file does not record, and release, it again
+	if marked, _ := p.markScanned(ctx, "7", "a", "scanStatus", ScanClean); marked {
+		t.Error("markScanned() overwrote a finished scan")
+	}
+	if marked, _ := p.markScanned(ctx, "7", "gone", "scanStatus", ScanClean); marked || mr.Exists(fileKey("7", "gone")) {
+		t.Error("markScanned() recreated a deleted file")
+	}
+
+	// process skips files that are no longer pending without touching storage
+	if err := p.process(ctx, "7:a"); err != nil {
+		t.Errorf("process() of a scanned file error = %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go-backend/internal/quota"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/redis/go-redis/v9"
+)
+
+const downloadURLExpiry = 15 * time.Minute
+
+type FileService struct {
+	redisClient  *redis.Client
+	minioClient  *minio.Client
+	bucket       string
+	quotaService *quota.QuotaService
+	scanPipeline *ScanPipeline
+}
+
+func NewFileService(redisClient *redis.Client, minioClient *minio.Client, bucket string, quotaService *quota.QuotaService, scanPipeline *ScanPipeline) *FileService {
+	return &FileService{
+		redisClient:  redisClient,
+		minioClient:  minioClient,
+		bucket:       bucket,
+		quotaService: quotaService,
+		scanPipeline: scanPipeline,
+	}
+}
+
+func (s *FileService) UploadHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	role := c.Locals("role").(string)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "MISSING_FILE",
+			Message:   "File is required",
+		})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_REQUEST",
+			Message:   "Failed to read file",
+		})
+	}
+	defer file.Close()
+
+	ctx := context.Background()
+
+	err = s.quotaService.Reserve(ctx, userId, role, fileHeader.Size, 1)
+	if errors.Is(err, quota.ErrQuotaExceeded) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(shared.ErrorResponse{
+			ErrorCode: "QUOTA_EXCEEDED",
+			Message:   "Storage quota exceeded",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "QUOTA_CHECK_FAILED",
+			Message:   "Failed to check storage quota",
+		})
+	}
+
+	info := FileInfo{
+		FileId:      uuid.New().String(),
+		Filename:    filepath.Base(fileHeader.Filename),
+		Size:        fileHeader.Size,
+		ContentType: fileHeader.Header.Get("Content-Type"),
+		UploadedAt:  time.Now().Unix(),
+		ScanStatus:  ScanPending,
+	}
+
+	// uploads stay in quarantine until the scan pipeline clears them
+	_, err = s.minioClient.PutObject(ctx, s.bucket, quarantineObjectName(userId, info.FileId), file, info.Size, minio.PutObjectOptions{
+		ContentType: info.ContentType,
+	})
+	if err != nil {
+		s.quotaService.Cancel(ctx, userId, info.Size, 1)
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "FILE_UPLOAD_FAILED",
+			Message:   "Failed to store file",
+		})
+	}
+
+	pipe := s.redisClient.TxPipeline()
+	pipe.HSet(ctx, fileKey(userId, info.FileId), map[string]interface{}{
+		"filename":    info.Filename,
+		"size":        info.Size,
+		"contentType": info.ContentType,
+		"uploadedAt":  info.UploadedAt,
+		"scanStatus":  info.ScanStatus,
+	})
+	pipe.SAdd(ctx, fileIndexKey(userId), info.FileId)
+	s.scanPipeline.Enqueue(ctx, pipe, userId, info.FileId)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.minioClient.RemoveObject(ctx, s.bucket, quarantineObjectName(userId, info.FileId), minio.RemoveObjectOptions{})
+		s.quotaService.Cancel(ctx, userId, info.Size, 1)
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "FILE_UPLOAD_FAILED",
+			Message:   "Failed to store file metadata",
+		})
+	}
+	s.quotaService.Commit(ctx, userId)
+
+	return c.Status(fiber.StatusAccepted).JSON(info)
+}
+
+func (s *FileService) GetHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	fileId := c.Params("fileId")
+	ctx := context.Background()
+
+	if _, err := uuid.Parse(fileId); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_FILE_ID",
+			Message:   "File id is invalid",
+		})
+	}
+
+	info, err := s.getFile(ctx, userId, fileId)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(shared.ErrorResponse{
+			ErrorCode: "FILE_NOT_FOUND",
+			Message:   "File not found",
+		})
+	}
+
+	response := fiber.Map{
+		"file": info,
+	}
+
+	// only scanned objects are ever handed out
+	if info.ScanStatus == ScanClean {
+		u, err := s.minioClient.PresignedGetObject(ctx, s.bucket, liveObjectName(userId, fileId), downloadURLExpiry, nil)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+				ErrorCode: "DOWNLOAD_URL_FAILED",
+				Message:   "Failed to create download URL",
+			})
+		}
+		response["downloadUrl"] = u.String()
+	}
+
+	return c.JSON(response)
+}
+
+func (s *FileService) ListHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	ctx := context.Background()
+
+	fileIds, err := s.redisClient.SMembers(ctx, fileIndexKey(userId)).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "FILE_LIST_FAILED",
+			Message:   "Failed to list files",
+		})
+	}
+
+	files := make([]FileInfo, 0, len(fileIds))
+	for _, fileId := range fileIds {
+		info, err := s.getFile(ctx, userId, fileId)
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+	}
+
+	return c.JSON(fiber.Map{
+		"files": files,
+	})
+}
+
+func (s *FileService) DeleteHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	fileId := c.Params("fileId")
+	ctx := context.Background()
+
+	if _, err := uuid.Parse(fileId); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_FILE_ID",
+			Message:   "File id is invalid",
+		})
+	}
+
+	info, err := s.getFile(ctx, userId, fileId)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(shared.ErrorResponse{
+			ErrorCode: "FILE_NOT_FOUND",
+			Message:   "File not found",
+		})
+	}
+
+	for _, name := range []string{liveObjectName(userId, fileId), quarantineObjectName(userId, fileId)} {
+		err = s.minioClient.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+				ErrorCode: "FILE_DELETE_FAILED",
+				Message:   "Failed to delete file",
+			})
+		}
+	}
+
+	// only the request that actually removed the metadata releases the quota,
+	// infected uploads were already released when the scanner removed them
+	pipe := s.redisClient.TxPipeline()
+	deleted := pipe.Del(ctx, fileKey(userId, fileId))
+	pipe.SRem(ctx, fileIndexKey(userId), fileId)
+	if _, err := pipe.Exec(ctx); err == nil && deleted.Val() > 0 && info.ScanStatus != ScanInfected {
+		s.quotaService.Release(ctx, userId, info.Size, 1)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "File deleted successfully",
+	})
+}
+
+func (s *FileService) getFile(ctx context.Context, userId, fileId string) (FileInfo, error) {
+	fileData, err := s.redisClient.HGetAll(ctx, fileKey(userId, fileId)).Result()
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if len(fileData) == 0 {
+		return FileInfo{}, fmt.Errorf("file %s not found", fileId)
+	}
+
+	size, _ := strconv.ParseInt(fileData["size"], 10, 64)
+	uploadedAt, _ := strconv.ParseInt(fileData["uploadedAt"], 10, 64)
+	scannedAt, _ := strconv.ParseInt(fileData["scannedAt"], 10, 64)
+
+	return FileInfo{
+		FileId:        fileId,
+		Filename:      fileData["filename"],
+		Size:          size,
+		ContentType:   fileData["contentType"],
+		UploadedAt:    uploadedAt,
+		ScanStatus:    fileData["scanStatus"],
+		ScanSignature: fileData["scanSignature"],
+		ScannedAt:     scannedAt,
+	}, nil
+}
+
+func liveObjectName(userId, fileId string) string {
+	return fmt.Sprintf("%sfiles/%s", quota.UserPrefix(userId), fileId)
+}
+
+func quarantineObjectName(userId, fileId string) string {
+	return fmt.Sprintf("%squarantine/%s", quota.UserPrefix(userId), fileId)
+}
+
+func fileKey(userId, fileId string) string {
+	return fmt.Sprintf("file:%s:%s", userId, fileId)
+}
+
+func fileIndexKey(userId string) string {
+	return fmt.Sprintf("files:%s", userId)
+}
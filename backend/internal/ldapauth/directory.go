@@ -0,0 +1,288 @@
+package ldapauth
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// the user authenticated but is in none of the mapped groups and there is no default role
+	ErrNoRole = errors.New("user has no role in the directory")
+)
+
+// Config of the directory. UserFilter is searched below BaseDN with {username} replaced by
+// the escaped login name, e.g. "(&(objectClass=user)(sAMAccountName={username}))" for AD.
+type Config struct {
+	URL      string
+	StartTLS bool
+	// nil uses the system roots for ldaps:// and StartTLS
+	TLSConfig *tls.Config
+
+	// service account searching for users, empty searches anonymously
+	BindDN       string
+	BindPassword string
+
+	BaseDN            string
+	UserFilter        string
+	UsernameAttribute string
+	EmailAttribute    string
+	GroupAttribute    string
+	// immutable id of the entry, entryUUID on OpenLDAP and objectGUID on AD. Entries without
+	// it are identified by their DN.
+	IDAttribute string
+
+	// first matching group wins, a user in none of them gets DefaultRole
+	GroupRoles  []GroupRole
+	DefaultRole string
+
+	PoolSize int
+	Timeout  time.Duration
+}
+
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// ParseGroupRoles parses semicolon separated "role=groupDN" entries, e.g.
+// "admin=cn=admins,ou=groups,dc=example,dc=com;user=cn=staff,ou=groups,dc=example,dc=com".
+// The order is the priority.
+func ParseGroupRoles(s string) ([]GroupRole, error) {
+	var mappings []GroupRole
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		role, group, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(role) == "" || strings.TrimSpace(group) == "" {
+			return nil, fmt.Errorf("invalid group role entry %q", entry)
+		}
+		mappings = append(mappings, GroupRole{Group: strings.TrimSpace(group), Role: strings.TrimSpace(role)})
+	}
+	return mappings, nil
+}
+
+// Identity is a user who authenticated against the directory
+type Identity struct {
+	// stable across logins, replicas and restarts, unlike the username it survives renames
+	ID       string
+	DN       string
+	Username string
+	Email    string
+	Groups   []string
+	Role     string
+}
+
+// Directory verifies passwords by binding as the user. Connections are pooled and bound as
+// the service account while idle.
+type Directory struct {
+	cfg  Config
+	pool chan *ldap.Conn
+}
+
+func New(cfg Config) *Directory {
+	if cfg.PoolSize < 1 {
+		cfg.PoolSize = 1
+	}
+	return &Directory{cfg: cfg, pool: make(chan *ldap.Conn, cfg.PoolSize)}
+}
+
+// Authenticate finds the user with UserFilter and binds with their password
+func (d *Directory) Authenticate(ctx context.Context, username, password string) (Identity, error) {
+	// an empty password is an unauthenticated bind, which servers accept for any DN
+	if username == "" || password == "" {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	conn, pooled, err := d.acquire()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	identity, err := d.authenticate(conn, username, password)
+	if pooled && ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		// the server dropped the idle connection, try once more on a new one
+		conn.Close()
+		if conn, err = d.dial(); err != nil {
+			return Identity{}, err
+		}
+		identity, err = d.authenticate(conn, username, password)
+	}
+	if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrNoRole) {
+		// the connection is fine, only the user failed
+		d.release(conn)
+		return Identity{}, err
+	}
+	if err != nil {
+		conn.Close()
+		return Identity{}, err
+	}
+
+	d.release(conn)
+	return identity, nil
+}
+
+func (d *Directory) authenticate(conn *ldap.Conn, username, password string) (Identity, error) {
+	filter := strings.ReplaceAll(d.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(d.cfg.Timeout.Seconds()), false, filter,
+		[]string{d.cfg.UsernameAttribute, d.cfg.EmailAttribute, d.cfg.GroupAttribute, d.cfg.IDAttribute},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return Identity{}, fmt.Errorf("ldap search: %w", err)
+	}
+	// unknown and ambiguous usernames look the same to the caller
+	if result == nil || len(result.Entries) != 1 {
+		return Identity{}, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return Identity{}, d.rebind(conn, ErrInvalidCredentials)
+		}
+		return Identity{}, fmt.Errorf("ldap bind: %w", err)
+	}
+
+	identity := Identity{
+		ID:       d.entryID(entry),
+		DN:       entry.DN,
+		Username: entry.GetAttributeValue(d.cfg.UsernameAttribute),
+		Email:    entry.GetAttributeValue(d.cfg.EmailAttribute),
+		Groups:   entry.GetAttributeValues(d.cfg.GroupAttribute),
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	identity.Role = d.role(identity.Groups)
+
+	// the pooled connection goes back bound as the service account
+	if identity.Role == "" {
+		return Identity{}, d.rebind(conn, ErrNoRole)
+	}
+	return identity, d.rebind(conn, nil)
+}
+
+// entryID reads IDAttribute, binary values such as objectGUID are hex encoded. Without it
+// the DN identifies the entry, DNs compare case-insensitively.
+func (d *Directory) entryID(entry *ldap.Entry) string {
+	if d.cfg.IDAttribute != "" {
+		if raw := entry.GetRawAttributeValue(d.cfg.IDAttribute); len(raw) > 0 {
+			if utf8.Valid(raw) && !strings.ContainsFunc(string(raw), unicode.IsControl) {
+				return d.cfg.IDAttribute + ":" + string(raw)
+			}
+			return d.cfg.IDAttribute + ":" + hex.EncodeToString(raw)
+		}
+	}
+	return "dn:" + strings.ToLower(entry.DN)
+}
+
+// role maps the user's groups, DNs compare case-insensitively
+func (d *Directory) role(groups []string) string {
+	for _, mapping := range d.cfg.GroupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(group, mapping.Group) {
+				return mapping.Role
+			}
+		}
+	}
+	return d.cfg.DefaultRole
+}
+
+// acquire takes an idle connection from the pool or dials a new one
+func (d *Directory) acquire() (*ldap.Conn, bool, error) {
+	select {
+	case conn := <-d.pool:
+		if !conn.IsClosing() {
+			return conn, true, nil
+		}
+	default:
+	}
+	conn, err := d.dial()
+	return conn, false, err
+}
+
+// release returns conn to the pool, or closes it when the pool is full
+func (d *Directory) release(conn *ldap.Conn) {
+	select {
+	case d.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (d *Directory) dial() (*ldap.Conn, error) {
+	options := []ldap.DialOpt{ldap.DialWithDialer(&net.Dialer{Timeout: d.cfg.Timeout})}
+	if d.cfg.TLSConfig != nil {
+		options = append(options, ldap.DialWithTLSConfig(d.cfg.TLSConfig))
+	}
+
+	conn, err := ldap.DialURL(d.cfg.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(d.cfg.Timeout)
+
+	if d.cfg.StartTLS {
+		tlsConfig := d.cfg.TLSConfig
+		if tlsConfig == nil {
+			u, err := url.Parse(d.cfg.URL)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			tlsConfig = &tls.Config{ServerName: u.Hostname()}
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+
+	if err := d.rebind(conn, nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// rebind binds conn as the service account again and returns result unless that fails
+func (d *Directory) rebind(conn *ldap.Conn, result error) error {
+	var err error
+	if d.cfg.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(d.cfg.BindDN, d.cfg.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("ldap service bind: %w", err)
+	}
+	return result
+}
+
+// Close closes the idle pooled connections
+func (d *Directory) Close() {
+	for {
+		select {
+		case conn := <-d.pool:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package ldapauth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	adminsGroup = "cn=admins,ou=groups,dc=example,dc=com"
+	staffGroup  = "cn=staff,ou=groups,dc=example,dc=com"
+)
+
+func TestAuthenticate(t *testing.T) {
+	server := newTestServer(t, "cn=svc,dc=example,dc=com", "svc-secret",
+		testEntry{
+			dn:       "uid=alice,ou=people,dc=example,dc=com",
+			password: "alice-pw",
+			attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"alice"},
+				"entryUUID":   {"6f1c2a4e-0d5b-4c8e-9a57-3b1f2e4d6c80"},
+				"mail":        {"alice@example.com"},
+				"memberOf":    {staffGroup, "CN=Admins,OU=Groups,DC=example,DC=com"},
+			},
+		},
+		testEntry{
+			dn:       "uid=bob,ou=people,dc=example,dc=com",
+			password: "bob-pw",
+			attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"bob"},
+				"memberOf":    {staffGroup},
+			},
+		},
+		testEntry{
+			dn:       "uid=carol,ou=people,dc=example,dc=com",
+			password: "carol-pw",
+			attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"carol"},
+			},
+		},
+	)
+
+	// a pool of one makes every attempt reuse the connection of the previous one
+	directory := New(Config{
+		URL:               server.URL(),
+		BindDN:            "cn=svc,dc=example,dc=com",
+		BindPassword:      "svc-secret",
+		BaseDN:            "dc=example,dc=com",
+		UserFilter:        "(&(objectClass=person)(uid={username}))",
+		UsernameAttribute: "uid",
+		EmailAttribute:    "mail",
+		GroupAttribute:    "memberOf",
+		IDAttribute:       "entryUUID",
+		GroupRoles:        []GroupRole{{Group: adminsGroup, Role: "admin"}, {Group: staffGroup, Role: "user"}},
+		PoolSize:          1,
+		Timeout:           5 * time.Second,
+	})
+	defer directory.Close()
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     Identity
+		wantErr  error
+	}{
+		{
+			name:     "Admin group wins over staff, DNs compare case-insensitively",
+			username: "alice", password: "alice-pw",
+			want: Identity{
+				ID: "entryUUID:6f1c2a4e-0d5b-4c8e-9a57-3b1f2e4d6c80",
+				DN: "uid=alice,ou=people,dc=example,dc=com", Username: "alice", Email: "alice@example.com",
+				Groups: []string{staffGroup, "CN=Admins,OU=Groups,DC=example,DC=com"}, Role: "admin",
+			},
+		},
+		{name: "Wrong password", username: "alice", password: "nope", wantErr: ErrInvalidCredentials},
+		{
+			name:     "Staff member after a failed bind, identified by DN without entryUUID",
+			username: "bob", password: "bob-pw",
+			want: Identity{ID: "dn:uid=bob,ou=people,dc=example,dc=com", DN: "uid=bob,ou=people,dc=example,dc=com", Username: "bob", Groups: []string{staffGroup}, Role: "user"},
+		},
+		{name: "Empty password is not an anonymous bind", username: "bob", password: "", wantErr: ErrInvalidCredentials},
+		{name: "Unknown user", username: "mallory", password: "x", wantErr: ErrInvalidCredentials},
+		{name: "Filter characters are escaped", username: "*", password: "alice-pw", wantErr: ErrInvalidCredentials},
+		{name: "No mapped group and no default role", username: "carol", password: "carol-pw", wantErr: ErrNoRole},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := directory.Authenticate(context.Background(), tt.username, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authenticate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGroupRoles(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []GroupRole
+		wantErr bool
+	}{
+		{name: "Empty", input: ""},
+		{
+			name:  "Ordered mappings",
+			input: "admin=" + adminsGroup + "; user=" + staffGroup,
+			want:  []GroupRole{{Group: adminsGroup, Role: "admin"}, {Group: staffGroup, Role: "user"}},
+		},
+		{name: "Missing group", input: "admin=", wantErr: true},
+		{name: "Missing role", input: "=" + adminsGroup, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGroupRoles(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGroupRoles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseGroupRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
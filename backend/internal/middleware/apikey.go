@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-backend/internal/apikey"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiKeyAuth authenticates "Authorization: ApiKey <key>". Keys have no session, so the
+// lock screen and idle handling do not apply, and they only reach routes of their scopes.
+// The role is the owner's current one, a demoted owner's keys lose what the role allowed.
+func apiKeyAuth(c *fiber.Ctx, keys *apikey.Store, presented, scope string) error {
+	key, err := keys.Verify(context.Background(), presented, time.Now())
+	if errors.Is(err, apikey.ErrInvalidKey) {
+		return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_API_KEY",
+			Message:   "API key is invalid or expired",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "API_KEY_VERIFICATION_FAILED",
+			Message:   "Failed to verify API key",
+		})
+	}
+
+	if scope == "" || !key.HasScope(scope) {
+		return c.Status(fiber.StatusForbidden).JSON(shared.ErrorResponse{
+			ErrorCode: "INSUFFICIENT_SCOPE",
+			Message:   "API key is not valid for this resource",
+		})
+	}
+
+	c.Locals("userId", key.OwnerID)
+	c.Locals("username", key.OwnerName)
+	c.Locals("role", key.Role)
+	c.Locals("scope", key.Scope)
+	c.Locals("sessionId", "")
+	c.Locals("tokenId", "")
+	c.Locals("apiKeyId", key.ID)
+
+	return c.Next()
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ValidCSRF compares the CSRF header against the token stored with the session. A session
+// without a token (bearer transport) never validates.
+func ValidCSRF(c *fiber.Ctx, expected string) bool {
+	header := c.Get(shared.CSRFHeader)
+	return expected != "" && subtle.ConstantTimeCompare([]byte(header), []byte(expected)) == 1
+}
+
+func isSafeMethod(method string) bool {
+	return method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+}
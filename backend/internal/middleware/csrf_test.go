@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestValidCSRF(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+		want     bool
+	}{
+		{name: "Matching token", header: "abc123", expected: "abc123", want: true},
+		{name: "Wrong token", header: "abc124", expected: "abc123", want: false},
+		{name: "Missing header", header: "", expected: "abc123", want: false},
+		{name: "Bearer session without token", header: "", expected: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/", func(c *fiber.Ctx) error {
+				if ValidCSRF(c, tt.expected) {
+					return c.SendStatus(fiber.StatusOK)
+				}
+				return c.SendStatus(fiber.StatusForbidden)
+			})
+
+			req := httptest.NewRequest(fiber.MethodPost, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(shared.CSRFHeader, tt.header)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.StatusCode == fiber.StatusOK; got != tt.want {
+				t.Errorf("ValidCSRF() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
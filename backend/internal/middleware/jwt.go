@@ -2,8 +2,12 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"go-backend/internal/apikey"
 	"go-backend/internal/config"
+	"go-backend/internal/session"
 	"go-backend/internal/shared"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -14,57 +18,118 @@ import (
 )
 
 func AuthMiddleware(redisClient *redis.Client) fiber.Handler {
+	return authMiddleware(redisClient, "")
+}
+
+// ScopedAuthMiddleware additionally accepts tokens issued to OAuth clients and API keys
+// granted scope. OAuth tokens still belong to the user's session and follow its lock state.
+func ScopedAuthMiddleware(redisClient *redis.Client, scope string) fiber.Handler {
+	return authMiddleware(redisClient, scope)
+}
+
+func authMiddleware(redisClient *redis.Client, scope string) fiber.Handler {
+	keys := apikey.NewStore(redisClient)
+
 	return func(c *fiber.Ctx) error {
-		cfg := config.GetConfig()
-		JWT_SECRET := []byte(cfg.Secrets.JWT_SECRET)
 		authHeader := c.Get("Authorization")
 
-		if authHeader == "" {
+		// without a bearer header the token may come from the cookie transport
+		tokenString := c.Cookies(shared.AccessTokenCookie)
+		fromCookie := authHeader == "" && tokenString != ""
+
+		if authHeader == "" && !fromCookie {
 			return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
 				ErrorCode: "MISSING_TOKEN",
 				Message:   "Authorization token is required",
 			})
 		}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
-				ErrorCode: "INVALID_TOKEN_FORMAT",
-				Message:   "Authorization token format is invalid",
-			})
+		if !fromCookie {
+			parts := strings.SplitN(authHeader, " ", 2)
+			if len(parts) == 2 && parts[0] == "ApiKey" {
+				return apiKeyAuth(c, keys, parts[1], scope)
+			}
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+					ErrorCode: "INVALID_TOKEN_FORMAT",
+					Message:   "Authorization token format is invalid",
+				})
+			}
+			tokenString = parts[1]
 		}
 
-		tokenString := parts[1]
 		claims := &shared.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return JWT_SECRET, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, claims, config.JWTKeyFunc)
 
-		if err != nil || !token.Valid {
+		if err != nil || !token.Valid || claims.TokenType == shared.TokenTypeRefresh {
 			return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
 				ErrorCode: "INVALID_OR_EXPIRED_TOKEN",
 				Message:   "Authorization token is invalid or expired",
 			})
 		}
 
-		// check of session exists in redis
-		sessionKey := "session:" + claims.UserID
-		sessionData, err := redisClient.HGetAll(context.Background(), sessionKey).Result()
-		if err != nil || len(sessionData) == 0 {
-			return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
-				ErrorCode: "SESSION_NOT_FOUND",
-				Message:   "User session not found or has expired",
+		// individually revoked tokens
+		if claims.ID != "" {
+			if denied, err := session.IsTokenDenied(context.Background(), redisClient, claims.ID); err != nil || denied {
+				return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+					ErrorCode: "TOKEN_REVOKED",
+					Message:   "Authorization token has been revoked",
+				})
+			}
+		}
+
+		// tokens of OAuth clients only reach the routes their scope was granted for
+		if claims.ClientID != "" && (scope == "" || !slices.Contains(strings.Fields(claims.Scope), scope)) {
+			return c.Status(fiber.StatusForbidden).JSON(shared.ErrorResponse{
+				ErrorCode: "INSUFFICIENT_SCOPE",
+				Message:   "Token is not valid for this resource",
 			})
 		}
 
+		// tokens of the client_credentials grant act for the client itself and have no session
+		if claims.UserID == "" && claims.ClientID != "" {
+			return clientAuth(c, claims)
+		}
+
+		// check of session exists in redis
+		sessionData, err := redisClient.HGetAll(context.Background(), session.Key(claims.UserID)).Result()
+		if err != nil || len(sessionData) == 0 || !session.SameSession(sessionData, claims.SessionID) {
+			return sessionNotFound(c)
+		}
+
+		// cookies are sent by the browser on any request, state changes need the session's CSRF token
+		if fromCookie && !isSafeMethod(c.Method()) {
+			if !ValidCSRF(c, sessionData["csrfToken"]) {
+				return c.Status(fiber.StatusForbidden).JSON(shared.ErrorResponse{
+					ErrorCode: "INVALID_CSRF_TOKEN",
+					Message:   "CSRF token is missing or invalid",
+				})
+			}
+		}
+
+		policy := session.PolicyFor(claims.Role)
+
+		// lock an idle session server-side, the lock timeout counts from when it went idle
+		if lockAt, idle := session.IdleLockAt(sessionData, policy, time.Now()); idle {
+			err := session.Lock(context.Background(), redisClient, claims.UserID, lockAt)
+			if errors.Is(err, session.ErrNotFound) {
+				return sessionNotFound(c)
+			}
+			if err == nil {
+				sessionData["locked"] = "true"
+				sessionData["lockedAt"] = strconv.FormatInt(lockAt.Unix(), 10)
+			}
+		}
+
 		// check if session is locked
-		isLocked := sessionData["locked"] == "1" || sessionData["locked"] == "true"
+		isLocked := session.IsLocked(sessionData)
 
 		// allow access only to unlock route if session is locked
 		allowedWhenLocked := []string{
 			"/auth/unlock",
 			"/auth/check-session",
 			"/auth/logout",
+			"/auth/events",
 		}
 
 		path := c.Path()
@@ -77,19 +142,13 @@ func AuthMiddleware(redisClient *redis.Client) fiber.Handler {
 		}
 
 		if isLocked && !isAllowedPath {
-			// check lock over 10 minutes
-			if lockedAtStr, exists := sessionData["lockedAt"]; exists {
-				lockedAt, _ := strconv.ParseInt(lockedAtStr, 10, 64)
-				lockDuration := time.Now().Unix() - lockedAt
-
-				if lockDuration > 600 {
-					// delete session
-					deleteUserSession(redisClient, claims.UserID)
-					return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
-						ErrorCode: "LOCK_TIMEOUT",
-						Message:   "Session expire due to inactivity. Please login again.",
-					})
-				}
+			// check lock timeout
+			if session.LockRemaining(sessionData, policy, time.Now()) < 0 {
+				session.Revoke(context.Background(), redisClient, claims.UserID, session.ReasonLockTimeout)
+				return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+					ErrorCode: "LOCK_TIMEOUT",
+					Message:   "Session expire due to inactivity. Please login again.",
+				})
 			}
 
 			return c.Status(fiber.StatusForbidden).JSON(shared.ErrorResponse{
@@ -98,24 +157,61 @@ func AuthMiddleware(redisClient *redis.Client) fiber.Handler {
 			})
 		}
 
+		// a locked session is idle, only activity on an unlocked session extends it. Session
+		// checks are polled by the client and do not count as activity.
+		if !isLocked && !isAllowedPath {
+			err = session.Touch(context.Background(), redisClient, claims.UserID, sessionData, policy)
+			if errors.Is(err, session.ErrExpired) {
+				session.Revoke(context.Background(), redisClient, claims.UserID, session.ReasonExpired)
+				return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+					ErrorCode: "SESSION_EXPIRED",
+					Message:   "Session has expired, please login again",
+				})
+			}
+			// revoked since it was read, whoever revoked it told the tabs
+			if errors.Is(err, session.ErrNotFound) {
+				return sessionNotFound(c)
+			}
+		}
+
 		// store user information in context locals
 		c.Locals("userId", claims.UserID)
 		c.Locals("username", claims.Username)
+		c.Locals("role", claims.Role)
+		c.Locals("scope", claims.Scope)
+		c.Locals("sessionId", claims.SessionID)
+		c.Locals("tokenId", claims.ID)
+		if claims.ExpiresAt != nil {
+			c.Locals("tokenExpiresAt", claims.ExpiresAt.Time)
+		}
 
 		return c.Next()
 	}
 }
 
-// Helper function
-func deleteUserSession(redisClient *redis.Client, userId string) {
-	// ลบ refresh tokens
-	pattern := "refresh_token:" + userId + ":*"
-	keys, err := redisClient.Keys(context.Background(), pattern).Result()
-	if err == nil && len(keys) > 0 {
-		redisClient.Del(context.Background(), keys...)
+// clientPrefix marks the user ID an OAuth client acts as with its own tokens, so its files and
+// quota are its own and never a user's
+const clientPrefix = "client-"
+
+// clientAuth admits a client_credentials token. Like API keys the lock screen and idle handling
+// do not apply, the token's scope was checked already and its role is the client's.
+func clientAuth(c *fiber.Ctx, claims *shared.Claims) error {
+	c.Locals("userId", clientPrefix+claims.ClientID)
+	c.Locals("username", claims.ClientID)
+	c.Locals("role", claims.Role)
+	c.Locals("scope", claims.Scope)
+	c.Locals("sessionId", "")
+	c.Locals("tokenId", claims.ID)
+	if claims.ExpiresAt != nil {
+		c.Locals("tokenExpiresAt", claims.ExpiresAt.Time)
 	}
 
-	// ลบ session
-	sessionKey := "session:" + userId
-	redisClient.Del(context.Background(), sessionKey)
+	return c.Next()
+}
+
+func sessionNotFound(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(shared.ErrorResponse{
+		ErrorCode: "SESSION_NOT_FOUND",
+		Message:   "User session not found or has expired",
+	})
 }
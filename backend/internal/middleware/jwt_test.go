@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-backend/internal/config"
+	"go-backend/internal/session"
+	"go-backend/internal/shared"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+func loadTestConfig(t *testing.T) {
+	t.Helper()
+	for name, value := range map[string]string{
+		"APP_ENV":             "test",
+		"SECRET_PROVIDERS":    "env",
+		"REDIS_HOST":          "localhost",
+		"MINIO_HOST":          "localhost",
+		"MINIO_BUCKET":        "test",
+		"JWT_SECRET":          "test-jwt-secret",
+		"MINIO_ROOT_USER":     "test",
+		"MINIO_ROOT_PASSWORD": "test-password",
+	} {
+		t.Setenv(name, value)
+	}
+
+	config.InitConfig()
+	if _, err := config.LoadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := config.NewSecretChain(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadSecrets(chain); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.LoadPolicies(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScopedAuthMiddleware_ClientCredentials(t *testing.T) {
+	loadTestConfig(t)
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	app := fiber.New()
+	whoami := func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"userId":    c.Locals("userId"),
+			"username":  c.Locals("username"),
+			"role":      c.Locals("role"),
+			"sessionId": c.Locals("sessionId"),
+		})
+	}
+	app.Get("/files", ScopedAuthMiddleware(redisClient, shared.ScopeFiles), whoami)
+	app.Get("/admin", ScopedAuthMiddleware(redisClient, shared.ScopeAdmin), RequireRole("admin"), whoami)
+
+	sign := func(claims shared.Claims) string {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+		token, err := config.SignJWT(&claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		claims     shared.Claims
+		wantStatus int
+		wantUserID string
+	}{
+		{
+			name:       "Client token on a route of its scope",
+			path:       "/files",
+			claims:     shared.Claims{Role: "user", ClientID: "reports", Scope: "files"},
+			wantStatus: fiber.StatusOK, wantUserID: "client-reports",
+		},
+		{
+			name:       "Client token outside its scope",
+			path:       "/admin",
+			claims:     shared.Claims{Role: "admin", ClientID: "reports", Scope: "files"},
+			wantStatus: fiber.StatusForbidden,
+		},
+		{
+			name:       "Client token without the role",
+			path:       "/admin",
+			claims:     shared.Claims{Role: "user", ClientID: "reports", Scope: "admin"},
+			wantStatus: fiber.StatusForbidden,
+		},
+		{
+			name:       "Admin client token",
+			path:       "/admin",
+			claims:     shared.Claims{Role: "admin", ClientID: "ops", Scope: "admin"},
+			wantStatus: fiber.StatusOK, wantUserID: "client-ops",
+		},
+		{
+			name:       "User token still needs its session",
+			path:       "/files",
+			claims:     shared.Claims{UserID: "u1", Username: "alice", Role: "user", SessionID: "s1", ClientID: "reports", Scope: "files"},
+			wantStatus: fiber.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+sign(tt.claims))
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != fiber.StatusOK {
+				return
+			}
+
+			var got map[string]string
+			json.NewDecoder(resp.Body).Decode(&got)
+			if got["userId"] != tt.wantUserID || got["role"] != tt.claims.Role || got["sessionId"] != "" {
+				t.Errorf("locals = %v, want userId %s, role %s and no session", got, tt.wantUserID, tt.claims.Role)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"slices"
+
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole must run after AuthMiddleware and only lets the given roles through
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if !slices.Contains(roles, role) {
+			return c.Status(fiber.StatusForbidden).JSON(shared.ErrorResponse{
+				ErrorCode: "INSUFFICIENT_ROLE",
+				Message:   "You do not have permission to access this resource",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireSession must run after a scoped AuthMiddleware and turns away OAuth client tokens and
+// API keys, for routes that should need the user's own login even where a scope reaches
+func RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if scope, _ := c.Locals("scope").(string); scope != "" {
+			return c.Status(fiber.StatusForbidden).JSON(shared.ErrorResponse{
+				ErrorCode: "SESSION_REQUIRED",
+				Message:   "This resource requires signing in",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,30 @@
+package notify
+
+import "errors"
+
+// templates of the messages we send
+const (
+	TemplatePasswordChanged = "password_changed"
+)
+
+var ErrUnknownTemplate = errors.New("unknown notification template")
+
+// Message is a queued notification. It is rendered when sent, so a message that waited for
+// retries uses the templates of the process sending it.
+type Message struct {
+	ID        string            `json:"id"`
+	To        string            `json:"to"`
+	Template  string            `json:"template"`
+	Locale    string            `json:"locale"`
+	Data      map[string]string `json:"data"`
+	Attempts  int               `json:"attempts"`
+	CreatedAt int64             `json:"createdAt"`
+	LastError string            `json:"lastError,omitempty"`
+}
+
+// Content is a rendered message
+type Content struct {
+	Subject string
+	Text    string
+	HTML    string
+}
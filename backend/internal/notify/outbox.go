@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// message ids scored by when they are due, in unix milliseconds
+	queueKey = "notify_queue"
+	// message ids being sent, scored by when their lease runs out
+	processingKey = "notify_queue:processing"
+	// messages that used up their attempts, kept for inspection
+	deadKey = "notify_dead"
+	// how often each queued message was claimed, a claim whose worker died counts too
+	claimsKey = "notify_claims"
+
+	pollInterval = time.Second
+)
+
+// claimScript moves the next due message to processing with a lease, so a message is sent
+// by one worker at a time, and returns its id and which attempt this claim is
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 1)
+if #ids == 0 then
+	return false
+end
+redis.call('ZREM', KEYS[1], ids[1])
+redis.call('ZADD', KEYS[2], ARGV[2], ids[1])
+return {ids[1], redis.call('HINCRBY', KEYS[3], ids[1], 1)}
+`)
+
+// recoverScript puts messages whose lease ran out back in the queue, their worker died mid-send
+var recoverScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('ZADD', KEYS[1], ARGV[1], id)
+end
+return #ids
+`)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	// delay after the first failure, doubled for every further one up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// how long a worker may take to send before the message is handed to another one
+	Lease time.Duration
+}
+
+// Delay is the backoff before attempt+1, after attempt failed attempts
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Outbox queues notifications in Redis and sends them in the background. A queued message
+// survives the process dying before or while it is sent. Callers enqueue into their own
+// transaction, so it commits together with the Redis writes of that transaction. A change
+// stored outside Redis is committed first, and a crash before the enqueue loses its notice.
+type Outbox struct {
+	redisClient *redis.Client
+	templates   *Templates
+	sender      Sender
+	retry       RetryPolicy
+}
+
+func NewOutbox(redisClient *redis.Client, templates *Templates, sender Sender, retry RetryPolicy) *Outbox {
+	return &Outbox{
+		redisClient: redisClient,
+		templates:   templates,
+		sender:      sender,
+		retry:       retry,
+	}
+}
+
+// Enqueue adds msg to pipe, to be sent once the caller's transaction commits
+func (o *Outbox) Enqueue(ctx context.Context, pipe redis.Pipeliner, msg Message) error {
+	msg.ID = uuid.New().String()
+	msg.CreatedAt = time.Now().Unix()
+	msg.Attempts = 0
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	pipe.Set(ctx, messageKey(msg.ID), data, 0)
+	pipe.ZAdd(ctx, queueKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: msg.ID})
+	return nil
+}
+
+func (o *Outbox) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go o.worker(ctx)
+	}
+
+	log.Printf("✓ Notification outbox started with %d workers", workers)
+}
+
+func (o *Outbox) worker(ctx context.Context) {
+	for {
+		now := time.Now()
+		if err := o.recoverExpired(ctx, now); err != nil && ctx.Err() == nil {
+			log.Printf("Notification lease recovery failed: %v", err)
+		}
+
+		id, attempt, err := o.claim(ctx, now)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				log.Printf("Notification queue read failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		if err := o.process(ctx, id, attempt); err != nil {
+			log.Printf("Notification %s failed: %v", id, err)
+		}
+	}
+}
+
+// recoverExpired puts messages whose lease ran out by now back in the queue
+func (o *Outbox) recoverExpired(ctx context.Context, now time.Time) error {
+	return recoverScript.Run(ctx, o.redisClient, []string{queueKey, processingKey}, now.UnixMilli()).Err()
+}
+
+// claim leases the next message due by now, redis.Nil when there is none
+func (o *Outbox) claim(ctx context.Context, now time.Time) (string, int, error) {
+	result, err := claimScript.Run(ctx, o.redisClient, []string{queueKey, processingKey, claimsKey},
+		now.UnixMilli(), now.Add(o.retry.Lease).UnixMilli()).Slice()
+	if err != nil {
+		return "", 0, err
+	}
+	if len(result) != 2 {
+		return "", 0, fmt.Errorf("unexpected claim result %v", result)
+	}
+	id, _ := result[0].(string)
+	attempt, _ := result[1].(int64)
+	return id, int(attempt), nil
+}
+
+// process makes attempt, counted by claims, at sending the message id
+func (o *Outbox) process(ctx context.Context, id string, attempt int) error {
+	data, err := o.redisClient.Get(ctx, messageKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		pipe := o.redisClient.TxPipeline()
+		pipe.ZRem(ctx, processingKey, id)
+		pipe.HDel(ctx, claimsKey, id)
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return o.bury(ctx, Message{ID: id, Attempts: attempt}, fmt.Errorf("malformed message: %w", err))
+	}
+	msg.Attempts = attempt
+
+	// the previous claims never finished, a message crashing or hanging its worker must not be
+	// retried forever
+	if attempt > o.retry.MaxAttempts {
+		return o.bury(ctx, msg, fmt.Errorf("lease expired on the last attempt, last error: %q", msg.LastError))
+	}
+
+	content, err := o.templates.Render(msg.Template, msg.Locale, msg.Data)
+	if err != nil {
+		// a template problem does not go away by retrying
+		return o.bury(ctx, msg, err)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, o.retry.Lease)
+	err = o.sender.Send(sendCtx, msg.To, content)
+	cancel()
+	if err != nil {
+		return o.fail(ctx, msg, err)
+	}
+
+	pipe := o.redisClient.TxPipeline()
+	pipe.Del(ctx, messageKey(id))
+	pipe.ZRem(ctx, processingKey, id)
+	pipe.HDel(ctx, claimsKey, id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// fail schedules the next attempt with backoff, or buries the message once it used them all
+func (o *Outbox) fail(ctx context.Context, msg Message, sendErr error) error {
+	msg.LastError = sendErr.Error()
+	if msg.Attempts >= o.retry.MaxAttempts {
+		return o.bury(ctx, msg, sendErr)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	next := time.Now().Add(o.retry.Delay(msg.Attempts))
+
+	pipe := o.redisClient.TxPipeline()
+	pipe.Set(ctx, messageKey(msg.ID), data, 0)
+	pipe.ZRem(ctx, processingKey, msg.ID)
+	pipe.ZAdd(ctx, queueKey, redis.Z{Score: float64(next.UnixMilli()), Member: msg.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return fmt.Errorf("attempt %d, retrying at %s: %w", msg.Attempts, next.Format(time.RFC3339), sendErr)
+}
+
+func (o *Outbox) bury(ctx context.Context, msg Message, cause error) error {
+	msg.LastError = cause.Error()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	pipe := o.redisClient.TxPipeline()
+	pipe.LPush(ctx, deadKey, data)
+	pipe.Del(ctx, messageKey(msg.ID))
+	pipe.ZRem(ctx, processingKey, msg.ID)
+	pipe.HDel(ctx, claimsKey, msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", msg.Attempts, cause)
+}
+
+func messageKey(id string) string {
+	return fmt.Sprintf("notify_message:%s", id)
+}
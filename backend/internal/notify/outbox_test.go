@@ -0,0 +1,254 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 30 * time.Second, MaxDelay: 10 * time.Minute}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 30 * time.Second},
+		{attempt: 2, want: time.Minute},
+		{attempt: 4, want: 4 * time.Minute},
+		{attempt: 6, want: 10 * time.Minute},
+		{attempt: 100, want: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want.String(), func(t *testing.T) {
+			if got := policy.Delay(tt.attempt); got != tt.want {
+				t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeSender struct {
+	err  error
+	sent []string
+}
+
+func (f *fakeSender) Send(ctx context.Context, to string, content Content) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, to+": "+content.Subject)
+	return nil
+}
+
+func newTestOutbox(t *testing.T, sender Sender, maxAttempts int) (*Outbox, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	templates, err := LoadTemplates("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewOutbox(redisClient, templates, sender, RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    10 * time.Minute,
+		Lease:       time.Minute,
+	}), mr
+}
+
+func enqueue(t *testing.T, o *Outbox, template string) string {
+	t.Helper()
+	ctx := context.Background()
+	pipe := o.redisClient.TxPipeline()
+	err := o.Enqueue(ctx, pipe, Message{
+		To:       "alice@example.com",
+		Template: template,
+		Locale:   "en",
+		Data:     map[string]string{"Username": "alice", "Time": "now", "IP": "10.0.0.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, _ := o.redisClient.ZRange(ctx, queueKey, 0, -1).Result()
+	return ids[len(ids)-1]
+}
+
+func deadMessages(t *testing.T, o *Outbox) []Message {
+	t.Helper()
+	var dead []Message
+	entries, _ := o.redisClient.LRange(context.Background(), deadKey, 0, -1).Result()
+	for _, entry := range entries {
+		var msg Message
+		if err := json.Unmarshal([]byte(entry), &msg); err != nil {
+			t.Fatal(err)
+		}
+		dead = append(dead, msg)
+	}
+	return dead
+}
+
+func TestOutbox_Claim(t *testing.T) {
+	ctx := context.Background()
+	o, mr := newTestOutbox(t, &fakeSender{}, 3)
+	now := time.Now()
+
+	if _, _, err := o.claim(ctx, now); !errors.Is(err, redis.Nil) {
+		t.Fatalf("claim() on an empty queue error = %v, want redis.Nil", err)
+	}
+
+	id := enqueue(t, o, TemplatePasswordChanged)
+	claimed, attempt, err := o.claim(ctx, now.Add(time.Second))
+	if err != nil || claimed != id || attempt != 1 {
+		t.Fatalf("claim() = %q, %d, %v, want %q, 1", claimed, attempt, err, id)
+	}
+	if mr.Exists(queueKey) {
+		t.Error("claimed message is still queued")
+	}
+	lease, _ := mr.ZScore(processingKey, id)
+	if want := float64(now.Add(time.Second + time.Minute).UnixMilli()); lease != want {
+		t.Errorf("lease = %v, want %v", lease, want)
+	}
+
+	// a leased message is not handed to a second worker
+	if _, _, err := o.claim(ctx, now.Add(2*time.Second)); !errors.Is(err, redis.Nil) {
+		t.Errorf("second claim() error = %v, want redis.Nil", err)
+	}
+}
+
+func TestOutbox_DeliveredMessageIsDeleted(t *testing.T) {
+	ctx := context.Background()
+	sender := &fakeSender{}
+	o, mr := newTestOutbox(t, sender, 3)
+
+	id := enqueue(t, o, TemplatePasswordChanged)
+	_, attempt, err := o.claim(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.process(ctx, id, attempt); err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+
+	if len(sender.sent) != 1 || sender.sent[0] != "alice@example.com: Your password was changed" {
+		t.Errorf("sent = %q, want the rendered message once", sender.sent)
+	}
+	for _, key := range []string{messageKey(id), queueKey, processingKey, claimsKey} {
+		if mr.Exists(key) {
+			t.Errorf("%s left behind after delivery", key)
+		}
+	}
+}
+
+func TestOutbox_RetryAndBury(t *testing.T) {
+	ctx := context.Background()
+	sender := &fakeSender{err: errors.New("relay unavailable")}
+	o, mr := newTestOutbox(t, sender, 2)
+	id := enqueue(t, o, TemplatePasswordChanged)
+
+	// first failure: back in the queue after the base delay
+	_, attempt, _ := o.claim(ctx, time.Now())
+	before := time.Now()
+	if err := o.process(ctx, id, attempt); err == nil {
+		t.Fatal("process() error = nil, want the send error")
+	}
+	due, err := mr.ZScore(queueKey, id)
+	if err != nil {
+		t.Fatalf("message not requeued: %v", err)
+	}
+	if earliest := float64(before.Add(30 * time.Second).UnixMilli()); due < earliest || due > earliest+1000 {
+		t.Errorf("due = %v, want about %v", due, earliest)
+	}
+	if mr.Exists(processingKey) {
+		t.Error("failed message still leased")
+	}
+	var msg Message
+	data, _ := mr.Get(messageKey(id))
+	json.Unmarshal([]byte(data), &msg)
+	if msg.Attempts != 1 || msg.LastError != "relay unavailable" {
+		t.Errorf("stored message = %+v, want attempt 1 with the error", msg)
+	}
+
+	// not due before the backoff has passed
+	if _, _, err := o.claim(ctx, time.Now()); !errors.Is(err, redis.Nil) {
+		t.Errorf("claim() before the backoff error = %v, want redis.Nil", err)
+	}
+
+	// second failure uses up the attempts
+	_, attempt, _ = o.claim(ctx, time.Now().Add(time.Minute))
+	if attempt != 2 {
+		t.Fatalf("attempt = %d, want 2", attempt)
+	}
+	o.process(ctx, id, attempt)
+
+	dead := deadMessages(t, o)
+	if len(dead) != 1 || dead[0].ID != id || dead[0].Attempts != 2 || dead[0].LastError != "relay unavailable" {
+		t.Errorf("dead = %+v, want the message after 2 attempts", dead)
+	}
+	for _, key := range []string{messageKey(id), queueKey, processingKey, claimsKey} {
+		if mr.Exists(key) {
+			t.Errorf("%s left behind after burying", key)
+		}
+	}
+}
+
+func TestOutbox_UnknownTemplateIsBuried(t *testing.T) {
+	ctx := context.Background()
+	sender := &fakeSender{}
+	o, _ := newTestOutbox(t, sender, 5)
+
+	id := enqueue(t, o, "welcome")
+	_, attempt, _ := o.claim(ctx, time.Now())
+	if err := o.process(ctx, id, attempt); !errors.Is(err, ErrUnknownTemplate) {
+		t.Fatalf("process() error = %v, want ErrUnknownTemplate", err)
+	}
+	if dead := deadMessages(t, o); len(dead) != 1 || len(sender.sent) != 0 {
+		t.Errorf("dead = %+v, sent %q, want buried without sending", dead, sender.sent)
+	}
+}
+
+func TestOutbox_RecoverExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	sender := &fakeSender{}
+	o, mr := newTestOutbox(t, sender, 2)
+	id := enqueue(t, o, TemplatePasswordChanged)
+	now := time.Now()
+
+	// every claim's worker dies before finishing
+	for attempt := 1; attempt <= 2; attempt++ {
+		claimedAt := now.Add(time.Duration(attempt) * 2 * time.Minute)
+		if _, got, err := o.claim(ctx, claimedAt); err != nil || got != attempt {
+			t.Fatalf("claim() attempt = %d, %v, want %d", got, err, attempt)
+		}
+
+		o.recoverExpired(ctx, claimedAt.Add(time.Minute-time.Millisecond))
+		if !mr.Exists(processingKey) {
+			t.Fatal("message recovered before its lease ran out")
+		}
+		o.recoverExpired(ctx, claimedAt.Add(time.Minute))
+		if mr.Exists(processingKey) {
+			t.Fatal("expired lease not recovered")
+		}
+	}
+
+	// the claim after the last attempt buries the message instead of sending it again
+	_, attempt, _ := o.claim(ctx, now.Add(10*time.Minute))
+	if err := o.process(ctx, id, attempt); err == nil {
+		t.Fatal("process() error = nil, want the message given up")
+	}
+	if dead := deadMessages(t, o); len(dead) != 1 || dead[0].Attempts != 3 || len(sender.sent) != 0 {
+		t.Errorf("dead = %+v, sent %q, want buried after the expired attempts without sending", dead, sender.sent)
+	}
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	content := Content{Subject: "รหัสผ่าน changed", Text: "plain body", HTML: "<p>html body</p>"}
+
+	tests := []struct {
+		name    string
+		to      string
+		wantErr bool
+	}{
+		{name: "Valid recipient", to: "alice@example.com"},
+		{name: "Named recipient", to: "Alice <alice@example.com>"},
+		{name: "Header injection", to: "alice@example.com\r\nBcc: mallory@example.com", wantErr: true},
+		{name: "Not an address", to: "alice", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := buildMessage("App <no-reply@example.com>", tt.to, content, time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			msg, err := mail.ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("message does not parse: %v", err)
+			}
+			if subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subject != content.Subject {
+				t.Errorf("Subject = %q, want %q", subject, content.Subject)
+			}
+			if !strings.HasSuffix(msg.Header.Get("Message-Id"), "@example.com>") {
+				t.Errorf("Message-ID = %q, want the sender's domain", msg.Header.Get("Message-Id"))
+			}
+
+			_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var bodies []string
+			parts := multipart.NewReader(msg.Body, params["boundary"])
+			for {
+				part, err := parts.NextPart()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(part)
+				bodies = append(bodies, string(body))
+			}
+			if len(bodies) != 2 || bodies[0] != content.Text || bodies[1] != content.HTML {
+				t.Errorf("parts = %q, want text and html", bodies)
+			}
+		})
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	sender, err := NewFileSender(dir, "no-reply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sender.Send(context.Background(), "alice@example.com", Content{Subject: "Hi", Text: "t", HTML: "h"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("files = %v, want one .eml", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if msg, err := mail.ReadMessage(bytes.NewReader(data)); err != nil || msg.Header.Get("To") != "alice@example.com" {
+		t.Errorf("written message does not parse or has the wrong recipient: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// templates/<locale>/<name>.subject.tmpl, .txt.tmpl and .html.tmpl, the HTML part is escaped
+//
+//go:embed templates
+var templateFS embed.FS
+
+type templateSet struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// Templates renders localized messages, falling back from "th-TH" to "th" to the default locale
+type Templates struct {
+	defaultLocale string
+	sets          map[string]map[string]*templateSet
+}
+
+func LoadTemplates(defaultLocale string) (*Templates, error) {
+	t := &Templates{defaultLocale: strings.ToLower(defaultLocale), sets: map[string]map[string]*templateSet{}}
+
+	err := fs.WalkDir(templateFS, "templates", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		locale := strings.ToLower(path.Base(path.Dir(file)))
+		name, part, ok := strings.Cut(strings.TrimSuffix(path.Base(file), ".tmpl"), ".")
+		if !ok {
+			return fmt.Errorf("template %s is not named <name>.<part>.tmpl", file)
+		}
+		content, err := templateFS.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		if t.sets[locale] == nil {
+			t.sets[locale] = map[string]*templateSet{}
+		}
+		set := t.sets[locale][name]
+		if set == nil {
+			set = &templateSet{}
+			t.sets[locale][name] = set
+		}
+
+		switch part {
+		case "subject":
+			set.subject, err = texttemplate.New(file).Option("missingkey=error").Parse(strings.TrimSpace(string(content)))
+		case "txt":
+			set.text, err = texttemplate.New(file).Option("missingkey=error").Parse(string(content))
+		case "html":
+			set.html, err = htmltemplate.New(file).Option("missingkey=error").Parse(string(content))
+		default:
+			err = fmt.Errorf("template %s: unknown part %q", file, part)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for locale, sets := range t.sets {
+		for name, set := range sets {
+			if set.subject == nil || set.text == nil || set.html == nil {
+				return nil, fmt.Errorf("template %s/%s needs a subject, txt and html part", locale, name)
+			}
+		}
+	}
+	if len(t.sets[t.defaultLocale]) == 0 {
+		return nil, fmt.Errorf("no templates for the default locale %q", t.defaultLocale)
+	}
+	return t, nil
+}
+
+// Render fills the template name in the best match for locale
+func (t *Templates) Render(name, locale string, data map[string]string) (Content, error) {
+	set, ok := t.lookup(name, locale)
+	if !ok {
+		return Content{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := set.subject.Execute(&subject, data); err != nil {
+		return Content{}, err
+	}
+	if err := set.text.Execute(&text, data); err != nil {
+		return Content{}, err
+	}
+	if err := set.html.Execute(&html, data); err != nil {
+		return Content{}, err
+	}
+
+	return Content{Subject: subject.String(), Text: text.String(), HTML: html.String()}, nil
+}
+
+func (t *Templates) lookup(name, locale string) (*templateSet, bool) {
+	locale = strings.ToLower(locale)
+	language, _, _ := strings.Cut(locale, "-")
+
+	for _, candidate := range []string{locale, language, t.defaultLocale} {
+		if set, ok := t.sets[candidate][name]; ok {
+			return set, true
+		}
+	}
+	return nil, false
+}
+
+// PreferredLocale returns the first language of an Accept-Language header
+func PreferredLocale(acceptLanguage string) string {
+	first, _, _ := strings.Cut(acceptLanguage, ",")
+	tag, _, _ := strings.Cut(first, ";")
+	tag = strings.TrimSpace(tag)
+	if tag == "*" {
+		return ""
+	}
+	return tag
+}
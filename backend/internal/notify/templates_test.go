@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	templates, err := LoadTemplates("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]string{"Username": "<b>alice</b>", "Time": "2026-01-01 08:00 UTC", "IP": "10.0.0.1"}
+
+	tests := []struct {
+		name        string
+		template    string
+		locale      string
+		data        map[string]string
+		wantSubject string
+		wantErr     bool
+		wantIs      error
+	}{
+		{name: "Default locale", template: TemplatePasswordChanged, locale: "en", data: data, wantSubject: "Your password was changed"},
+		{name: "Region falls back to language", template: TemplatePasswordChanged, locale: "th-TH", data: data, wantSubject: "รหัสผ่านของคุณถูกเปลี่ยนแล้ว"},
+		{name: "Unknown locale falls back to default", template: TemplatePasswordChanged, locale: "fr", data: data, wantSubject: "Your password was changed"},
+		{name: "Unknown template", template: "welcome", locale: "en", data: data, wantErr: true, wantIs: ErrUnknownTemplate},
+		{name: "Missing data", template: TemplatePasswordChanged, locale: "en", data: map[string]string{"Username": "alice"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := templates.Render(tt.template, tt.locale, tt.data)
+			if (err != nil) != tt.wantErr || (tt.wantIs != nil && !errors.Is(err, tt.wantIs)) {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if content.Subject != tt.wantSubject {
+				t.Errorf("Render() subject = %q, want %q", content.Subject, tt.wantSubject)
+			}
+			if !strings.Contains(content.Text, "<b>alice</b>") {
+				t.Errorf("Render() text = %q, want the plain username", content.Text)
+			}
+			if strings.Contains(content.HTML, "<b>alice</b>") || !strings.Contains(content.HTML, "&lt;b&gt;alice&lt;/b&gt;") {
+				t.Errorf("Render() html = %q, want the username escaped", content.HTML)
+			}
+		})
+	}
+}
+
+func TestPreferredLocale(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "th-TH,th;q=0.9,en;q=0.8", want: "th-TH"},
+		{header: "en;q=0.5", want: "en"},
+		{header: "*", want: ""},
+		{header: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := PreferredLocale(tt.header); got != tt.want {
+				t.Errorf("PreferredLocale(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"go-backend/internal/config"
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// Client is one entry of the OAUTH_CLIENTS_FILE. Confidential clients authenticate with the
+// secret oauth_<id>_client_secret, public clients (SPAs, CLIs) rely on PKCE alone.
+type Client struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirectUris"`
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grantTypes"`
+	Public       bool     `json:"public"`
+	// Role is what the client's own client_credentials tokens act as, user or admin
+	Role string `json:"role"`
+
+	secret string
+}
+
+func (c *Client) AllowsGrant(grant string) bool {
+	return slices.Contains(c.GrantTypes, grant)
+}
+
+// RedirectURI returns the registered redirect URI matching requested exactly. Without a
+// requested URI the client's only registered one is used.
+func (c *Client) RedirectURI(requested string) (string, bool) {
+	if requested == "" {
+		if len(c.RedirectURIs) == 1 {
+			return c.RedirectURIs[0], true
+		}
+		return "", false
+	}
+	return requested, slices.Contains(c.RedirectURIs, requested)
+}
+
+// GrantScope returns the requested scopes if the client may have all of them, an empty
+// request gets every scope of the client
+func (c *Client) GrantScope(requested string) (string, bool) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return strings.Join(c.Scopes, " "), true
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return "", false
+		}
+	}
+	return strings.Join(scopes, " "), true
+}
+
+// Authenticate checks the client secret, public clients have none
+func (c *Client) Authenticate(secret string) bool {
+	if c.Public {
+		return secret == ""
+	}
+	return secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(c.secret)) == 1
+}
+
+// Registry holds the clients allowed to use the authorization server
+type Registry struct {
+	clients map[string]*Client
+}
+
+func NewRegistry(clients ...*Client) *Registry {
+	r := &Registry{clients: map[string]*Client{}}
+	for _, client := range clients {
+		r.clients[client.ID] = client
+	}
+	return r
+}
+
+// LoadRegistry reads the client list and resolves each confidential client's secret
+func LoadRegistry(ctx context.Context, path string, secretChain *config.SecretChain) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var clients []*Client
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return nil, fmt.Errorf("oauth clients %s: %w", path, err)
+	}
+
+	for _, client := range clients {
+		if client.ID == "" || len(client.GrantTypes) == 0 {
+			return nil, fmt.Errorf("oauth clients %s: id and grantTypes are required", path)
+		}
+		if client.AllowsGrant(GrantAuthorizationCode) && len(client.RedirectURIs) == 0 {
+			return nil, fmt.Errorf("oauth client %s: authorization_code requires redirectUris", client.ID)
+		}
+		if client.Public {
+			if client.AllowsGrant(GrantClientCredentials) {
+				return nil, fmt.Errorf("oauth client %s: public clients cannot use client_credentials", client.ID)
+			}
+			continue
+		}
+		if client.AllowsGrant(GrantClientCredentials) {
+			if client.Role == "" {
+				client.Role = "user"
+			}
+			if client.Role != "user" && client.Role != "admin" {
+				return nil, fmt.Errorf("oauth client %s: role must be user or admin", client.ID)
+			}
+		}
+
+		secret, ok, err := secretChain.Lookup(ctx, "oauth_"+client.ID+"_client_secret")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("oauth client %s: secret oauth_%s_client_secret not found", client.ID, client.ID)
+		}
+		client.secret = secret
+	}
+
+	return NewRegistry(clients...), nil
+}
+
+func (r *Registry) Get(id string) (*Client, bool) {
+	client, ok := r.clients[id]
+	return client, ok
+}
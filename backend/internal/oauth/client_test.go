@@ -0,0 +1,136 @@
+package oauth
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestClient_RedirectURI(t *testing.T) {
+	single := &Client{RedirectURIs: []string{"https://wiki.internal/callback"}}
+	multiple := &Client{RedirectURIs: []string{"https://wiki.internal/callback", "http://localhost:3000/callback"}}
+
+	tests := []struct {
+		name      string
+		client    *Client
+		requested string
+		want      string
+		wantOK    bool
+	}{
+		{name: "Registered URI", client: multiple, requested: "http://localhost:3000/callback", want: "http://localhost:3000/callback", wantOK: true},
+		{name: "Prefix of a registered URI", client: single, requested: "https://wiki.internal/callback/../evil"},
+		{name: "Unregistered URI", client: single, requested: "https://evil.example/callback"},
+		{name: "Omitted with a single registered URI", client: single, want: "https://wiki.internal/callback", wantOK: true},
+		{name: "Omitted with several registered URIs", client: multiple},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.client.RedirectURI(tt.requested)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("RedirectURI() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestClient_GrantScope(t *testing.T) {
+	client := &Client{Scopes: []string{"openid", "profile", "email"}}
+
+	tests := []struct {
+		name      string
+		requested string
+		want      string
+		wantOK    bool
+	}{
+		{name: "Subset", requested: "openid email", want: "openid email", wantOK: true},
+		{name: "Empty gets every client scope", requested: "", want: "openid profile email", wantOK: true},
+		{name: "Scope the client may not have", requested: "openid admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := client.GrantScope(tt.requested)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("GrantScope() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestClient_Authenticate(t *testing.T) {
+	confidential := &Client{ID: "wiki", secret: "s3cret"}
+	public := &Client{ID: "cli", Public: true}
+
+	tests := []struct {
+		name   string
+		client *Client
+		secret string
+		want   bool
+	}{
+		{name: "Confidential with its secret", client: confidential, secret: "s3cret", want: true},
+		{name: "Confidential with a wrong secret", client: confidential, secret: "guess"},
+		{name: "Confidential without a secret", client: confidential},
+		{name: "Public without a secret", client: public, want: true},
+		{name: "Public with a secret", client: public, secret: "s3cret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.client.Authenticate(tt.secret); got != tt.want {
+				t.Errorf("Authenticate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{name: "Matching verifier", verifier: verifier, challenge: challenge, want: true},
+		{name: "Wrong verifier", verifier: verifier + "x", challenge: challenge},
+		{name: "Missing verifier", challenge: challenge},
+		{name: "Plain challenge", verifier: verifier, challenge: verifier},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("verifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	encode := func(s string) string { return "Basic " + base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name       string
+		header     string
+		wantID     string
+		wantSecret string
+		wantOK     bool
+	}{
+		{name: "Plain credentials", header: encode("wiki:s3cret"), wantID: "wiki", wantSecret: "s3cret", wantOK: true},
+		{name: "Form encoded secret", header: encode("wiki:a%3Ab%2Bc"), wantID: "wiki", wantSecret: "a:b+c", wantOK: true},
+		{name: "Bearer header", header: "Bearer token"},
+		{name: "Missing separator", header: encode("wiki")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, secret, ok := basicAuth(tt.header)
+			if ok != tt.wantOK || id != tt.wantID || secret != tt.wantSecret {
+				t.Errorf("basicAuth() = %q, %q, %v, want %q, %q, %v", id, secret, ok, tt.wantID, tt.wantSecret, tt.wantOK)
+			}
+		})
+	}
+}
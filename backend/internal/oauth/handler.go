@@ -0,0 +1,28 @@
+package oauth
+
+import (
+	"go-backend/internal/auth"
+	"go-backend/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func RegisterRoutes(app *fiber.Router, redisClient *redis.Client, authService *auth.AuthService, clients *Registry, signer *Signer, issuer, consentURL string) {
+	server := NewServer(redisClient, authService, clients, signer, issuer, consentURL)
+
+	oauth := (*app).Group("/oauth")
+
+	oauth.Get("/.well-known/openid-configuration", server.DiscoveryHandler)
+	oauth.Get("/jwks", server.JWKSHandler)
+	oauth.Get("/authorize", server.AuthorizeHandler)
+	oauth.Post("/token", server.TokenHandler)
+	oauth.Post("/introspect", server.IntrospectHandler)
+	oauth.Post("/revoke", server.RevokeHandler)
+	oauth.Get("/userinfo", middleware.ScopedAuthMiddleware(redisClient, "openid"), server.UserInfoHandler)
+
+	// consent page of our frontend, the user signs in there first
+	requests := oauth.Group("/requests", middleware.AuthMiddleware(redisClient))
+	requests.Get("/:requestId", server.AuthorizeRequestHandler)
+	requests.Post("/:requestId", server.ConsentHandler)
+}
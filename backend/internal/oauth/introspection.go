@@ -0,0 +1,138 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+
+	"go-backend/internal/config"
+	"go-backend/internal/session"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	hintAccessToken  = "access_token"
+	hintRefreshToken = "refresh_token"
+)
+
+// IntrospectHandler tells a confidential client whether a token is active, applying the
+// same session rules as the auth middleware without counting as user activity (RFC 7662).
+// Public clients are refused, their client_id is no credential and would let anyone probe tokens.
+func (s *Server) IntrospectHandler(c *fiber.Ctx) error {
+	c.Set("Cache-Control", "no-store")
+
+	var req TokenActionRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "token is required")
+	}
+	if client, ok := s.authenticateClient(c, req.ClientID, req.ClientSecret); !ok || client.Public {
+		c.Set("WWW-Authenticate", `Basic realm="oauth"`)
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+
+	ctx := context.Background()
+	claims, tokenType, err := s.parseToken(ctx, req.Token)
+	if err != nil {
+		return c.JSON(IntrospectionResponse{Active: false})
+	}
+
+	response := IntrospectionResponse{
+		Active:   true,
+		Scope:    claims.Scope,
+		ClientID: claims.ClientID,
+		Username: claims.Username,
+		Sub:      claims.Subject,
+		Jti:      claims.ID,
+	}
+	if claims.ExpiresAt != nil {
+		response.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response.Iat = claims.IssuedAt.Unix()
+	}
+	if response.Sub == "" {
+		response.Sub = claims.UserID
+	}
+	// token_type is the RFC 6749 type, only access tokens are presented as bearer tokens
+	if tokenType == hintAccessToken {
+		response.TokenType = "Bearer"
+	}
+
+	// client credentials tokens have no session
+	if claims.UserID == "" {
+		return c.JSON(response)
+	}
+
+	status, err := session.Inspect(ctx, s.redisClient, claims.UserID, claims.SessionID, session.PolicyFor(claims.Role))
+	if err != nil || !status.Active {
+		return c.JSON(IntrospectionResponse{Active: false})
+	}
+	if status.Locked {
+		response.SessionLocked = true
+		response.SessionLockedAt = status.LockedAt.Unix()
+	}
+
+	return c.JSON(response)
+}
+
+// RevokeHandler revokes a refresh token, or an access token through the jti denylist. Only
+// tokens issued to the calling client are revoked, and unknown tokens are not an error (RFC 7009).
+func (s *Server) RevokeHandler(c *fiber.Ctx) error {
+	var req TokenActionRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "token is required")
+	}
+	client, ok := s.authenticateClient(c, req.ClientID, req.ClientSecret)
+	if !ok {
+		c.Set("WWW-Authenticate", `Basic realm="oauth"`)
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+
+	ctx := context.Background()
+	claims, tokenType, err := s.parseToken(ctx, req.Token)
+	if err != nil || claims.ClientID != client.ID {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	if tokenType == hintRefreshToken {
+		err = s.redisClient.Del(ctx, session.RefreshTokenKey(claims.UserID, claims.ID)).Err()
+	} else if claims.ID != "" && claims.ExpiresAt != nil {
+		err = session.DenyToken(ctx, s.redisClient, claims.ID, claims.ExpiresAt.Time)
+	}
+	if err != nil {
+		return oauthError(c, fiber.StatusServiceUnavailable, "temporarily_unavailable", "")
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+var errInactiveToken = errors.New("token is not active")
+
+// parseToken verifies one of our tokens. Refresh tokens must still be stored in Redis,
+// access tokens must not be on the denylist.
+func (s *Server) parseToken(ctx context.Context, token string) (*shared.Claims, string, error) {
+	claims := &shared.Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, config.JWTKeyFunc)
+	if err != nil || !parsed.Valid {
+		return nil, "", errInactiveToken
+	}
+
+	if claims.TokenType == shared.TokenTypeRefresh {
+		claims, err := s.authService.VerifyRefreshToken(ctx, token)
+		if err != nil {
+			return nil, "", errInactiveToken
+		}
+		return claims, hintRefreshToken, nil
+	}
+
+	if claims.ID != "" {
+		denied, err := session.IsTokenDenied(ctx, s.redisClient, claims.ID)
+		if err != nil || denied {
+			return nil, "", errInactiveToken
+		}
+	}
+
+	return claims, hintAccessToken, nil
+}
@@ -0,0 +1,101 @@
+package oauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/internal/session"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIntrospectHandler_ClientAuthentication(t *testing.T) {
+	server := NewServer(nil, nil, NewRegistry(
+		&Client{ID: "wiki", secret: "s3cret"},
+		&Client{ID: "cli", Public: true},
+	), nil, "", "")
+	app := fiber.New()
+	app.Post("/introspect", server.IntrospectHandler)
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		basic      string
+		wantStatus int
+	}{
+		{name: "Confidential client with client_secret_post", form: url.Values{"client_id": {"wiki"}, "client_secret": {"s3cret"}}, wantStatus: fiber.StatusOK},
+		{name: "Confidential client with Basic auth", basic: "wiki:s3cret", wantStatus: fiber.StatusOK},
+		{name: "Confidential client with a wrong secret", form: url.Values{"client_id": {"wiki"}, "client_secret": {"guess"}}, wantStatus: fiber.StatusUnauthorized},
+		{name: "Public client", form: url.Values{"client_id": {"cli"}}, wantStatus: fiber.StatusUnauthorized},
+		{name: "No client", wantStatus: fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"token": {"not-a-token"}}
+			for key, values := range tt.form {
+				form[key] = values
+			}
+			req := httptest.NewRequest(fiber.MethodPost, "/introspect", strings.NewReader(form.Encode()))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+			if tt.basic != "" {
+				req.Header.Set(fiber.HeaderAuthorization, "Basic "+base64.StdEncoding.EncodeToString([]byte(tt.basic)))
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.StatusCode != fiber.StatusOK {
+				return
+			}
+			var body IntrospectionResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Active {
+				t.Errorf("response = %+v, %v, want an inactive token", body, err)
+			}
+		})
+	}
+}
+
+func TestIntrospectHandler_TokenType(t *testing.T) {
+	server := newTestServer(t)
+	code := server.authorize(t, "openid profile")
+	_, tokens, _ := server.token(t, url.Values{"grant_type": {GrantAuthorizationCode}, "code": {code}, "code_verifier": {testVerifier}})
+	// an active session, not one idle since its login
+	server.mr.HSet(session.Key("7"), "lastActivity", strconv.FormatInt(time.Now().Unix(), 10))
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{name: "Access token", token: tokens.AccessToken, want: "Bearer"},
+		{name: "Refresh token", token: tokens.RefreshToken, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, "/introspect", strings.NewReader(url.Values{"token": {tt.token}}.Encode()))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+			req.SetBasicAuth("wiki", "s3cret")
+			resp, err := server.app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body IntrospectionResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || !body.Active || body.TokenType != tt.want {
+				t.Errorf("response = %+v, %v, want an active token of token_type %q", body, err, tt.want)
+			}
+		})
+	}
+}
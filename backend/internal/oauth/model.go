@@ -0,0 +1,76 @@
+package oauth
+
+// AuthorizeRequest is a validated authorization request waiting for the user's consent
+type AuthorizeRequest struct {
+	ClientID      string `json:"clientId"`
+	RedirectURI   string `json:"redirectUri"`
+	Scope         string `json:"scope"`
+	State         string `json:"state"`
+	Nonce         string `json:"nonce"`
+	CodeChallenge string `json:"codeChallenge"`
+}
+
+// Grant is what an authorization code stands for
+type Grant struct {
+	AuthorizeRequest
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sessionId"`
+	AuthTime  int64  `json:"authTime"`
+}
+
+type ConsentRequest struct {
+	Approve bool `json:"approve"`
+}
+
+// TokenRequest is the form posted to the token endpoint
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// TokenActionRequest is the form posted to the introspection and revocation endpoints
+type TokenActionRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// IntrospectionResponse follows RFC 7662, session_locked and session_locked_at are our
+// extension so resource servers can apply the lock screen too
+type IntrospectionResponse struct {
+	Active          bool   `json:"active"`
+	Scope           string `json:"scope,omitempty"`
+	ClientID        string `json:"client_id,omitempty"`
+	Username        string `json:"username,omitempty"`
+	TokenType       string `json:"token_type,omitempty"`
+	Exp             int64  `json:"exp,omitempty"`
+	Iat             int64  `json:"iat,omitempty"`
+	Sub             string `json:"sub,omitempty"`
+	Jti             string `json:"jti,omitempty"`
+	SessionLocked   bool   `json:"session_locked,omitempty"`
+	SessionLockedAt int64  `json:"session_locked_at,omitempty"`
+}
+
+// ErrorResponse is the RFC 6749 error body, OAuth clients expect it instead of shared.ErrorResponse
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
@@ -0,0 +1,539 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go-backend/internal/auth"
+	"go-backend/internal/session"
+	"go-backend/internal/shared"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// the user has this long to consent, and the client to redeem the code
+	authorizeRequestTTL  = 10 * time.Minute
+	authorizationCodeTTL = time.Minute
+)
+
+// Server is the OAuth 2.0 authorization server for internal apps. Tokens come from
+// AuthService and belong to the user's Redis session, so lock and logout apply to them.
+type Server struct {
+	redisClient *redis.Client
+	authService *auth.AuthService
+	clients     *Registry
+	signer      *Signer
+	issuer      string
+	consentURL  string
+}
+
+func NewServer(redisClient *redis.Client, authService *auth.AuthService, clients *Registry, signer *Signer, issuer, consentURL string) *Server {
+	return &Server{
+		redisClient: redisClient,
+		authService: authService,
+		clients:     clients,
+		signer:      signer,
+		issuer:      issuer,
+		consentURL:  consentURL,
+	}
+}
+
+// AuthorizeHandler validates an authorization request and sends the browser to the consent
+// page. Until the redirect URI is known to belong to the client errors are not redirected.
+func (s *Server) AuthorizeHandler(c *fiber.Ctx) error {
+	client, ok := s.clients.Get(c.Query("client_id"))
+	if !ok || !client.AllowsGrant(GrantAuthorizationCode) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_client", "Unknown client")
+	}
+	redirectURI, ok := client.RedirectURI(c.Query("redirect_uri"))
+	if !ok {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	state := c.Query("state")
+	if c.Query("response_type") != "code" {
+		return redirectError(c, redirectURI, state, "unsupported_response_type")
+	}
+	scope, ok := client.GrantScope(c.Query("scope"))
+	if !ok {
+		return redirectError(c, redirectURI, state, "invalid_scope")
+	}
+	if c.Query("code_challenge") == "" || c.Query("code_challenge_method") != "S256" {
+		return redirectError(c, redirectURI, state, "invalid_request")
+	}
+
+	requestID := uuid.New().String()
+	err := s.saveJSON(requestKey(requestID), AuthorizeRequest{
+		ClientID:      client.ID,
+		RedirectURI:   redirectURI,
+		Scope:         scope,
+		State:         state,
+		Nonce:         c.Query("nonce"),
+		CodeChallenge: c.Query("code_challenge"),
+	}, authorizeRequestTTL)
+	if err != nil {
+		return redirectError(c, redirectURI, state, "server_error")
+	}
+
+	return c.Redirect(s.consentURL+"?"+url.Values{"request_id": {requestID}}.Encode(), fiber.StatusFound)
+}
+
+// AuthorizeRequestHandler describes a pending request to the consent page. consentRequired
+// is false when the user already granted the client these scopes.
+func (s *Server) AuthorizeRequestHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	var req AuthorizeRequest
+	if err := s.loadJSON(requestKey(c.Params("requestId")), &req); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(shared.ErrorResponse{
+			ErrorCode: "AUTHORIZE_REQUEST_NOT_FOUND",
+			Message:   "Authorization request not found or has expired",
+		})
+	}
+	client, _ := s.clients.Get(req.ClientID)
+
+	return c.JSON(fiber.Map{
+		"client":          fiber.Map{"id": client.ID, "name": client.Name},
+		"scopes":          strings.Fields(req.Scope),
+		"consentRequired": !s.hasConsent(userId, req.ClientID, req.Scope),
+	})
+}
+
+// ConsentHandler records the user's decision and returns where to send the browser: back to
+// the client with a code, or with access_denied
+func (s *Server) ConsentHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	username := c.Locals("username").(string)
+	role := c.Locals("role").(string)
+
+	var body ConsentRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(shared.ErrorResponse{
+			ErrorCode: "INVALID_REQUEST",
+			Message:   "Invalid request body",
+		})
+	}
+
+	var req AuthorizeRequest
+	if err := s.takeJSON(requestKey(c.Params("requestId")), &req); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(shared.ErrorResponse{
+			ErrorCode: "AUTHORIZE_REQUEST_NOT_FOUND",
+			Message:   "Authorization request not found or has expired",
+		})
+	}
+
+	query := url.Values{}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+
+	if !body.Approve {
+		query.Set("error", "access_denied")
+		return c.JSON(fiber.Map{"redirectTo": withQuery(req.RedirectURI, query)})
+	}
+
+	ctx := context.Background()
+	if err := s.redisClient.SAdd(ctx, consentKey(userId, req.ClientID), strings.Fields(req.Scope)).Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "CONSENT_FAILED",
+			Message:   "Failed to record consent",
+		})
+	}
+
+	// auth_time is when the user signed in, consenting is no authentication
+	loginTime, err := s.redisClient.HGet(ctx, session.Key(userId), "loginTime").Int64()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "CONSENT_FAILED",
+			Message:   "Failed to read the session",
+		})
+	}
+
+	code := uuid.New().String()
+	err = s.saveJSON(codeKey(code), Grant{
+		AuthorizeRequest: req,
+		UserID:           userId,
+		Username:         username,
+		Role:             role,
+		SessionID:        c.Locals("sessionId").(string),
+		AuthTime:         loginTime,
+	}, authorizationCodeTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(shared.ErrorResponse{
+			ErrorCode: "CONSENT_FAILED",
+			Message:   "Failed to issue authorization code",
+		})
+	}
+
+	query.Set("code", code)
+	return c.JSON(fiber.Map{"redirectTo": withQuery(req.RedirectURI, query)})
+}
+
+// TokenHandler serves the authorization_code, refresh_token and client_credentials grants
+func (s *Server) TokenHandler(c *fiber.Ctx) error {
+	c.Set("Cache-Control", "no-store")
+
+	var req TokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+	}
+
+	client, ok := s.authenticateClient(c, req.ClientID, req.ClientSecret)
+	if !ok {
+		c.Set("WWW-Authenticate", `Basic realm="oauth"`)
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+	if !client.AllowsGrant(req.GrantType) {
+		return oauthError(c, fiber.StatusBadRequest, "unauthorized_client", "Grant type not allowed for this client")
+	}
+
+	switch req.GrantType {
+	case GrantAuthorizationCode:
+		return s.authorizationCodeGrant(c, client, req)
+	case GrantRefreshToken:
+		return s.refreshTokenGrant(c, client, req)
+	case GrantClientCredentials:
+		return s.clientCredentialsGrant(c, client, req)
+	default:
+		return oauthError(c, fiber.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+func (s *Server) authorizationCodeGrant(c *fiber.Ctx, client *Client, req TokenRequest) error {
+	var grant Grant
+	if err := s.takeJSON(codeKey(req.Code), &grant); err != nil {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Authorization code is invalid or expired")
+	}
+	// redirect_uri may be left out when the client has a single registered one
+	if grant.ClientID != client.ID || (req.RedirectURI != "" && grant.RedirectURI != req.RedirectURI) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Authorization code was issued to another client or redirect_uri")
+	}
+	if !verifyPKCE(req.CodeVerifier, grant.CodeChallenge) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "code_verifier does not match the code challenge")
+	}
+
+	var accessToken, refreshToken string
+	var err error
+	subject := auth.TokenSubject{
+		UserID:    grant.UserID,
+		Username:  grant.Username,
+		Role:      grant.Role,
+		SessionID: grant.SessionID,
+		ClientID:  client.ID,
+		Scope:     grant.Scope,
+	}
+	if client.AllowsGrant(GrantRefreshToken) {
+		accessToken, refreshToken, err = s.authService.GenerateScopedToken(subject)
+	} else {
+		accessToken, err = s.authService.SignAccessToken(subject)
+	}
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "")
+	}
+
+	response := TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(session.PolicyFor(grant.Role).AccessTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        grant.Scope,
+	}
+
+	if slices.Contains(strings.Fields(grant.Scope), "openid") {
+		response.IDToken, err = s.idToken(grant)
+		if err != nil {
+			return oauthError(c, fiber.StatusInternalServerError, "server_error", "")
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// refreshTokenGrant rotates the refresh token: the presented one is redeemed and a new one
+// with the original scope returned, so a leaked refresh token stops working once used
+func (s *Server) refreshTokenGrant(c *fiber.Ctx, client *Client, req TokenRequest) error {
+	ctx := context.Background()
+	claims, err := s.authService.VerifyRefreshToken(ctx, req.RefreshToken)
+	if err != nil || claims.ClientID != client.ID {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Refresh token is invalid, revoked or its session has ended")
+	}
+
+	// a refresh may narrow the scope but never widen it
+	scope := claims.Scope
+	if req.Scope != "" {
+		for _, requested := range strings.Fields(req.Scope) {
+			if !slices.Contains(strings.Fields(claims.Scope), requested) {
+				return oauthError(c, fiber.StatusBadRequest, "invalid_scope", "")
+			}
+		}
+		scope = req.Scope
+	}
+
+	err = s.authService.RedeemRefreshToken(ctx, claims, req.RefreshToken)
+	if errors.Is(err, auth.ErrRefreshTokenRevoked) {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Refresh token is invalid, revoked or its session has ended")
+	}
+	if err != nil {
+		return oauthError(c, fiber.StatusServiceUnavailable, "temporarily_unavailable", "")
+	}
+
+	subject := auth.TokenSubject{
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		Role:      claims.Role,
+		SessionID: claims.SessionID,
+		ClientID:  client.ID,
+		Scope:     claims.Scope,
+	}
+	refreshToken, err := s.authService.SignRefreshToken(subject)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "")
+	}
+	subject.Scope = scope
+	accessToken, err := s.authService.SignAccessToken(subject)
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "")
+	}
+
+	return c.JSON(TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(session.PolicyFor(claims.Role).AccessTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	})
+}
+
+// clientCredentialsGrant issues a token for the client itself, it has no user and no session
+func (s *Server) clientCredentialsGrant(c *fiber.Ctx, client *Client, req TokenRequest) error {
+	scope, ok := client.GrantScope(req.Scope)
+	if !ok {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_scope", "")
+	}
+
+	accessToken, err := s.authService.SignAccessToken(auth.TokenSubject{Role: client.Role, ClientID: client.ID, Scope: scope})
+	if err != nil {
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "")
+	}
+
+	return c.JSON(TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(session.PolicyFor(client.Role).AccessTTL.Seconds()),
+		Scope:       scope,
+	})
+}
+
+// UserInfoHandler returns the claims about the user the token's scope allows. Tokens of our
+// own frontend carry no scope and see everything.
+func (s *Server) UserInfoHandler(c *fiber.Ctx) error {
+	// client_credentials tokens have no user to describe
+	if sessionId, _ := c.Locals("sessionId").(string); sessionId == "" {
+		return oauthError(c, fiber.StatusForbidden, "insufficient_scope", "")
+	}
+
+	userId := c.Locals("userId").(string)
+	username := c.Locals("username").(string)
+	scopes := strings.Fields(c.Locals("scope").(string))
+	allowed := func(scope string) bool {
+		return len(scopes) == 0 || slices.Contains(scopes, scope)
+	}
+
+	info := fiber.Map{"sub": userId}
+	if allowed("profile") {
+		info["preferred_username"] = username
+	}
+	// email_verified is left out, whether the address was verified is not tracked
+	if user, ok := auth.LookupUser(username); ok && user.Email != "" && allowed("email") {
+		info["email"] = user.Email
+	}
+
+	return c.JSON(info)
+}
+
+func (s *Server) DiscoveryHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"userinfo_endpoint":                     s.issuer + "/userinfo",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"introspection_endpoint":                s.issuer + "/introspect",
+		"revocation_endpoint":                   s.issuer + "/revoke",
+	})
+}
+
+func (s *Server) JWKSHandler(c *fiber.Ctx) error {
+	return c.JSON(s.signer.JWKS())
+}
+
+type idTokenClaims struct {
+	Nonce             string `json:"nonce,omitempty"`
+	AuthTime          int64  `json:"auth_time"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (s *Server) idToken(grant Grant) (string, error) {
+	now := time.Now()
+	scopes := strings.Fields(grant.Scope)
+
+	claims := idTokenClaims{
+		Nonce:    grant.Nonce,
+		AuthTime: grant.AuthTime,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   grant.UserID,
+			Audience:  jwt.ClaimStrings{grant.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(session.PolicyFor(grant.Role).AccessTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if slices.Contains(scopes, "profile") {
+		claims.PreferredUsername = grant.Username
+	}
+	if user, ok := auth.LookupUser(grant.Username); ok && user.Email != "" && slices.Contains(scopes, "email") {
+		claims.Email = user.Email
+	}
+
+	return s.signer.Sign(claims)
+}
+
+// authenticateClient accepts HTTP Basic or client_secret_post credentials, and a bare
+// client_id for public clients
+func (s *Server) authenticateClient(c *fiber.Ctx, clientID, secret string) (*Client, bool) {
+	if id, basicSecret, ok := basicAuth(c.Get(fiber.HeaderAuthorization)); ok {
+		clientID, secret = id, basicSecret
+	}
+
+	client, ok := s.clients.Get(clientID)
+	if !ok || !client.Authenticate(secret) {
+		return nil, false
+	}
+	return client, true
+}
+
+func (s *Server) hasConsent(userId, clientID, scope string) bool {
+	granted, err := s.redisClient.SMembers(context.Background(), consentKey(userId, clientID)).Result()
+	if err != nil {
+		return false
+	}
+	for _, requested := range strings.Fields(scope) {
+		if !slices.Contains(granted, requested) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) saveJSON(key string, value interface{}, ttl time.Duration) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.redisClient.Set(context.Background(), key, payload, ttl).Err()
+}
+
+func (s *Server) loadJSON(key string, value interface{}) error {
+	payload, err := s.redisClient.Get(context.Background(), key).Bytes()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, value)
+}
+
+// takeJSON loads and deletes a single use value
+func (s *Server) takeJSON(key string, value interface{}) error {
+	payload, err := s.redisClient.GetDel(context.Background(), key).Bytes()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, value)
+}
+
+// verifyPKCE checks an S256 code verifier against the challenge of the authorization request
+func verifyPKCE(verifier, challenge string) bool {
+	if verifier == "" || challenge == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// basicAuth parses client credentials, which RFC 6749 form-encodes before base64
+func basicAuth(header string) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	id, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+	id, err1 := url.QueryUnescape(id)
+	secret, err2 := url.QueryUnescape(secret)
+	return id, secret, err1 == nil && err2 == nil
+}
+
+func oauthError(c *fiber.Ctx, status int, code, description string) error {
+	return c.Status(status).JSON(ErrorResponse{Error: code, ErrorDescription: description})
+}
+
+func redirectError(c *fiber.Ctx, redirectURI, state, code string) error {
+	query := url.Values{"error": {code}}
+	if state != "" {
+		query.Set("state", state)
+	}
+	return c.Redirect(withQuery(redirectURI, query), fiber.StatusFound)
+}
+
+func withQuery(rawURL string, query url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	merged := u.Query()
+	for key, values := range query {
+		merged[key] = values
+	}
+	u.RawQuery = merged.Encode()
+	return u.String()
+}
+
+func requestKey(id string) string {
+	return fmt.Sprintf("oauth_request:%s", id)
+}
+
+func codeKey(code string) string {
+	return fmt.Sprintf("oauth_code:%s", code)
+}
+
+func consentKey(userId, clientID string) string {
+	return fmt.Sprintf("oauth_consent:%s:%s", userId, clientID)
+}
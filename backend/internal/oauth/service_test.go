@@ -0,0 +1,269 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/internal/auth"
+	"go-backend/internal/config"
+	"go-backend/internal/password"
+	"go-backend/internal/session"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// loadTestConfig loads the config from the environment with env secrets, enough to sign
+// tokens and look up session policies
+func loadTestConfig(t *testing.T) {
+	t.Helper()
+	for name, value := range map[string]string{
+		"APP_ENV":             "test",
+		"SECRET_PROVIDERS":    "env",
+		"REDIS_HOST":          "localhost",
+		"MINIO_HOST":          "localhost",
+		"MINIO_BUCKET":        "test",
+		"JWT_SECRET":          "test-jwt-secret",
+		"MINIO_ROOT_USER":     "test",
+		"MINIO_ROOT_PASSWORD": "test-password",
+	} {
+		t.Setenv(name, value)
+	}
+
+	config.InitConfig()
+	if _, err := config.LoadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := config.NewSecretChain(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadSecrets(chain); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.LoadPolicies(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const (
+	testRedirectURI = "https://wiki.internal/callback"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// loginTime of the test session, well before the consent
+var testLoginTime = time.Now().Add(-time.Hour).Unix()
+
+type testServer struct {
+	app *fiber.App
+	mr  *miniredis.Miniredis
+}
+
+// newTestServer runs the authorization server for the confidential client wiki, signed in as
+// alice in session s1
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	loadTestConfig(t)
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	mr.HSet(session.Key("7"), "sid", "s1", "loginTime", strconv.FormatInt(testLoginTime, 10))
+
+	signer, err := NewSigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher := password.Hasher{Algorithm: password.AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}
+	authService := auth.NewAuthService(redisClient, nil, nil, nil, nil, password.Policy{}, hasher, nil)
+	clients := NewRegistry(&Client{
+		ID:           "wiki",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{"openid", "profile", "email"},
+		GrantTypes:   []string{GrantAuthorizationCode, GrantRefreshToken},
+		secret:       "s3cret",
+	})
+	server := NewServer(redisClient, authService, clients, signer, "http://localhost/api/v1/oauth", "http://localhost/consent")
+
+	app := fiber.New()
+	app.Get("/authorize", server.AuthorizeHandler)
+	app.Post("/token", server.TokenHandler)
+	app.Post("/introspect", server.IntrospectHandler)
+	app.Post("/requests/:requestId", func(c *fiber.Ctx) error {
+		c.Locals("userId", "7")
+		c.Locals("username", "alice")
+		c.Locals("role", "user")
+		c.Locals("sessionId", "s1")
+		return c.Next()
+	}, server.ConsentHandler)
+
+	return &testServer{app: app, mr: mr}
+}
+
+// authorize runs the browser part of the flow and returns the authorization code
+func (s *testServer) authorize(t *testing.T, scope string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(testVerifier))
+	query := url.Values{
+		"client_id":             {"wiki"},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-1"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	resp, err := s.app.Test(httptest.NewRequest(fiber.MethodGet, "/authorize?"+query.Encode(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	consent, _ := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+	requestID := consent.Query().Get("request_id")
+	if requestID == "" {
+		t.Fatalf("authorize = %d %s, want a redirect to consent", resp.StatusCode, consent)
+	}
+
+	req := httptest.NewRequest(fiber.MethodPost, "/requests/"+requestID, strings.NewReader(`{"approve":true}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err = s.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		RedirectTo string `json:"redirectTo"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	redirect, _ := url.Parse(body.RedirectTo)
+	if redirect.Query().Get("state") != "xyz" || redirect.Query().Get("code") == "" {
+		t.Fatalf("consent redirect = %s, want the code and state", body.RedirectTo)
+	}
+	return redirect.Query().Get("code")
+}
+
+// token posts form to the token endpoint as the wiki client
+func (s *testServer) token(t *testing.T, form url.Values) (int, TokenResponse, string) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	req.SetBasicAuth("wiki", "s3cret")
+	resp, err := s.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct {
+		TokenResponse
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body.TokenResponse, body.Error
+}
+
+func TestAuthorizationCodeGrant(t *testing.T) {
+	tests := []struct {
+		name       string
+		verifier   string
+		redirect   string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "Matching verifier", verifier: testVerifier, wantStatus: fiber.StatusOK},
+		{name: "Wrong verifier", verifier: testVerifier + "x", wantStatus: fiber.StatusBadRequest, wantError: "invalid_grant"},
+		{name: "Missing verifier", wantStatus: fiber.StatusBadRequest, wantError: "invalid_grant"},
+		{name: "Other redirect_uri", verifier: testVerifier, redirect: "https://evil.example/callback", wantStatus: fiber.StatusBadRequest, wantError: "invalid_grant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			code := server.authorize(t, "openid profile")
+
+			form := url.Values{"grant_type": {GrantAuthorizationCode}, "code": {code}, "code_verifier": {tt.verifier}}
+			if tt.redirect != "" {
+				form.Set("redirect_uri", tt.redirect)
+			}
+			status, tokens, oauthErr := server.token(t, form)
+			if status != tt.wantStatus || oauthErr != tt.wantError {
+				t.Fatalf("token = %d %q, want %d %q", status, oauthErr, tt.wantStatus, tt.wantError)
+			}
+			if tt.wantError != "" {
+				return
+			}
+
+			if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.Scope != "openid profile" {
+				t.Errorf("tokens = %+v, want access and refresh tokens for openid profile", tokens)
+			}
+			var idClaims idTokenClaims
+			if _, _, err := jwt.NewParser().ParseUnverified(tokens.IDToken, &idClaims); err != nil {
+				t.Fatal(err)
+			}
+			if idClaims.AuthTime != testLoginTime || idClaims.Nonce != "n-1" || idClaims.PreferredUsername != "alice" {
+				t.Errorf("id token = %+v, want auth_time of the login %d and the nonce", idClaims, testLoginTime)
+			}
+
+			// a code is redeemed once
+			if status, _, oauthErr := server.token(t, form); status != fiber.StatusBadRequest || oauthErr != "invalid_grant" {
+				t.Errorf("second redemption = %d %q, want invalid_grant", status, oauthErr)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenGrant(t *testing.T) {
+	server := newTestServer(t)
+	code := server.authorize(t, "openid profile email")
+	_, issued, _ := server.token(t, url.Values{"grant_type": {GrantAuthorizationCode}, "code": {code}, "code_verifier": {testVerifier}})
+
+	refresh := func(token, scope string) (int, TokenResponse, string) {
+		return server.token(t, url.Values{"grant_type": {GrantRefreshToken}, "refresh_token": {token}, "scope": {scope}})
+	}
+
+	// a narrowed refresh rotates the token, the new one keeps the original scope
+	status, rotated, oauthErr := refresh(issued.RefreshToken, "profile")
+	if status != fiber.StatusOK {
+		t.Fatalf("refresh = %d %q, want 200", status, oauthErr)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == issued.RefreshToken || rotated.Scope != "profile" {
+		t.Fatalf("refresh = %+v, want a new refresh token and the narrowed scope", rotated)
+	}
+
+	// the redeemed token is spent
+	if status, _, oauthErr := refresh(issued.RefreshToken, ""); status != fiber.StatusBadRequest || oauthErr != "invalid_grant" {
+		t.Errorf("reusing the rotated token = %d %q, want invalid_grant", status, oauthErr)
+	}
+
+	if status, again, _ := refresh(rotated.RefreshToken, ""); status != fiber.StatusOK || again.Scope != "openid profile email" {
+		t.Errorf("refresh with the new token = %d %+v, want the original scope", status, again)
+	}
+	if status, _, oauthErr := refresh(rotated.RefreshToken, ""); status != fiber.StatusBadRequest || oauthErr != "invalid_grant" {
+		t.Errorf("refresh with a spent token = %d %q, want invalid_grant", status, oauthErr)
+	}
+
+	// a refresh may not widen the scope, and does not spend the token trying
+	code = server.authorize(t, "profile")
+	_, profileOnly, _ := server.token(t, url.Values{"grant_type": {GrantAuthorizationCode}, "code": {code}, "code_verifier": {testVerifier}})
+	if status, _, oauthErr := refresh(profileOnly.RefreshToken, "profile email"); status != fiber.StatusBadRequest || oauthErr != "invalid_scope" {
+		t.Errorf("widening refresh = %d %q, want invalid_scope", status, oauthErr)
+	}
+	status, profileOnly, _ = refresh(profileOnly.RefreshToken, "")
+	if status != fiber.StatusOK {
+		t.Fatalf("refresh after a refused widening = %d, want 200", status)
+	}
+
+	// a refresh token dies with its session
+	server.mr.Del(session.Key("7"))
+	if status, _, oauthErr := refresh(profileOnly.RefreshToken, ""); status != fiber.StatusBadRequest || oauthErr != "invalid_grant" {
+		t.Errorf("refresh after logout = %d %q, want invalid_grant", status, oauthErr)
+	}
+}
@@ -0,0 +1,86 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signer signs ID tokens with an RSA key published as a JWKS, so relying parties can verify
+// them without sharing our HMAC access token secret
+type Signer struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// NewSigner parses a PEM encoded PKCS#1 or PKCS#8 RSA key. An empty key generates one, ID
+// tokens then stop verifying after a restart and differ between replicas.
+func NewSigner(keyPEM string) (*Signer, error) {
+	if keyPEM == "" {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return newSigner(key), nil
+	}
+
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("oauth signing key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return newSigner(key), nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("oauth signing key is not an RSA key")
+	}
+	return newSigner(key), nil
+}
+
+func newSigner(key *rsa.PrivateKey) *Signer {
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+	return &Signer{key: key, kid: hex.EncodeToString(sum[:8])}
+}
+
+func (s *Signer) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.key)
+}
+
+// KeyFunc verifies tokens signed by Sign
+func (s *Signer) KeyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, errors.New("unexpected signing method")
+	}
+	return &s.key.PublicKey, nil
+}
+
+// JWKS is the public key set served at the jwks_uri
+func (s *Signer) JWKS() map[string]interface{} {
+	return map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": s.kid,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	}
+}
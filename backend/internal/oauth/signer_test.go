@@ -0,0 +1,60 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	pkcs8DER, _ := x509.MarshalPKCS8PrivateKey(key)
+	pkcs8 := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8DER}))
+
+	tests := []struct {
+		name    string
+		keyPEM  string
+		wantErr bool
+	}{
+		{name: "PKCS#1 key", keyPEM: pkcs1},
+		{name: "PKCS#8 key", keyPEM: pkcs8},
+		{name: "Generated key", keyPEM: ""},
+		{name: "Not PEM", keyPEM: "not a key", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := NewSigner(tt.keyPEM)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSigner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			signed, err := signer.Sign(jwt.RegisteredClaims{Subject: "1", Audience: jwt.ClaimStrings{"wiki"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims := &jwt.RegisteredClaims{}
+			token, err := jwt.ParseWithClaims(signed, claims, signer.KeyFunc)
+			if err != nil || !token.Valid || claims.Subject != "1" {
+				t.Fatalf("ParseWithClaims() = %v, %v", claims, err)
+			}
+
+			jwks := signer.JWKS()["keys"].([]map[string]string)
+			if jwks[0]["kid"] != token.Header["kid"] {
+				t.Errorf("JWKS kid = %q, want %q", jwks[0]["kid"], token.Header["kid"])
+			}
+		})
+	}
+}
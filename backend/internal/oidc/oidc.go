@@ -0,0 +1,179 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// StateTTL is the window an authorization request has to complete in
+const StateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider = errors.New("unknown OIDC provider")
+	ErrInvalidState    = errors.New("OIDC state is invalid or expired")
+	ErrNonceMismatch   = errors.New("ID token nonce does not match")
+)
+
+// ProviderConfig is one entry of the OIDC_PROVIDERS_FILE. The client secret is resolved
+// through the secret chain as oidc_<name>_client_secret.
+type ProviderConfig struct {
+	Name     string   `json:"name"`
+	Issuer   string   `json:"issuer"`
+	ClientID string   `json:"clientId"`
+	Scopes   []string `json:"scopes"`
+}
+
+// Identity is what a provider asserts about the user in a verified ID token
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider is an OpenID provider configured through discovery
+type Provider struct {
+	name     string
+	oauth    oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// NewProvider fetches the discovery document of cfg.Issuer. ID tokens are later checked
+// against the provider's JWKS, issuer and client ID.
+func NewProvider(ctx context.Context, cfg ProviderConfig, clientSecret, redirectURL string) (*Provider, error) {
+	discovered, err := gooidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc provider %s: %w", cfg.Name, err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+
+	return &Provider{
+		name: cfg.Name,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: clientSecret,
+			Endpoint:     discovered.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       append([]string{gooidc.ScopeOpenID}, scopes...),
+		},
+		verifier: discovered.Verifier(&gooidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+func (p *Provider) Name() string { return p.name }
+
+// RelyingParty runs the authorization code flow with PKCE against the configured providers
+type RelyingParty struct {
+	store     StateStore
+	providers map[string]*Provider
+	order     []string
+}
+
+func NewRelyingParty(store StateStore, providers ...*Provider) *RelyingParty {
+	rp := &RelyingParty{store: store, providers: map[string]*Provider{}}
+	for _, p := range providers {
+		rp.providers[p.name] = p
+		rp.order = append(rp.order, p.name)
+	}
+	return rp
+}
+
+// Providers lists the provider names in configuration order
+func (rp *RelyingParty) Providers() []string {
+	return rp.order
+}
+
+// AuthURL starts a login: it stores a fresh state, nonce and PKCE verifier and returns the
+// provider URL to redirect the browser to, with the state the caller binds to the browser
+func (rp *RelyingParty) AuthURL(ctx context.Context, provider string) (string, string, error) {
+	p, ok := rp.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	err = rp.store.Save(ctx, state, AuthState{Provider: provider, Nonce: nonce, Verifier: verifier}, StateTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return p.oauth.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), state, nil
+}
+
+// Exchange completes a login from the provider callback. The state is single use, and the
+// ID token must be signed by the provider, issued for our client and carry the login's nonce.
+func (rp *RelyingParty) Exchange(ctx context.Context, provider, state, code string) (Identity, error) {
+	p, ok := rp.providers[provider]
+	if !ok {
+		return Identity{}, ErrUnknownProvider
+	}
+
+	saved, err := rp.store.Take(ctx, state)
+	if err != nil {
+		return Identity{}, err
+	}
+	if saved.Provider != provider {
+		return Identity{}, ErrInvalidState
+	}
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(saved.Verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("code exchange: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+	if idToken.Nonce != saved.Nonce {
+		return Identity{}, ErrNonceMismatch
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		Provider:      provider,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
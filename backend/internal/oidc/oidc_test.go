@@ -0,0 +1,257 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal OpenID provider: discovery, JWKS and a token endpoint checking PKCE
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	challenge string
+	claims    jwt.MapClaims
+	key       *rsa.PrivateKey
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{key: key, codes: map[string]mockCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		m.mu.Lock()
+		code, ok := m.codes[r.PostForm.Get("code")]
+		delete(m.codes, r.PostForm.Get("code"))
+		m.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, code.claims)
+		token.Header["kid"] = "test"
+		idToken, _ := token.SignedString(code.key)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "provider-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// authorize stands in for the user signing in: it issues a code for the auth URL's PKCE challenge
+func (m *mockProvider) authorize(code string, challenge string, claims jwt.MapClaims, key *rsa.PrivateKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code] = mockCode{challenge: challenge, claims: claims, key: key}
+}
+
+type memoryStateStore struct {
+	mu     sync.Mutex
+	states map[string]AuthState
+}
+
+func (s *memoryStateStore) Save(ctx context.Context, state string, data AuthState, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state] = data
+	return nil
+}
+
+func (s *memoryStateStore) Take(ctx context.Context, state string) (AuthState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.states[state]
+	if !ok {
+		return AuthState{}, ErrInvalidState
+	}
+	delete(s.states, state)
+	return data, nil
+}
+
+func TestRelyingParty(t *testing.T) {
+	ctx := context.Background()
+	mock := newMockProvider(t)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	provider, err := NewProvider(ctx, ProviderConfig{Name: "mock", Issuer: mock.server.URL, ClientID: "fiber-app"}, "client-secret", "http://localhost:8080/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		claims  func(nonce string) jwt.MapClaims
+		key     *rsa.PrivateKey
+		replay  bool
+		want    Identity
+		wantErr error
+	}{
+		{
+			name: "Verified identity",
+			claims: func(nonce string) jwt.MapClaims {
+				return jwt.MapClaims{"sub": "alice-123", "nonce": nonce, "email": "alice@example.com", "email_verified": true}
+			},
+			key:  mock.key,
+			want: Identity{Provider: "mock", Subject: "alice-123", Email: "alice@example.com", EmailVerified: true},
+		},
+		{
+			name: "Nonce from another login",
+			claims: func(nonce string) jwt.MapClaims {
+				return jwt.MapClaims{"sub": "alice-123", "nonce": "other-nonce"}
+			},
+			key:     mock.key,
+			wantErr: ErrNonceMismatch,
+		},
+		{
+			name: "Issued for another client",
+			claims: func(nonce string) jwt.MapClaims {
+				return jwt.MapClaims{"sub": "alice-123", "nonce": nonce, "aud": "other-app"}
+			},
+			key:     mock.key,
+			wantErr: errAny,
+		},
+		{
+			name: "Signed with an unknown key",
+			claims: func(nonce string) jwt.MapClaims {
+				return jwt.MapClaims{"sub": "alice-123", "nonce": nonce}
+			},
+			key:     otherKey,
+			wantErr: errAny,
+		},
+		{
+			name: "Replayed state",
+			claims: func(nonce string) jwt.MapClaims {
+				return jwt.MapClaims{"sub": "alice-123", "nonce": nonce}
+			},
+			key:     mock.key,
+			replay:  true,
+			wantErr: ErrInvalidState,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := NewRelyingParty(&memoryStateStore{states: map[string]AuthState{}}, provider)
+
+			authURL, state, err := rp.AuthURL(ctx, "mock")
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := mustQuery(t, authURL)
+			if query.Get("state") != state {
+				t.Fatalf("AuthURL() state = %q, URL carries %q", state, query.Get("state"))
+			}
+			if query.Get("code_challenge_method") != "S256" {
+				t.Fatalf("AuthURL() code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+			}
+
+			claims := tt.claims(query.Get("nonce"))
+			claims["iss"] = mock.server.URL
+			if _, ok := claims["aud"]; !ok {
+				claims["aud"] = "fiber-app"
+			}
+			claims["exp"] = time.Now().Add(time.Hour).Unix()
+			claims["iat"] = time.Now().Unix()
+			mock.authorize("code-1", query.Get("code_challenge"), claims, tt.key)
+
+			got, err := rp.Exchange(ctx, "mock", query.Get("state"), "code-1")
+			if tt.replay {
+				mock.authorize("code-2", query.Get("code_challenge"), claims, tt.key)
+				got, err = rp.Exchange(ctx, "mock", query.Get("state"), "code-2")
+			}
+
+			switch {
+			case tt.wantErr == errAny:
+				if err == nil {
+					t.Fatalf("Exchange() = %+v, want error", got)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Exchange() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("Exchange() error = %v", err)
+			case got != tt.want:
+				t.Errorf("Exchange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelyingParty_UnknownProvider(t *testing.T) {
+	rp := NewRelyingParty(&memoryStateStore{states: map[string]AuthState{}})
+
+	if _, _, err := rp.AuthURL(context.Background(), "nope"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("AuthURL() error = %v, want %v", err, ErrUnknownProvider)
+	}
+}
+
+// errAny marks cases where any error is acceptable
+var errAny = errors.New("any error")
+
+func mustQuery(t *testing.T, raw string) url.Values {
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
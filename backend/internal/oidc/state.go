@@ -0,0 +1,60 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AuthState is kept between the redirect to the provider and its callback
+type AuthState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// StateStore keeps pending logins. Take removes the state so a callback cannot be replayed.
+type StateStore interface {
+	Save(ctx context.Context, state string, data AuthState, ttl time.Duration) error
+	Take(ctx context.Context, state string) (AuthState, error)
+}
+
+type RedisStateStore struct {
+	client *redis.Client
+}
+
+func NewRedisStateStore(client *redis.Client) *RedisStateStore {
+	return &RedisStateStore{client: client}
+}
+
+func stateKey(state string) string {
+	return fmt.Sprintf("oidc_state:%s", state)
+}
+
+func (s *RedisStateStore) Save(ctx context.Context, state string, data AuthState, ttl time.Duration) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, stateKey(state), payload, ttl).Err()
+}
+
+func (s *RedisStateStore) Take(ctx context.Context, state string) (AuthState, error) {
+	payload, err := s.client.GetDel(ctx, stateKey(state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return AuthState{}, ErrInvalidState
+	}
+	if err != nil {
+		return AuthState{}, err
+	}
+
+	var data AuthState
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return AuthState{}, err
+	}
+	return data, nil
+}
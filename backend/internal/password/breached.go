@@ -0,0 +1,73 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prefixLength is the k-anonymity prefix of the Pwned Passwords range API
+const prefixLength = 5
+
+// BreachList is an offline copy of a breached-password dataset in the layout of the Pwned
+// Passwords range API: one file per 5 hex character SHA-1 prefix, named <PREFIX> or
+// <PREFIX>.txt, holding "<SUFFIX>:<COUNT>" lines. Only the range file of the password's
+// prefix is read, so the dataset can be far larger than memory.
+type BreachList struct {
+	dir string
+}
+
+// OpenBreachList checks that dir is a directory, it may hold only part of the ranges
+func OpenBreachList(dir string) (*BreachList, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password dataset %s is not a directory", dir)
+	}
+	return &BreachList{dir: dir}, nil
+}
+
+// Contains reports whether password is in the dataset. A missing range file counts as not
+// breached. Entries with a count of 0 are padding and do not count, lines without a count do.
+func (b *BreachList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	file, err := b.openRange(prefix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, countText, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(entry, suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(countText)
+		return err != nil || count > 0, nil
+	}
+	return false, scanner.Err()
+}
+
+func (b *BreachList) openRange(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(b.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Open(filepath.Join(b.dir, prefix+".txt"))
+	}
+	return file, err
+}
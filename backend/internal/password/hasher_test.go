@@ -0,0 +1,98 @@
+package password
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// small parameters keep the tests fast
+var testArgon2 = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher Hasher
+	}{
+		{name: "bcrypt", hasher: Hasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}},
+		{name: "argon2id", hasher: Hasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash("Correct-horse-7")
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+
+			if ok, err := Verify(hash, "Correct-horse-7"); !ok || err != nil {
+				t.Errorf("Verify() with the password = %v, %v, want true", ok, err)
+			}
+			if ok, err := Verify(hash, "wrong"); ok || err != nil {
+				t.Errorf("Verify() with a wrong password = %v, %v, want false", ok, err)
+			}
+			if tt.hasher.NeedsRehash(hash) {
+				t.Errorf("NeedsRehash() of a fresh hash = true")
+			}
+		})
+	}
+}
+
+func TestVerifySeedHash(t *testing.T) {
+	// the bcrypt cost 10 hash of the seed users, of "admin"
+	const seed = "$2a$10$UbDFYt/ybeIfPnvIQp4rnu2PI4BckMLcPVN7SCVvD1prr2zUw9Sr."
+	if ok, err := Verify(seed, "admin"); !ok || err != nil {
+		t.Errorf("Verify() = %v, %v, want true", ok, err)
+	}
+	if _, err := Verify("plaintext", "plaintext"); err == nil {
+		t.Errorf("Verify() of an unknown format succeeded")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weakArgon2 := testArgon2
+	weakArgon2.Memory = 32
+	strongArgon2 := testArgon2
+	strongArgon2.Iterations = 2
+
+	hash := func(h Hasher) string {
+		t.Helper()
+		hash, err := h.Hash("Correct-horse-7")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	bcrypt4 := hash(Hasher{Algorithm: AlgorithmBcrypt, BcryptCost: 4})
+	bcrypt5 := hash(Hasher{Algorithm: AlgorithmBcrypt, BcryptCost: 5})
+	argon2Weak := hash(Hasher{Algorithm: AlgorithmArgon2id, Argon2: weakArgon2})
+	argon2Target := hash(Hasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2})
+	argon2Strong := hash(Hasher{Algorithm: AlgorithmArgon2id, Argon2: strongArgon2})
+
+	bcryptTarget := Hasher{Algorithm: AlgorithmBcrypt, BcryptCost: 5}
+	argon2idTarget := Hasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2}
+
+	tests := []struct {
+		name   string
+		hasher Hasher
+		hash   string
+		want   bool
+	}{
+		{name: "bcrypt below the target cost", hasher: bcryptTarget, hash: bcrypt4, want: true},
+		{name: "bcrypt at the target cost", hasher: bcryptTarget, hash: bcrypt5},
+		{name: "argon2id when bcrypt is the target", hasher: bcryptTarget, hash: argon2Target, want: true},
+		{name: "bcrypt when argon2id is the target", hasher: argon2idTarget, hash: bcrypt5, want: true},
+		{name: "argon2id with less memory", hasher: argon2idTarget, hash: argon2Weak, want: true},
+		{name: "argon2id at the target", hasher: argon2idTarget, hash: argon2Target},
+		{name: "argon2id stronger than the target", hasher: argon2idTarget, hash: argon2Strong},
+		{name: "Unknown format", hasher: argon2idTarget, hash: "plaintext", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// character classes a policy may require
+const (
+	ClassUpper  = "upper"
+	ClassLower  = "lower"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+// username and email parts shorter than this are not checked, "al" would reject too much
+const minUserInfoLength = 3
+
+// Policy is what a new password has to satisfy
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes limits the UTF-8 length, bcrypt refuses passwords over BcryptMaxBytes. 0 disables it.
+	MaxBytes        int
+	RequiredClasses []string
+	// reject passwords containing the username or the local part of the email
+	DisallowUserInfo bool
+	// how many previous passwords may not be reused, 0 disables the history
+	HistorySize int
+	// nil skips the breached-password check
+	Breached *BreachList
+}
+
+// Account is who the password is for
+type Account struct {
+	Username string
+	Email    string
+	// hashes of the current and previous passwords, newest first
+	History []string
+}
+
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password broke, so the user can fix them in one go
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Check returns a *PolicyError when password breaks the policy. Other errors come from the
+// breached-password dataset.
+func (p Policy) Check(password string, account Account) error {
+	var violations []Violation
+	add := func(code, format string, args ...interface{}) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add("TOO_SHORT", "Password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add("TOO_LONG", "Password must be at most %d characters", p.MaxLength)
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		add("TOO_LONG", "Password must be at most %d bytes, accented letters and symbols count as several", p.MaxBytes)
+	}
+
+	for _, class := range p.RequiredClasses {
+		if !hasClass(password, class) {
+			add("MISSING_"+strings.ToUpper(class), "Password must contain %s", classNames[class])
+		}
+	}
+
+	if p.DisallowUserInfo && containsUserInfo(password, account) {
+		add("CONTAINS_USER_INFO", "Password must not contain your username or email")
+	}
+
+	if p.HistorySize > 0 && reused(password, account.History, p.HistorySize) {
+		add("REUSED", "Password must differ from your last %d passwords", p.HistorySize)
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			add("BREACHED", "Password has appeared in a data breach, choose another one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+var classNames = map[string]string{
+	ClassUpper:  "an uppercase letter",
+	ClassLower:  "a lowercase letter",
+	ClassDigit:  "a digit",
+	ClassSymbol: "a symbol",
+}
+
+func hasClass(password, class string) bool {
+	for _, r := range password {
+		switch {
+		case class == ClassUpper && unicode.IsUpper(r),
+			class == ClassLower && unicode.IsLower(r),
+			class == ClassDigit && unicode.IsDigit(r),
+			class == ClassSymbol && (unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r)):
+			return true
+		}
+	}
+	return false
+}
+
+func containsUserInfo(password string, account Account) bool {
+	lower := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(account.Email, "@")
+
+	for _, info := range []string{account.Username, localPart} {
+		if utf8.RuneCountInString(info) >= minUserInfoLength && strings.Contains(lower, strings.ToLower(info)) {
+			return true
+		}
+	}
+	return false
+}
+
+// reused compares against the newest size hashes of the history
+func reused(password string, history []string, size int) bool {
+	for i, hash := range history {
+		if i == size {
+			break
+		}
+		if ok, _ := Verify(hash, password); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PushHistory puts the hash of a replaced password in front of the history and keeps size entries
+func PushHistory(history []string, hash string, size int) []string {
+	if size <= 0 || hash == "" {
+		return nil
+	}
+	history = append([]string{hash}, history...)
+	if len(history) > size {
+		history = history[:size]
+	}
+	return history
+}
@@ -0,0 +1,144 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	oldHash, err := bcrypt.GenerateFromPassword([]byte("Old-password-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	olderHash, err := bcrypt.GenerateFromPassword([]byte("Older-password-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := Policy{
+		MinLength:        10,
+		MaxLength:        64,
+		MaxBytes:         BcryptMaxBytes,
+		RequiredClasses:  []string{ClassUpper, ClassLower, ClassDigit, ClassSymbol},
+		DisallowUserInfo: true,
+		HistorySize:      1,
+	}
+	account := Account{
+		Username: "alice",
+		Email:    "a.smith@example.com",
+		History:  []string{string(oldHash), string(olderHash)},
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "Strong password", password: "Correct-horse-7"},
+		{name: "Unicode letters count as classes", password: "Ünïcode-pässword-7"},
+		{name: "Too short and missing classes", password: "abc", want: []string{"TOO_SHORT", "MISSING_UPPER", "MISSING_DIGIT", "MISSING_SYMBOL"}},
+		{name: "Too long", password: "Aa1!" + strings.Repeat("x", 61), want: []string{"TOO_LONG"}},
+		{name: "Within the characters but over bcrypt's bytes", password: "Aa1!" + strings.Repeat("ü", 40), want: []string{"TOO_LONG"}},
+		{name: "Contains username", password: "My-ALICE-pass-7", want: []string{"CONTAINS_USER_INFO"}},
+		{name: "Contains email local part", password: "a.smith-Pass-77", want: []string{"CONTAINS_USER_INFO"}},
+		{name: "Reuses the last password", password: "Old-password-1", want: []string{"REUSED"}},
+		{name: "Outside the history size", password: "Older-password-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, account)
+			if got := violationCodes(t, err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreachList(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8, "letmein" is B7A875FC1EA228B9061041B7CEC4BD3C52AB3CE3
+	writeRange(t, dir, "5BAA6", "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:10437277\r\n")
+	writeRange(t, dir, "B7A87.txt", "5FC1EA228B9061041B7CEC4BD3C52AB3CE3:0\n")
+
+	list, err := OpenBreachList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{name: "Breached password", password: "password", want: true},
+		{name: "Padding entry", password: "letmein"},
+		{name: "Prefix without range file", password: "Correct-horse-7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := list.Contains(tt.password)
+			if err != nil || got != tt.want {
+				t.Errorf("Contains(%q) = %v, %v, want %v", tt.password, got, err, tt.want)
+			}
+		})
+	}
+
+	policy := Policy{Breached: list}
+	if got := violationCodes(t, policy.Check("password", Account{})); !reflect.DeepEqual(got, []string{"BREACHED"}) {
+		t.Errorf("Check() violations = %v, want [BREACHED]", got)
+	}
+}
+
+func TestPushHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []string
+		hash    string
+		size    int
+		want    []string
+	}{
+		{name: "Newest first", history: []string{"b", "c"}, hash: "a", size: 5, want: []string{"a", "b", "c"}},
+		{name: "Trimmed to size", history: []string{"b", "c"}, hash: "a", size: 2, want: []string{"a", "b"}},
+		{name: "History disabled", history: []string{"b"}, hash: "a", size: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PushHistory(tt.history, tt.hash, tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PushHistory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func violationCodes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Check() error = %v, want a *PolicyError", err)
+	}
+	codes := make([]string, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+func writeRange(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
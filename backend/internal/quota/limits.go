@@ -0,0 +1,82 @@
+package quota
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits caps what a user may store. Zero means unlimited.
+type Limits struct {
+	MaxBytes   int64 `json:"maxBytes"`
+	MaxObjects int64 `json:"maxObjects"`
+}
+
+type Usage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a byte size such as "512", "64KB", "100MB" or "2GB" (binary multiples)
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// ParseLimits parses a comma separated list of "name=bytes:objects" entries,
+// e.g. "admin=1GB:10000,user=100MB:1000". Either side of the colon may be left empty to mean unlimited.
+func ParseLimits(s string) (map[string]Limits, error) {
+	result := map[string]Limits{}
+	if strings.TrimSpace(s) == "" {
+		return result, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid quota entry %q", entry)
+		}
+
+		bytesPart, objectsPart, _ := strings.Cut(value, ":")
+
+		var limits Limits
+		var err error
+		if bytesPart != "" {
+			if limits.MaxBytes, err = ParseSize(bytesPart); err != nil {
+				return nil, fmt.Errorf("quota entry %q: %w", entry, err)
+			}
+		}
+		if objectsPart != "" {
+			if limits.MaxObjects, err = strconv.ParseInt(objectsPart, 10, 64); err != nil || limits.MaxObjects < 0 {
+				return nil, fmt.Errorf("quota entry %q: invalid object count", entry)
+			}
+		}
+
+		result[strings.TrimSpace(name)] = limits
+	}
+
+	return result, nil
+}
@@ -0,0 +1,94 @@
+package quota
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "Plain bytes", input: "512", want: 512},
+		{name: "Bytes suffix", input: "512B", want: 512},
+		{name: "Kilobytes", input: "64KB", want: 64 << 10},
+		{name: "Megabytes lowercase", input: "100mb", want: 100 << 20},
+		{name: "Gigabytes with space", input: "2 GB", want: 2 << 30},
+		{name: "Zero is unlimited", input: "0", want: 0},
+		{name: "Negative", input: "-1", wantErr: true},
+		{name: "Garbage", input: "lots", wantErr: true},
+		{name: "Empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSize() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]Limits
+		wantErr bool
+	}{
+		{
+			name:  "Empty",
+			input: "",
+			want:  map[string]Limits{},
+		},
+		{
+			name:  "Multiple roles",
+			input: "admin=1GB:10000, user=100MB:1000",
+			want: map[string]Limits{
+				"admin": {MaxBytes: 1 << 30, MaxObjects: 10000},
+				"user":  {MaxBytes: 100 << 20, MaxObjects: 1000},
+			},
+		},
+		{
+			name:  "Bytes only",
+			input: "42=10MB",
+			want:  map[string]Limits{"42": {MaxBytes: 10 << 20}},
+		},
+		{
+			name:  "Objects only",
+			input: "user=:50",
+			want:  map[string]Limits{"user": {MaxObjects: 50}},
+		},
+		{
+			name:    "Missing name",
+			input:   "=1GB:10",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid objects",
+			input:   "user=1GB:many",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimits(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseLimits() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLimits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/config"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	// ErrReservationsInFlight is returned by Reconcile while uploads are reserved but not yet
+	// stored, or usage changed while the objects were listed
+	ErrReservationsInFlight = errors.New("storage reservations in flight")
+)
+
+// reservations still in flight after this long are treated as abandoned by a crashed upload so
+// they cannot hold off reconciliation forever
+const reservationTimeout = time.Hour
+
+// check both limits and increment in one step so concurrent uploads cannot overshoot. The
+// reservation counts as in flight until it is committed or cancelled, and every change to the
+// usage bumps its version so Reconcile notices it.
+var reserveScript = redis.NewScript(`
+local bytes = tonumber(redis.call('HGET', KEYS[1], 'bytes') or '0')
+local objects = tonumber(redis.call('HGET', KEYS[1], 'objects') or '0')
+local addBytes = tonumber(ARGV[1])
+local addObjects = tonumber(ARGV[2])
+local maxBytes = tonumber(ARGV[3])
+local maxObjects = tonumber(ARGV[4])
+
+if maxBytes > 0 and bytes + addBytes > maxBytes then
+	return 0
+end
+if maxObjects > 0 and objects + addObjects > maxObjects then
+	return 0
+end
+
+redis.call('HINCRBY', KEYS[1], 'bytes', addBytes)
+redis.call('HINCRBY', KEYS[1], 'objects', addObjects)
+redis.call('HINCRBY', KEYS[1], 'reserved', 1)
+redis.call('HSET', KEYS[1], 'reservedAt', ARGV[5])
+redis.call('HINCRBY', KEYS[1], 'version', 1)
+return 1
+`)
+
+// releaseScript gives back bytes and objects, with ARGV[3] = 1 it also ends a reservation in flight
+var releaseScript = redis.NewScript(`
+local bytes = tonumber(redis.call('HGET', KEYS[1], 'bytes') or '0') - tonumber(ARGV[1])
+local objects = tonumber(redis.call('HGET', KEYS[1], 'objects') or '0') - tonumber(ARGV[2])
+redis.call('HSET', KEYS[1], 'bytes', math.max(bytes, 0), 'objects', math.max(objects, 0))
+if ARGV[3] == '1' then
+	local reserved = tonumber(redis.call('HGET', KEYS[1], 'reserved') or '0') - 1
+	redis.call('HSET', KEYS[1], 'reserved', math.max(reserved, 0))
+end
+redis.call('HINCRBY', KEYS[1], 'version', 1)
+return 1
+`)
+
+var commitScript = redis.NewScript(`
+local reserved = tonumber(redis.call('HGET', KEYS[1], 'reserved') or '0') - 1
+redis.call('HSET', KEYS[1], 'reserved', math.max(reserved, 0))
+return 1
+`)
+
+// storeReconciledScript overwrites the usage only if it did not change since ARGV[1] was read,
+// no reservation can have started in between
+var storeReconciledScript = redis.NewScript(`
+if (redis.call('HGET', KEYS[1], 'version') or '0') ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'bytes', ARGV[2], 'objects', ARGV[3], 'reserved', 0, 'reconciledAt', ARGV[4])
+return 1
+`)
+
+type QuotaService struct {
+	redisClient *redis.Client
+	minioClient *minio.Client
+	bucket      string
+
+	defaultLimits Limits
+	roleLimits    map[string]Limits
+	userLimits    map[string]Limits
+}
+
+func NewQuotaService(redisClient *redis.Client, minioClient *minio.Client) (*QuotaService, error) {
+	cfg := config.GetConfig()
+
+	defaultBytes, err := ParseSize(cfg.Env.QUOTA_DEFAULT_BYTES)
+	if err != nil {
+		return nil, fmt.Errorf("QUOTA_DEFAULT_BYTES: %w", err)
+	}
+
+	roleLimits, err := ParseLimits(cfg.Env.QUOTA_ROLE_LIMITS)
+	if err != nil {
+		return nil, fmt.Errorf("QUOTA_ROLE_LIMITS: %w", err)
+	}
+
+	userLimits, err := ParseLimits(cfg.Env.QUOTA_USER_LIMITS)
+	if err != nil {
+		return nil, fmt.Errorf("QUOTA_USER_LIMITS: %w", err)
+	}
+
+	return &QuotaService{
+		redisClient: redisClient,
+		minioClient: minioClient,
+		bucket:      cfg.Env.MINIO_BUCKET,
+		defaultLimits: Limits{
+			MaxBytes:   defaultBytes,
+			MaxObjects: int64(cfg.Env.QUOTA_DEFAULT_OBJECTS),
+		},
+		roleLimits: roleLimits,
+		userLimits: userLimits,
+	}, nil
+}
+
+// UserPrefix is the object prefix owning everything counted against a user's quota
+func UserPrefix(userId string) string {
+	return fmt.Sprintf("users/%s/", userId)
+}
+
+// LimitsFor resolves limits with precedence user override > role override > default
+func (s *QuotaService) LimitsFor(userId, role string) Limits {
+	if limits, ok := s.userLimits[userId]; ok {
+		return limits
+	}
+	if limits, ok := s.roleLimits[role]; ok {
+		return limits
+	}
+	return s.defaultLimits
+}
+
+// Reserve accounts for objects about to be stored, failing with ErrQuotaExceeded when they do not fit.
+// Callers must Commit the reservation once the objects are stored, or Cancel it if the upload
+// does not complete.
+func (s *QuotaService) Reserve(ctx context.Context, userId, role string, bytes, objects int64) error {
+	limits := s.LimitsFor(userId, role)
+
+	ok, err := reserveScript.Run(ctx, s.redisClient, []string{usageKey(userId)},
+		bytes, objects, limits.MaxBytes, limits.MaxObjects, time.Now().Unix()).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Commit marks a reservation as stored, its objects are now visible to Reconcile
+func (s *QuotaService) Commit(ctx context.Context, userId string) error {
+	return commitScript.Run(ctx, s.redisClient, []string{usageKey(userId)}).Err()
+}
+
+// Cancel gives back a reservation whose upload did not complete
+func (s *QuotaService) Cancel(ctx context.Context, userId string, bytes, objects int64) error {
+	return releaseScript.Run(ctx, s.redisClient, []string{usageKey(userId)}, bytes, objects, 1).Err()
+}
+
+// Release gives back the quota of stored objects that were removed
+func (s *QuotaService) Release(ctx context.Context, userId string, bytes, objects int64) error {
+	return releaseScript.Run(ctx, s.redisClient, []string{usageKey(userId)}, bytes, objects, 0).Err()
+}
+
+func (s *QuotaService) Usage(ctx context.Context, userId string) (Usage, error) {
+	usageData, err := s.redisClient.HGetAll(ctx, usageKey(userId)).Result()
+	if err != nil {
+		return Usage{}, err
+	}
+
+	var usage Usage
+	usage.Bytes, _ = strconv.ParseInt(usageData["bytes"], 10, 64)
+	usage.Objects, _ = strconv.ParseInt(usageData["objects"], 10, 64)
+	return usage, nil
+}
+
+// Reconcile recomputes a user's usage from the objects actually stored under their prefix. It
+// fails with ErrReservationsInFlight instead of dropping uploads that are reserved but not yet
+// stored, or usage that changed while the objects were listed.
+func (s *QuotaService) Reconcile(ctx context.Context, userId string) (Usage, error) {
+	version, err := s.reconcileVersion(ctx, userId, time.Now())
+	if err != nil {
+		return Usage{}, err
+	}
+
+	var usage Usage
+	for object := range s.minioClient.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    UserPrefix(userId),
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return Usage{}, object.Err
+		}
+		usage.Bytes += object.Size
+		usage.Objects++
+	}
+
+	if err := s.storeReconciled(ctx, userId, version, usage); err != nil {
+		return Usage{}, err
+	}
+	return usage, nil
+}
+
+// storeReconciled overwrites the usage with what was listed, failing with
+// ErrReservationsInFlight if the usage changed since version was read
+func (s *QuotaService) storeReconciled(ctx context.Context, userId, version string, usage Usage) error {
+	stored, err := storeReconciledScript.Run(ctx, s.redisClient, []string{usageKey(userId)},
+		version, usage.Bytes, usage.Objects, time.Now().Unix()).Int()
+	if err != nil {
+		return err
+	}
+	if stored == 0 {
+		return ErrReservationsInFlight
+	}
+	return nil
+}
+
+// reconcileVersion returns the usage version the listing is based on, failing with
+// ErrReservationsInFlight while a reservation younger than reservationTimeout is not stored yet
+func (s *QuotaService) reconcileVersion(ctx context.Context, userId string, now time.Time) (string, error) {
+	usageData, err := s.redisClient.HGetAll(ctx, usageKey(userId)).Result()
+	if err != nil {
+		return "", err
+	}
+
+	reserved, _ := strconv.ParseInt(usageData["reserved"], 10, 64)
+	reservedAt, _ := strconv.ParseInt(usageData["reservedAt"], 10, 64)
+	if reserved > 0 && now.Before(time.Unix(reservedAt, 0).Add(reservationTimeout)) {
+		return "", ErrReservationsInFlight
+	}
+
+	if usageData["version"] == "" {
+		return "0", nil
+	}
+	return usageData["version"], nil
+}
+
+// StartReconciler periodically reconciles every user that owns a prefix in the bucket
+func (s *QuotaService) StartReconciler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reconcileAll(ctx)
+		}
+	}
+}
+
+func (s *QuotaService) reconcileAll(ctx context.Context) {
+	for object := range s.minioClient.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: "users/"}) {
+		if object.Err != nil {
+			log.Printf("Quota reconcile list failed: %v", object.Err)
+			return
+		}
+
+		// non-recursive listing returns one common prefix per user: users/<userId>/
+		userId := strings.TrimSuffix(strings.TrimPrefix(object.Key, "users/"), "/")
+		if userId == "" || strings.Contains(userId, "/") {
+			continue
+		}
+
+		// users with uploads in flight are picked up on the next run
+		if _, err := s.Reconcile(ctx, userId); err != nil && !errors.Is(err, ErrReservationsInFlight) {
+			log.Printf("Quota reconcile failed for user %s: %v", userId, err)
+		}
+	}
+}
+
+func usageKey(userId string) string {
+	return fmt.Sprintf("storage_usage:%s", userId)
+}
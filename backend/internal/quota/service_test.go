@@ -0,0 +1,104 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReconcileReservations(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	s := &QuotaService{redisClient: redisClient}
+	listed := Usage{Bytes: 100, Objects: 1}
+
+	tests := []struct {
+		name string
+		// before runs ahead of the listing, during while the objects are listed
+		before  func(s *QuotaService)
+		during  func(s *QuotaService)
+		now     time.Time
+		wantErr error
+		want    Usage
+	}{
+		{name: "No reservations", want: listed},
+		{
+			name:    "Reservation in flight",
+			before:  func(s *QuotaService) { s.Reserve(ctx, "u1", "user", 50, 1) },
+			wantErr: ErrReservationsInFlight, want: Usage{Bytes: 50, Objects: 1},
+		},
+		{
+			name: "Committed reservation",
+			before: func(s *QuotaService) {
+				s.Reserve(ctx, "u1", "user", 50, 1)
+				s.Commit(ctx, "u1")
+			},
+			want: listed,
+		},
+		{
+			name: "Cancelled reservation",
+			before: func(s *QuotaService) {
+				s.Reserve(ctx, "u1", "user", 50, 1)
+				s.Cancel(ctx, "u1", 50, 1)
+			},
+			want: listed,
+		},
+		{
+			name:   "Abandoned reservation",
+			before: func(s *QuotaService) { s.Reserve(ctx, "u1", "user", 50, 1) },
+			now:    time.Now().Add(reservationTimeout + time.Minute),
+			want:   listed,
+		},
+		{
+			name: "Reserved while listing",
+			during: func(s *QuotaService) {
+				s.Reserve(ctx, "u1", "user", 50, 1)
+				s.Commit(ctx, "u1")
+			},
+			wantErr: ErrReservationsInFlight, want: Usage{Bytes: 50, Objects: 1},
+		},
+		{
+			name:    "Released while listing",
+			during:  func(s *QuotaService) { s.Release(ctx, "u1", 0, 0) },
+			wantErr: ErrReservationsInFlight, want: Usage{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr.FlushAll()
+			if tt.before != nil {
+				tt.before(s)
+			}
+			now := tt.now
+			if now.IsZero() {
+				now = time.Now()
+			}
+
+			version, err := s.reconcileVersion(ctx, "u1", now)
+			if err == nil {
+				if tt.during != nil {
+					tt.during(s)
+				}
+				err = s.storeReconciled(ctx, "u1", version, listed)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reconcile() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got, _ := s.Usage(ctx, "u1"); got != tt.want {
+				t.Errorf("Usage() = %+v, want %+v", got, tt.want)
+			}
+			if err == nil && mr.HGet(usageKey("u1"), "reserved") != "0" {
+				t.Errorf("reserved = %q, want 0", mr.HGet(usageKey("u1"), "reserved"))
+			}
+		})
+	}
+}
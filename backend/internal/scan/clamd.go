@@ -0,0 +1,127 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const clamdChunkSize = 64 * 1024
+
+var ErrClamdResponse = errors.New("unexpected clamd response")
+
+// ClamdScanner talks to a ClamAV daemon using the INSTREAM command of the clamd protocol
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func NewClamdScanner(network, address string, timeout time.Duration) *ClamdScanner {
+	return &ClamdScanner{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}
+}
+
+// Ping checks that the daemon is reachable
+func (s *ClamdScanner) Ping(ctx context.Context) error {
+	reply, err := s.command(ctx, "zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w: %q", ErrClamdResponse, reply)
+	}
+	return nil
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	reply, err := s.command(ctx, "zINSTREAM\x00", r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// replies look like "stream: OK", "stream: Eicar-Signature FOUND" or "INSTREAM size limit exceeded. ERROR"
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Clean: false, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+
+	return Result{}, fmt.Errorf("%w: %q", ErrClamdResponse, reply)
+}
+
+func (s *ClamdScanner) command(ctx context.Context, cmd string, body io.Reader) (string, error) {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return "", err
+	}
+
+	// clamd may answer and hang up mid-stream (e.g. size limit), so a failed write still reads the reply
+	var writeErr error
+	if body != nil {
+		writeErr = writeChunks(conn, body)
+	}
+
+	// z-prefixed commands are answered with a null terminated line
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if reply == "" && writeErr != nil {
+		return "", writeErr
+	}
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", err
+	}
+
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// writeChunks streams body as <uint32 length><data> frames terminated by a zero length frame
+func writeChunks(w io.Writer, body io.Reader) error {
+	buf := make([]byte, clamdChunkSize)
+	header := make([]byte, 4)
+
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(header, uint32(n))
+			if _, werr := w.Write(header); werr != nil {
+				return werr
+			}
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	binary.BigEndian.PutUint32(header, 0)
+	_, err := w.Write(header)
+	return err
+}
@@ -0,0 +1,158 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd is a minimal clamd speaking PING and INSTREAM. Streams larger than maxStream are rejected
+// the way clamd rejects streams over StreamMaxLength.
+func fakeClamd(t *testing.T, maxStream int) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleFakeClamd(conn, maxStream)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func handleFakeClamd(conn net.Conn, maxStream int) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	cmd, err := reader.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	switch cmd {
+	case "zPING\x00":
+		io.WriteString(conn, "PONG\x00")
+	case "zINSTREAM\x00":
+		var stream bytes.Buffer
+		header := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(reader, header); err != nil {
+				return
+			}
+			size := binary.BigEndian.Uint32(header)
+			if size == 0 {
+				break
+			}
+			if _, err := io.CopyN(&stream, reader, int64(size)); err != nil {
+				return
+			}
+			if stream.Len() > maxStream {
+				io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+				return
+			}
+		}
+
+		if bytes.Contains(stream.Bytes(), []byte(EICAR)) {
+			io.WriteString(conn, "stream: Eicar-Signature FOUND\x00")
+			return
+		}
+		io.WriteString(conn, "stream: OK\x00")
+	default:
+		io.WriteString(conn, "UNKNOWN COMMAND\x00")
+	}
+}
+
+func TestClamdScanner_Scan(t *testing.T) {
+	address := fakeClamd(t, 256*1024)
+	scanner := NewClamdScanner("tcp", address, 5*time.Second)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		want    Result
+		wantErr error
+	}{
+		{
+			name:  "Clean content",
+			input: []byte("hello world"),
+			want:  Result{Clean: true},
+		},
+		{
+			name:  "Empty content",
+			input: []byte{},
+			want:  Result{Clean: true},
+		},
+		{
+			name:  "EICAR spanning chunks",
+			input: append(bytes.Repeat([]byte("a"), clamdChunkSize-10), []byte(EICAR)...),
+			want:  Result{Clean: false, Signature: "Eicar-Signature"},
+		},
+		{
+			name:    "Stream over limit",
+			input:   bytes.Repeat([]byte("a"), 300*1024),
+			wantErr: ErrClamdResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scanner.Scan(context.Background(), bytes.NewReader(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Scan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClamdScanner_Ping(t *testing.T) {
+	scanner := NewClamdScanner("tcp", fakeClamd(t, 1024), 5*time.Second)
+	if err := scanner.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+
+	unreachable := NewClamdScanner("tcp", "127.0.0.1:1", time.Second)
+	if err := unreachable.Ping(context.Background()); err == nil {
+		t.Errorf("Ping() to closed port succeeded")
+	}
+}
+
+func TestStubScanner_Scan(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Result
+	}{
+		{name: "Clean", input: "hello", want: Result{Clean: true}},
+		{name: "EICAR", input: "prefix " + EICAR, want: Result{Clean: false, Signature: "Eicar-Test-Signature"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := StubScanner{}.Scan(context.Background(), strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Scan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go-backend/internal/config"
+)
+
+// Result is the verdict for a single object
+type Result struct {
+	Clean     bool
+	Signature string
+}
+
+// Scanner inspects object content after upload and before it is made available
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// NewScanner builds the scanner selected by SCANNER ("clamd" or "stub")
+func NewScanner() (Scanner, error) {
+	cfg := config.GetConfig()
+
+	switch cfg.Env.SCANNER {
+	case "clamd":
+		return NewClamdScanner("tcp", cfg.Env.CLAMD_ADDRESS, cfg.Env.CLAMD_TIMEOUT), nil
+	case "stub", "":
+		return StubScanner{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown scanner %q", cfg.Env.SCANNER)
+}
@@ -0,0 +1,26 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// EICAR is the industry standard anti-virus test string
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// StubScanner passes everything except content containing the EICAR test string,
+// so the quarantine flow can be exercised without a real anti-virus daemon
+type StubScanner struct{}
+
+func (StubScanner) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if bytes.Contains(data, []byte(EICAR)) {
+		return Result{Clean: false, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return Result{Clean: true}, nil
+}
@@ -0,0 +1,68 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func deniedTokenKey(jti string) string {
+	return fmt.Sprintf("denied_token:%s", jti)
+}
+
+// DenyToken revokes a single access token until it would have expired anyway
+func DenyToken(ctx context.Context, redisClient *redis.Client, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return redisClient.Set(ctx, deniedTokenKey(jti), 1, ttl).Err()
+}
+
+func IsTokenDenied(ctx context.Context, redisClient *redis.Client, jti string) (bool, error) {
+	n, err := redisClient.Exists(ctx, deniedTokenKey(jti)).Result()
+	return n > 0, err
+}
+
+func clientTokensKey(userId string) string {
+	return fmt.Sprintf("client_access_tokens:%s", userId)
+}
+
+// TrackClientToken remembers an access token issued to an OAuth client for userId, so it can
+// be denied with the user's other tokens. Access tokens are not stored otherwise.
+func TrackClientToken(ctx context.Context, redisClient *redis.Client, userId, jti string, expiresAt time.Time) error {
+	key := clientTokensKey(userId)
+
+	pipe := redisClient.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprint(time.Now().Unix()))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(expiresAt.Unix()), Member: jti})
+	// tokens of a role share one lifetime, the newest expires last
+	pipe.ExpireAt(ctx, key, expiresAt)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// DenyClientTokens denies every unexpired OAuth client access token of userId and returns how
+// many were denied
+func DenyClientTokens(ctx context.Context, redisClient *redis.Client, userId string) (int, error) {
+	key := clientTokensKey(userId)
+	tokens, err := redisClient.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min: fmt.Sprint(time.Now().Unix()),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(tokens) == 0 {
+		return 0, err
+	}
+
+	pipe := redisClient.TxPipeline()
+	for _, token := range tokens {
+		// scores are whole seconds, deny a second longer than the token can live
+		ttl := time.Until(time.Unix(int64(token.Score), 0)) + time.Second
+		pipe.Set(ctx, deniedTokenKey(token.Member.(string)), 1, ttl)
+	}
+	pipe.Del(ctx, key)
+	_, err = pipe.Exec(ctx)
+	return len(tokens), err
+}
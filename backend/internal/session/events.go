@@ -0,0 +1,190 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Session event types pushed to every open tab of a user
+const (
+	EventLocked        = "locked"
+	EventUnlocked      = "unlocked"
+	EventRevoked       = "revoked"
+	EventTokenExpiring = "token_expiring"
+)
+
+// Reasons a session is revoked
+const (
+	ReasonLogout      = "logout"
+	ReasonLockTimeout = "lock_timeout"
+	ReasonExpired     = "expired"
+	ReasonAdmin       = "admin"
+)
+
+const (
+	// streams send a comment this often so proxies keep the connection open and a gone
+	// client is noticed
+	heartbeatInterval = 25 * time.Second
+	// TokenExpiryWarning is how long before the access token expires token_expiring is sent
+	TokenExpiryWarning = time.Minute
+)
+
+type Event struct {
+	Type      string `json:"type"`
+	Reason    string `json:"reason,omitempty"`
+	At        int64  `json:"at"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"`
+}
+
+func eventsChannel(userId string) string {
+	return fmt.Sprintf("session-events:%s", userId)
+}
+
+// Publish fans an event out to the streams of userId on every replica. Events are best
+// effort, clients that miss one still see the state on their next request.
+func Publish(ctx context.Context, redisClient *redis.Client, userId string, event Event) {
+	if event.At == 0 {
+		event.At = time.Now().Unix()
+	}
+
+	payload, err := json.Marshal(event)
+	if err == nil {
+		err = redisClient.Publish(ctx, eventsChannel(userId), payload).Err()
+	}
+	if err != nil {
+		log.Printf("Failed to publish session event %s for %s: %v", event.Type, userId, err)
+	}
+}
+
+// Subscribe listens for the events of userId. The subscription is confirmed before it is
+// returned so no event published afterwards is missed.
+func Subscribe(ctx context.Context, redisClient *redis.Client, userId string) (*redis.PubSub, error) {
+	sub := redisClient.Subscribe(ctx, eventsChannel(userId))
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// LockWatch revokes a session the moment its lock times out, so its open tabs are told then
+// and not only once the session is used again
+type LockWatch struct {
+	RedisClient *redis.Client
+	UserID      string
+	SessionID   string
+	Policy      Policy
+}
+
+// next reads the session and returns when its lock times out, ok is false when it cannot
+func (l *LockWatch) next(ctx context.Context) (time.Time, bool) {
+	data, err := l.RedisClient.HGetAll(ctx, Key(l.UserID)).Result()
+	if err != nil || !SameSession(data, l.SessionID) {
+		return time.Time{}, false
+	}
+	return LockTimeoutAt(data, l.Policy)
+}
+
+// check revokes the session if its lock timed out by now and otherwise returns when to check
+// again, activity since the timer was set may have moved the timeout
+func (l *LockWatch) check(ctx context.Context) (time.Time, bool) {
+	at, ok := l.next(ctx)
+	if ok && !time.Now().Before(at) {
+		Revoke(ctx, l.RedisClient, l.UserID, ReasonLockTimeout)
+		return time.Time{}, false
+	}
+	return at, ok
+}
+
+// Stream writes events from sub as Server-Sent Events until ctx ends, the client goes away
+// or the session is revoked. A token_expiring event is sent shortly before tokenExpiresAt.
+// With a watch the session is revoked when its lock times out, which ends the stream too.
+func Stream(ctx context.Context, w *bufio.Writer, sub *redis.PubSub, tokenExpiresAt time.Time, watch *LockWatch) {
+	messages := sub.Channel()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	expiring := time.NewTimer(time.Until(tokenExpiresAt.Add(-TokenExpiryWarning)))
+	defer expiring.Stop()
+
+	lockTimeout := time.NewTimer(0)
+	lockTimeout.Stop()
+	defer lockTimeout.Stop()
+	schedule := func(at time.Time, ok bool) {
+		lockTimeout.Stop()
+		if ok {
+			lockTimeout.Reset(time.Until(at))
+		}
+	}
+	if watch != nil {
+		schedule(watch.next(ctx))
+	}
+
+	fmt.Fprint(w, "retry: 5000\n\n")
+	for {
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				continue
+			}
+			WriteEvent(w, event)
+			if event.Type == EventRevoked {
+				w.Flush()
+				return
+			}
+			if watch != nil && (event.Type == EventLocked || event.Type == EventUnlocked) {
+				schedule(watch.next(ctx))
+			}
+		case <-lockTimeout.C:
+			// the revoked event reaches this stream like every other
+			schedule(watch.check(ctx))
+		case <-expiring.C:
+			WriteEvent(w, Event{Type: EventTokenExpiring, At: time.Now().Unix(), ExpiresAt: tokenExpiresAt.Unix()})
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+	}
+}
+
+// WriteEvent writes one event in the text/event-stream format
+func WriteEvent(w io.Writer, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+// Revoke ends every session of userId, deleting its refresh tokens, and tells its open tabs
+func Revoke(ctx context.Context, redisClient *redis.Client, userId, reason string) {
+	pattern := RefreshTokenKey(userId, "*")
+	keys, err := redisClient.Keys(ctx, pattern).Result()
+	if err == nil && len(keys) > 0 {
+		redisClient.Del(ctx, keys...)
+	}
+
+	redisClient.Del(ctx, Key(userId))
+
+	Publish(ctx, redisClient, userId, Event{Type: EventRevoked, Reason: reason})
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWriteEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name:  "Locked",
+			event: Event{Type: EventLocked, At: 1767254400},
+			want:  "event: locked\ndata: {\"type\":\"locked\",\"at\":1767254400}\n\n",
+		},
+		{
+			name:  "Revoked with reason",
+			event: Event{Type: EventRevoked, Reason: ReasonAdmin, At: 1767254400},
+			want:  "event: revoked\ndata: {\"type\":\"revoked\",\"reason\":\"admin\",\"at\":1767254400}\n\n",
+		},
+		{
+			name:  "Token expiring",
+			event: Event{Type: EventTokenExpiring, At: 1767254400, ExpiresAt: 1767254460},
+			want:  "event: token_expiring\ndata: {\"type\":\"token_expiring\",\"at\":1767254400,\"expiresAt\":1767254460}\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteEvent(&buf, tt.event); err != nil {
+				t.Fatalf("WriteEvent() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("WriteEvent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStream_LockTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		locked      bool
+		lockTimeout time.Duration
+		wantRevoked bool
+	}{
+		{name: "Lock times out while streaming", locked: true, lockTimeout: time.Second, wantRevoked: true},
+		{name: "Unlocked without auto-lock", lockTimeout: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { redisClient.Close() })
+
+			now := time.Now()
+			mr.HSet(Key("7"), "sid", "s1", "loginTime", strconv.FormatInt(now.Unix(), 10))
+			if tt.locked {
+				mr.HSet(Key("7"), "locked", "true", "lockedAt", strconv.FormatInt(now.Unix(), 10))
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			sub, err := Subscribe(ctx, redisClient, "7")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sub.Close()
+
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			Stream(ctx, w, sub, now.Add(time.Hour), &LockWatch{
+				RedisClient: redisClient,
+				UserID:      "7",
+				SessionID:   "s1",
+				Policy:      Policy{LockTimeout: tt.lockTimeout},
+			})
+
+			revoked := strings.Contains(buf.String(), `"reason":"lock_timeout"`)
+			if revoked != tt.wantRevoked || mr.Exists(Key("7")) == tt.wantRevoked {
+				t.Errorf("revoked = %v, session kept = %v, want revoked %v\n%s", revoked, mr.Exists(Key("7")), tt.wantRevoked, buf.String())
+			}
+			if tt.wantRevoked && ctx.Err() != nil {
+				t.Error("stream did not end at the lock timeout")
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-backend/internal/config"
+)
+
+// Policy holds every auth timing rule. Zero IdleTimeout, AutoLockAfter or LockTimeout
+// disables that check.
+type Policy struct {
+	AccessTTL  time.Duration `json:"accessTtl"`
+	RefreshTTL time.Duration `json:"refreshTtl"`
+	// a session expires after IdleTimeout without activity...
+	IdleTimeout time.Duration `json:"idleTimeout"`
+	// ...and Lifetime after login at the latest, however active it is
+	Lifetime time.Duration `json:"lifetime"`
+	// an unlocked session without activity for AutoLockAfter is locked by the server
+	AutoLockAfter time.Duration `json:"autoLockAfter"`
+	LockTimeout   time.Duration `json:"lockTimeout"`
+}
+
+// Policies is the default policy with per-role overrides
+type Policies struct {
+	Default Policy
+	Roles   map[string]Policy
+}
+
+var policies atomic.Pointer[Policies]
+
+// LoadPolicies builds the policies from config, it must run before any session is handled
+func LoadPolicies() error {
+	env := config.GetConfig().Env
+
+	p, err := ParsePolicies(Policy{
+		AccessTTL:     env.AUTH_ACCESS_TTL,
+		RefreshTTL:    env.AUTH_REFRESH_TTL,
+		IdleTimeout:   env.AUTH_IDLE_TIMEOUT,
+		Lifetime:      env.AUTH_SESSION_LIFETIME,
+		AutoLockAfter: env.AUTH_AUTO_LOCK_AFTER,
+		LockTimeout:   env.AUTH_LOCK_TIMEOUT,
+	}, env.AUTH_ROLE_POLICIES)
+	if err != nil {
+		return err
+	}
+
+	policies.Store(&p)
+	config.SetJWTKeyRetention(p.LongestTokenTTL())
+	return nil
+}
+
+// LongestTokenTTL is the longest any token may live under one of the policies
+func (p Policies) LongestTokenTTL() time.Duration {
+	longest := max(p.Default.AccessTTL, p.Default.RefreshTTL)
+	for _, policy := range p.Roles {
+		longest = max(longest, policy.AccessTTL, policy.RefreshTTL)
+	}
+	return longest
+}
+
+// PolicyFor returns the policy of a role, falling back to the default policy
+func PolicyFor(role string) Policy {
+	p := policies.Load()
+	if policy, ok := p.Roles[role]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+var policyFields = map[string]func(p *Policy) *time.Duration{
+	"access_ttl":      func(p *Policy) *time.Duration { return &p.AccessTTL },
+	"refresh_ttl":     func(p *Policy) *time.Duration { return &p.RefreshTTL },
+	"idle_timeout":    func(p *Policy) *time.Duration { return &p.IdleTimeout },
+	"lifetime":        func(p *Policy) *time.Duration { return &p.Lifetime },
+	"auto_lock_after": func(p *Policy) *time.Duration { return &p.AutoLockAfter },
+	"lock_timeout":    func(p *Policy) *time.Duration { return &p.LockTimeout },
+}
+
+// ParsePolicies applies a comma separated list of "role=field:duration;field:duration"
+// overrides to the default policy, e.g. "admin=access_ttl:5m;idle_timeout:30m". Fields a
+// role does not override keep their default.
+func ParsePolicies(def Policy, s string) (Policies, error) {
+	result := Policies{Default: def, Roles: map[string]Policy{}}
+	if strings.TrimSpace(s) == "" {
+		return result, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		role, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || role == "" {
+			return Policies{}, fmt.Errorf("invalid auth policy entry %q", entry)
+		}
+
+		policy := def
+		for _, override := range strings.Split(value, ";") {
+			name, raw, _ := strings.Cut(strings.TrimSpace(override), ":")
+			field, ok := policyFields[name]
+			if !ok {
+				return Policies{}, fmt.Errorf("auth policy entry %q: unknown field %q", entry, name)
+			}
+
+			d, err := config.ParseDuration(raw)
+			if err != nil || d < 0 {
+				return Policies{}, fmt.Errorf("auth policy entry %q: invalid duration %q", entry, raw)
+			}
+			*field(&policy) = d
+		}
+
+		result.Roles[strings.TrimSpace(role)] = policy
+	}
+
+	return result, nil
+}
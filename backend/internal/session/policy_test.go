@@ -0,0 +1,253 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+var defaultPolicy = Policy{
+	AccessTTL:   15 * time.Minute,
+	RefreshTTL:  7 * 24 * time.Hour,
+	IdleTimeout: 30 * time.Minute,
+	Lifetime:    12 * time.Hour,
+	LockTimeout: 10 * time.Minute,
+}
+
+func TestParsePolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]Policy
+		wantErr bool
+	}{
+		{name: "Empty", input: "", want: map[string]Policy{}},
+		{
+			name:  "Overrides keep unset fields from the default",
+			input: "admin=access_ttl:5m;idle_timeout:10m, kiosk=lock_timeout:0s",
+			want: map[string]Policy{
+				"admin": {AccessTTL: 5 * time.Minute, RefreshTTL: 7 * 24 * time.Hour, IdleTimeout: 10 * time.Minute, Lifetime: 12 * time.Hour, LockTimeout: 10 * time.Minute},
+				"kiosk": {AccessTTL: 15 * time.Minute, RefreshTTL: 7 * 24 * time.Hour, IdleTimeout: 30 * time.Minute, Lifetime: 12 * time.Hour},
+			},
+		},
+		{
+			name:  "Bare seconds",
+			input: "admin=access_ttl:900",
+			want: map[string]Policy{
+				"admin": {AccessTTL: 15 * time.Minute, RefreshTTL: 7 * 24 * time.Hour, IdleTimeout: 30 * time.Minute, Lifetime: 12 * time.Hour, LockTimeout: 10 * time.Minute},
+			},
+		},
+		{name: "Missing role", input: "=access_ttl:5m", wantErr: true},
+		{name: "Unknown field", input: "admin=session_ttl:5m", wantErr: true},
+		{name: "Invalid duration", input: "admin=access_ttl:five", wantErr: true},
+		{name: "Negative duration", input: "admin=access_ttl:-5m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicies(defaultPolicy, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got.Roles) != len(tt.want) {
+				t.Fatalf("ParsePolicies() roles = %v, want %v", got.Roles, tt.want)
+			}
+			for role, policy := range tt.want {
+				if got.Roles[role] != policy {
+					t.Errorf("ParsePolicies() %s = %+v, want %+v", role, got.Roles[role], policy)
+				}
+			}
+		})
+	}
+}
+
+func TestTTL(t *testing.T) {
+	login := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		policy Policy
+		now    time.Time
+		want   time.Duration
+	}{
+		{name: "Idle timeout slides", policy: defaultPolicy, now: login.Add(time.Hour), want: 30 * time.Minute},
+		{name: "Capped by lifetime", policy: defaultPolicy, now: login.Add(11*time.Hour + 50*time.Minute), want: 10 * time.Minute},
+		{name: "Lifetime passed", policy: defaultPolicy, now: login.Add(13 * time.Hour), want: -time.Hour},
+		{name: "No idle timeout", policy: Policy{Lifetime: 12 * time.Hour}, now: login.Add(2 * time.Hour), want: 10 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TTL(tt.policy, login, tt.now); got != tt.want {
+				t.Errorf("TTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockRemaining(t *testing.T) {
+	lockedAt := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	data := map[string]string{"locked": "1", "lockedAt": "1767254400"}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		now    time.Time
+		want   time.Duration
+	}{
+		{name: "Within lock timeout", policy: defaultPolicy, now: lockedAt.Add(4 * time.Minute), want: 6 * time.Minute},
+		{name: "Lock timed out", policy: defaultPolicy, now: lockedAt.Add(11 * time.Minute), want: -time.Minute},
+		{name: "No lock timeout", policy: Policy{}, now: lockedAt.Add(24 * time.Hour), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LockRemaining(data, tt.policy, tt.now); got != tt.want {
+				t.Errorf("LockRemaining() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockTimeoutAt(t *testing.T) {
+	login := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	autoLock := Policy{AutoLockAfter: 15 * time.Minute, LockTimeout: 10 * time.Minute}
+
+	tests := []struct {
+		name   string
+		data   map[string]string
+		policy Policy
+		want   time.Time
+		wantOK bool
+	}{
+		{
+			name:   "Locked session",
+			data:   map[string]string{"loginTime": "1767254400", "locked": "true", "lockedAt": "1767255000"},
+			policy: autoLock, want: login.Add(20 * time.Minute), wantOK: true,
+		},
+		{
+			name:   "Unlocked session times out after going idle",
+			data:   map[string]string{"loginTime": "1767254400", "lastActivity": "1767255000"},
+			policy: autoLock, want: login.Add(35 * time.Minute), wantOK: true,
+		},
+		{
+			name:   "Unlocked session without auto-lock",
+			data:   map[string]string{"loginTime": "1767254400"},
+			policy: defaultPolicy,
+		},
+		{
+			name:   "No lock timeout",
+			data:   map[string]string{"loginTime": "1767254400", "locked": "true", "lockedAt": "1767255000"},
+			policy: Policy{AutoLockAfter: 15 * time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := LockTimeoutAt(tt.data, tt.policy)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("LockTimeoutAt() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIdleLockAt(t *testing.T) {
+	login := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	policy := Policy{AutoLockAfter: 15 * time.Minute}
+
+	tests := []struct {
+		name     string
+		data     map[string]string
+		policy   Policy
+		now      time.Time
+		wantAt   time.Time
+		wantIdle bool
+	}{
+		{
+			name:   "Active session",
+			data:   map[string]string{"loginTime": "1767254400", "lastActivity": "1767254400"},
+			policy: policy, now: login.Add(10 * time.Minute),
+			wantAt: login.Add(15 * time.Minute),
+		},
+		{
+			name:   "Idle session locks when it went idle",
+			data:   map[string]string{"loginTime": "1767254400", "lastActivity": "1767255000"},
+			policy: policy, now: login.Add(time.Hour),
+			wantAt: login.Add(25 * time.Minute), wantIdle: true,
+		},
+		{
+			name:   "Without activity counts from login",
+			data:   map[string]string{"loginTime": "1767254400"},
+			policy: policy, now: login.Add(20 * time.Minute),
+			wantAt: login.Add(15 * time.Minute), wantIdle: true,
+		},
+		{
+			name:   "Already locked",
+			data:   map[string]string{"loginTime": "1767254400", "locked": "true"},
+			policy: policy, now: login.Add(time.Hour),
+		},
+		{
+			name:   "Auto-lock disabled",
+			data:   map[string]string{"loginTime": "1767254400"},
+			policy: Policy{}, now: login.Add(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, idle := IdleLockAt(tt.data, tt.policy, tt.now)
+			if idle != tt.wantIdle || !at.Equal(tt.wantAt) {
+				t.Errorf("IdleLockAt() = %v, %v, want %v, %v", at, idle, tt.wantAt, tt.wantIdle)
+			}
+		})
+	}
+}
+
+func TestSameSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      map[string]string
+		sessionID string
+		want      bool
+	}{
+		{name: "Token of the current session", data: map[string]string{"sid": "a1"}, sessionID: "a1", want: true},
+		{name: "Token of an ended session", data: map[string]string{"sid": "a1"}, sessionID: "b2", want: false},
+		{name: "Token without session ID", data: map[string]string{"sid": "a1"}, sessionID: "", want: false},
+		{name: "Session without ID", data: map[string]string{}, sessionID: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SameSession(tt.data, tt.sessionID); got != tt.want {
+				t.Errorf("SameSession() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLongestTokenTTL(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  time.Duration
+	}{
+		{name: "Default refresh TTL", input: "", want: 7 * 24 * time.Hour},
+		{name: "Longer role refresh TTL", input: "kiosk=refresh_ttl:720h, admin=refresh_ttl:1h", want: 720 * time.Hour},
+		{name: "Access TTL above every refresh TTL", input: "bot=access_ttl:200h", want: 200 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePolicies(defaultPolicy, tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.LongestTokenTTL(); got != tt.want {
+				t.Errorf("LongestTokenTTL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
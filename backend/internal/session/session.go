@@ -0,0 +1,188 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrExpired  = errors.New("session expired")
+	ErrNotFound = errors.New("session not found")
+)
+
+// touchScript records activity and slides the expiry only while the session exists, a session
+// revoked concurrently is not recreated
+var touchScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'lastActivity', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// lockScript locks the session only while it exists, HSET alone would recreate a revoked
+// session as a hash without expiry
+var lockScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'locked', 'true', 'lockedAt', ARGV[1])
+return 1
+`)
+
+func Key(userId string) string {
+	return fmt.Sprintf("session:%s", userId)
+}
+
+// RefreshTokenKey is where refresh token id of userId is stored, an id of "*" matches all of them
+func RefreshTokenKey(userId, id string) string {
+	return fmt.Sprintf("refresh_token:%s:%s", userId, id)
+}
+
+// TTL is how long a session may stay idle from now on: the idle timeout, capped by what
+// is left of its absolute lifetime
+func TTL(policy Policy, loginTime, now time.Time) time.Duration {
+	remaining := loginTime.Add(policy.Lifetime).Sub(now)
+	if policy.IdleTimeout > 0 && policy.IdleTimeout < remaining {
+		return policy.IdleTimeout
+	}
+	return remaining
+}
+
+// Touch records activity and slides the session expiry forward. It returns ErrExpired once
+// the absolute lifetime has passed and ErrNotFound when the session is gone.
+func Touch(ctx context.Context, redisClient *redis.Client, userId string, data map[string]string, policy Policy) error {
+	loginTime, _ := strconv.ParseInt(data["loginTime"], 10, 64)
+
+	now := time.Now()
+	ttl := TTL(policy, time.Unix(loginTime, 0), now)
+	if ttl <= 0 {
+		return ErrExpired
+	}
+
+	touched, err := touchScript.Run(ctx, redisClient, []string{Key(userId)}, now.Unix(), ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if touched == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Lock activates the lock screen on every tab, the lock timeout counts from at. It returns
+// ErrNotFound when the session is gone.
+func Lock(ctx context.Context, redisClient *redis.Client, userId string, at time.Time) error {
+	locked, err := lockScript.Run(ctx, redisClient, []string{Key(userId)}, at.Unix()).Int()
+	if err != nil {
+		return err
+	}
+	if locked == 0 {
+		return ErrNotFound
+	}
+
+	Publish(ctx, redisClient, userId, Event{Type: EventLocked, At: at.Unix()})
+	return nil
+}
+
+// LastActivity is when the session was last used, sessions without recorded activity count
+// from their login
+func LastActivity(data map[string]string) time.Time {
+	lastActivity, err := strconv.ParseInt(data["lastActivity"], 10, 64)
+	if err != nil {
+		lastActivity, _ = strconv.ParseInt(data["loginTime"], 10, 64)
+	}
+	return time.Unix(lastActivity, 0)
+}
+
+// IdleLockAt reports when an unlocked session went idle for longer than the policy allows,
+// ok is false while it is still active or auto-lock is disabled
+func IdleLockAt(data map[string]string, policy Policy, now time.Time) (time.Time, bool) {
+	if policy.AutoLockAfter <= 0 || IsLocked(data) {
+		return time.Time{}, false
+	}
+
+	lockAt := LastActivity(data).Add(policy.AutoLockAfter)
+	return lockAt, now.After(lockAt)
+}
+
+// Status is the state of a session as seen from outside, without counting as activity
+type Status struct {
+	Active   bool
+	Locked   bool
+	LockedAt time.Time
+}
+
+// Inspect reports whether the session of userId is still usable and whether it is locked,
+// applying the same lifetime, auto-lock and lock timeout rules as the auth middleware
+func Inspect(ctx context.Context, redisClient *redis.Client, userId, sessionID string, policy Policy) (Status, error) {
+	data, err := redisClient.HGetAll(ctx, Key(userId)).Result()
+	if err != nil || len(data) == 0 || !SameSession(data, sessionID) {
+		return Status{}, err
+	}
+
+	now := time.Now()
+	loginTime, _ := strconv.ParseInt(data["loginTime"], 10, 64)
+	if TTL(policy, time.Unix(loginTime, 0), now) <= 0 {
+		return Status{}, nil
+	}
+
+	if lockAt, idle := IdleLockAt(data, policy, now); idle {
+		data["locked"] = "true"
+		data["lockedAt"] = strconv.FormatInt(lockAt.Unix(), 10)
+	}
+	if !IsLocked(data) {
+		return Status{Active: true}, nil
+	}
+	if LockRemaining(data, policy, now) < 0 {
+		return Status{}, nil
+	}
+
+	lockedAt, _ := strconv.ParseInt(data["lockedAt"], 10, 64)
+	return Status{Active: true, Locked: true, LockedAt: time.Unix(lockedAt, 0)}, nil
+}
+
+// SameSession reports whether a token of sessionID belongs to the stored session. A token
+// without a session ID belongs to none.
+func SameSession(data map[string]string, sessionID string) bool {
+	return sessionID != "" && data["sid"] == sessionID
+}
+
+// IsLocked reports whether the lock screen is active
+func IsLocked(data map[string]string) bool {
+	return data["locked"] == "1" || data["locked"] == "true"
+}
+
+// LockTimeoutAt is when the session times out on the lock screen: its lock plus the lock
+// timeout, or for an unlocked session the moment it would go idle plus the lock timeout.
+// ok is false without a lock timeout, or for an unlocked session without auto-lock.
+func LockTimeoutAt(data map[string]string, policy Policy) (time.Time, bool) {
+	if policy.LockTimeout <= 0 {
+		return time.Time{}, false
+	}
+	if IsLocked(data) {
+		lockedAt, _ := strconv.ParseInt(data["lockedAt"], 10, 64)
+		return time.Unix(lockedAt, 0).Add(policy.LockTimeout), true
+	}
+	if policy.AutoLockAfter <= 0 {
+		return time.Time{}, false
+	}
+	return LastActivity(data).Add(policy.AutoLockAfter + policy.LockTimeout), true
+}
+
+// LockRemaining is how long a locked session may still be unlocked, a negative value means
+// the lock timed out. Without a lock timeout it is always the zero duration.
+func LockRemaining(data map[string]string, policy Policy, now time.Time) time.Duration {
+	if policy.LockTimeout <= 0 {
+		return 0
+	}
+
+	lockedAt, _ := strconv.ParseInt(data["lockedAt"], 10, 64)
+	return time.Unix(lockedAt, 0).Add(policy.LockTimeout).Sub(now)
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+	return redisClient, mr
+}
+
+func TestTouch(t *testing.T) {
+	ctx := context.Background()
+	redisClient, mr := newTestRedis(t)
+	recentLogin := map[string]string{"loginTime": strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)}
+
+	tests := []struct {
+		name    string
+		stored  bool
+		data    map[string]string
+		wantErr error
+	}{
+		{name: "Live session", stored: true, data: recentLogin},
+		{name: "Lifetime over", stored: true, data: map[string]string{"loginTime": "1767254400"}, wantErr: ErrExpired},
+		{name: "Revoked session", data: recentLogin, wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr.FlushAll()
+			if tt.stored {
+				mr.HSet(Key("7"), "sid", "s1")
+			}
+
+			err := Touch(ctx, redisClient, "7", tt.data, defaultPolicy)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Touch() error = %v, want %v", err, tt.wantErr)
+			}
+			if !tt.stored && mr.Exists(Key("7")) {
+				t.Fatal("Touch() recreated a revoked session")
+			}
+			if tt.wantErr == nil {
+				if mr.HGet(Key("7"), "lastActivity") == "" || mr.TTL(Key("7")) != defaultPolicy.IdleTimeout {
+					t.Errorf("activity = %q, ttl = %v, want recorded with the idle timeout", mr.HGet(Key("7"), "lastActivity"), mr.TTL(Key("7")))
+				}
+			}
+		})
+	}
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	redisClient, mr := newTestRedis(t)
+	at := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	mr.HSet(Key("7"), "sid", "s1")
+	mr.SetTTL(Key("7"), time.Minute)
+	if err := Lock(ctx, redisClient, "7", at); err != nil {
+		t.Fatal(err)
+	}
+	if mr.HGet(Key("7"), "locked") != "true" || mr.HGet(Key("7"), "lockedAt") != "1767254400" {
+		t.Errorf("locked = %q at %q, want locked at %d", mr.HGet(Key("7"), "locked"), mr.HGet(Key("7"), "lockedAt"), at.Unix())
+	}
+	if mr.TTL(Key("7")) != time.Minute {
+		t.Errorf("ttl = %v, want the session's expiry kept", mr.TTL(Key("7")))
+	}
+
+	if err := Lock(ctx, redisClient, "8", at); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lock() of a revoked session error = %v, want ErrNotFound", err)
+	}
+	if mr.Exists(Key("8")) {
+		t.Error("Lock() recreated a revoked session without expiry")
+	}
+}
@@ -2,8 +2,18 @@ package shared
 
 import "github.com/golang-jwt/jwt/v5"
 
+const TokenTypeRefresh = "refresh"
+
 type Claims struct {
 	UserID   string `json:"userId"`
 	Username string `json:"username"`
+	Role     string `json:"role"`
+	// the login the token belongs to, tokens of an ended session are rejected
+	SessionID string `json:"sid,omitempty"`
+	// set on tokens issued to OAuth clients, our own frontend's tokens have neither
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// TokenTypeRefresh on refresh tokens, empty on access tokens
+	TokenType string `json:"typ,omitempty"`
 	jwt.RegisteredClaims
 }
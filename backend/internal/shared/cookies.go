@@ -0,0 +1,10 @@
+package shared
+
+// Cookie transport: the tokens are HttpOnly cookies and state-changing requests carry the
+// session's CSRF token in CSRFHeader
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+)
@@ -18,3 +18,11 @@ func StringToIntWithDefault(s string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// StringWithDefault returns s, or defaultValue if s is empty
+func StringWithDefault(s string, defaultValue string) string {
+	if s == "" {
+		return defaultValue
+	}
+	return s
+}
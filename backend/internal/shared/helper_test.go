@@ -153,3 +153,40 @@ func TestStringToIntWithDefault(t *testing.T) {
 		})
 	}
 }
+
+func TestStringWithDefault(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		defaultValue string
+		want         string
+	}{
+		{
+			name:         "Non-empty string",
+			input:        "100MB",
+			defaultValue: "1GB",
+			want:         "100MB",
+		},
+		{
+			name:         "Empty string returns default",
+			input:        "",
+			defaultValue: "1GB",
+			want:         "1GB",
+		},
+		{
+			name:         "Whitespace is kept",
+			input:        " ",
+			defaultValue: "1GB",
+			want:         " ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := StringWithDefault(tt.input, tt.defaultValue)
+			if got != tt.want {
+				t.Errorf("StringWithDefault() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package shared
+
+// Scopes name the routes tokens of OAuth clients and API keys may reach, a route group opts
+// in with middleware.ScopedAuthMiddleware. Our own frontend's tokens are not scoped.
+const (
+	ScopeFiles = "files"
+	ScopeAdmin = "admin"
+)
@@ -0,0 +1,294 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"go-backend/internal/config"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const defaultK8sTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// AuthMethod obtains a Vault token. Login returns the auth secret so its TTL can be watched.
+type AuthMethod interface {
+	Name() string
+	Login(ctx context.Context, client *api.Client) (*api.Secret, error)
+}
+
+// NewAuthMethod builds the auth method selected by VAULT_AUTH_METHOD and checks its settings.
+// Without an explicit method, dev mode uses the static token and everything else Kubernetes.
+func NewAuthMethod() (AuthMethod, error) {
+	cfg := config.GetConfig()
+
+	method := cfg.Env.VAULT_AUTH_METHOD
+	if method == "" {
+		method = "kubernetes"
+		if cfg.Env.VAULT_DEV_MODE {
+			method = "token"
+		}
+	}
+
+	var missing []string
+	require := func(name, value string) {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	var auth AuthMethod
+	switch method {
+	case "token":
+		require("VAULT_TOKEN", cfg.Env.VAULT_TOKEN.Reveal())
+		auth = &TokenAuth{Token: cfg.Env.VAULT_TOKEN.Reveal()}
+	case "kubernetes":
+		require("VAULT_ROLE", cfg.Env.VAULT_ROLE)
+		auth = &KubernetesAuth{
+			Mount:     cfg.Env.VAULT_AUTH_MOUNT,
+			Role:      cfg.Env.VAULT_ROLE,
+			TokenPath: cfg.Env.VAULT_K8S_TOKEN_PATH,
+		}
+	case "approle":
+		require("VAULT_APPROLE_ROLE_ID", cfg.Env.VAULT_APPROLE_ROLE_ID)
+		require("VAULT_APPROLE_SECRET_ID", cfg.Env.VAULT_APPROLE_SECRET_ID.Reveal())
+		auth = &AppRoleAuth{
+			Mount:           cfg.Env.VAULT_AUTH_MOUNT,
+			RoleID:          cfg.Env.VAULT_APPROLE_ROLE_ID,
+			SecretID:        cfg.Env.VAULT_APPROLE_SECRET_ID.Reveal(),
+			SecretIDWrapped: cfg.Env.VAULT_APPROLE_SECRET_ID_WRAPPED,
+		}
+	case "userpass":
+		require("VAULT_USERNAME", cfg.Env.VAULT_USERNAME)
+		require("VAULT_PASSWORD", cfg.Env.VAULT_PASSWORD.Reveal())
+		auth = &UserpassAuth{
+			Mount:    cfg.Env.VAULT_AUTH_MOUNT,
+			Username: cfg.Env.VAULT_USERNAME,
+			Password: cfg.Env.VAULT_PASSWORD.Reveal(),
+		}
+	case "cert":
+		require("VAULT_CLIENT_CERT", cfg.Env.VAULT_CLIENT_CERT)
+		require("VAULT_CLIENT_KEY", cfg.Env.VAULT_CLIENT_KEY)
+		auth = &CertAuth{
+			Mount: cfg.Env.VAULT_AUTH_MOUNT,
+			Role:  cfg.Env.VAULT_ROLE,
+		}
+	default:
+		return nil, fmt.Errorf("unknown VAULT_AUTH_METHOD %q", method)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("vault %s auth requires %s", method, strings.Join(missing, ", "))
+	}
+
+	return auth, nil
+}
+
+// TokenAuth uses a pre-issued token, e.g. the root token of a dev server
+type TokenAuth struct {
+	Token string
+}
+
+func (a *TokenAuth) Name() string { return "token" }
+
+func (a *TokenAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	c, err := client.Clone()
+	if err != nil {
+		return nil, err
+	}
+	c.SetToken(a.Token)
+
+	lookup, err := c.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("vault token lookup: %w", err)
+	}
+
+	ttl, _ := lookup.TokenTTL()
+	renewable, _ := lookup.TokenIsRenewable()
+
+	return &api.Secret{
+		Auth: &api.SecretAuth{
+			ClientToken:   a.Token,
+			Renewable:     renewable,
+			LeaseDuration: int(ttl.Seconds()),
+		},
+	}, nil
+}
+
+// KubernetesAuth exchanges the pod's service account token for a Vault token
+type KubernetesAuth struct {
+	Mount     string
+	Role      string
+	TokenPath string
+}
+
+func (a *KubernetesAuth) Name() string { return "kubernetes" }
+
+func (a *KubernetesAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	tokenPath := a.TokenPath
+	if tokenPath == "" {
+		tokenPath = defaultK8sTokenPath
+	}
+
+	// read on every login, the kubelet rotates projected tokens
+	jwt, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return login(ctx, client, a.Name(), mountOrDefault(a.Mount, "kubernetes"), "login", map[string]interface{}{
+		"role": a.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+}
+
+// AppRoleAuth logs in with role_id and secret_id. When SecretIDWrapped is set, SecretID is a
+// response-wrapping token that is unwrapped on first use; the unwrapped secret_id is kept in
+// memory for later re-logins since the wrapping token is single-use.
+type AppRoleAuth struct {
+	Mount           string
+	RoleID          string
+	SecretID        string
+	SecretIDWrapped bool
+
+	mu        sync.Mutex
+	unwrapped string
+}
+
+func (a *AppRoleAuth) Name() string { return "approle" }
+
+func (a *AppRoleAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	secretID, err := a.secretID(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return login(ctx, client, a.Name(), mountOrDefault(a.Mount, "approle"), "login", map[string]interface{}{
+		"role_id":   a.RoleID,
+		"secret_id": secretID,
+	})
+}
+
+func (a *AppRoleAuth) secretID(ctx context.Context, client *api.Client) (string, error) {
+	if !a.SecretIDWrapped {
+		return a.SecretID, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.unwrapped != "" {
+		return a.unwrapped, nil
+	}
+
+	c, err := client.Clone()
+	if err != nil {
+		return "", err
+	}
+	c.ClearToken()
+
+	secret, err := c.Logical().UnwrapWithContext(ctx, a.SecretID)
+	if err != nil {
+		return "", fmt.Errorf("vault approle unwrap secret_id: %w", decodeError(err))
+	}
+	if secret == nil || secret.Data == nil {
+		return "", errors.New("vault approle unwrap secret_id: empty response")
+	}
+
+	secretID, ok := secret.Data["secret_id"].(string)
+	if !ok || secretID == "" {
+		return "", errors.New("vault approle unwrap secret_id: response has no secret_id")
+	}
+
+	a.unwrapped = secretID
+	return secretID, nil
+}
+
+// UserpassAuth logs in with a username and password
+type UserpassAuth struct {
+	Mount    string
+	Username string
+	Password string
+}
+
+func (a *UserpassAuth) Name() string { return "userpass" }
+
+func (a *UserpassAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	return login(ctx, client, a.Name(), mountOrDefault(a.Mount, "userpass"), "login/"+a.Username, map[string]interface{}{
+		"password": a.Password,
+	})
+}
+
+// CertAuth logs in with the TLS client certificate configured on the Vault client
+type CertAuth struct {
+	Mount string
+	Role  string
+}
+
+func (a *CertAuth) Name() string { return "cert" }
+
+func (a *CertAuth) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	data := map[string]interface{}{}
+	if a.Role != "" {
+		data["name"] = a.Role
+	}
+
+	return login(ctx, client, a.Name(), mountOrDefault(a.Mount, "cert"), "login", data)
+}
+
+func login(ctx context.Context, client *api.Client, method, mount, path string, data map[string]interface{}) (*api.Secret, error) {
+	// login endpoints are unauthenticated, never send a stale token along
+	c, err := client.Clone()
+	if err != nil {
+		return nil, err
+	}
+	c.ClearToken()
+
+	secret, err := c.Logical().WriteWithContext(ctx, fmt.Sprintf("auth/%s/%s", mount, path), data)
+	if err != nil {
+		return nil, fmt.Errorf("vault %s login: %w", method, decodeError(err))
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("vault %s login: response has no client token", method)
+	}
+
+	return secret, nil
+}
+
+// Error is a failed Vault request with the status code and messages decoded from the response body
+type Error struct {
+	StatusCode int
+	Errors     []string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func decodeError(err error) error {
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		return &Error{StatusCode: respErr.StatusCode, Errors: respErr.Errors, Err: err}
+	}
+	return err
+}
+
+func mountOrDefault(mount, defaultMount string) string {
+	if mount == "" {
+		return defaultMount
+	}
+	return strings.Trim(mount, "/")
+}
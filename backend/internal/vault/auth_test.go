@@ -0,0 +1,157 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// fakeVault answers the login endpoints used by the auth methods
+func fakeVault(t *testing.T) *api.Client {
+	mux := http.NewServeMux()
+
+	writeAuth := func(w http.ResponseWriter, token string) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   token,
+				"lease_duration": 3600,
+				"renewable":      true,
+			},
+		})
+	}
+	writeError := func(w http.ResponseWriter, status int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{msg}})
+	}
+
+	mux.HandleFunc("PUT /v1/auth/approle/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "unwrapped-secret" {
+			writeError(w, http.StatusBadRequest, "invalid role or secret ID")
+			return
+		}
+		writeAuth(w, "approle-token")
+	})
+	mux.HandleFunc("PUT /v1/sys/wrapping/unwrap", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "wrapping-token" {
+			writeError(w, http.StatusBadRequest, "wrapping token is not valid or does not exist")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"secret_id": "unwrapped-secret"},
+		})
+	})
+	mux.HandleFunc("PUT /v1/auth/userpass/login/{username}", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.PathValue("username") != "app" || body["password"] != "pass" {
+			writeError(w, http.StatusBadRequest, "invalid username or password")
+			return
+		}
+		writeAuth(w, "userpass-token")
+	})
+	mux.HandleFunc("PUT /v1/auth/cert/login", func(w http.ResponseWriter, r *http.Request) {
+		// an empty 200 body must not be mistaken for a successful login
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	cfg := api.DefaultConfig()
+	cfg.Address = server.URL
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("stale-token")
+	return client
+}
+
+func TestAuthMethods_Login(t *testing.T) {
+	client := fakeVault(t)
+
+	tests := []struct {
+		name       string
+		auth       AuthMethod
+		wantToken  string
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			name:      "AppRole with plain secret_id",
+			auth:      &AppRoleAuth{RoleID: "role", SecretID: "unwrapped-secret"},
+			wantToken: "approle-token",
+		},
+		{
+			name:      "AppRole with wrapped secret_id",
+			auth:      &AppRoleAuth{RoleID: "role", SecretID: "wrapping-token", SecretIDWrapped: true},
+			wantToken: "approle-token",
+		},
+		{
+			name:       "AppRole with invalid wrapping token",
+			auth:       &AppRoleAuth{RoleID: "role", SecretID: "used-token", SecretIDWrapped: true},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    true,
+		},
+		{
+			name:      "Userpass",
+			auth:      &UserpassAuth{Username: "app", Password: "pass"},
+			wantToken: "userpass-token",
+		},
+		{
+			name:       "Userpass with wrong password",
+			auth:       &UserpassAuth{Username: "app", Password: "nope"},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    true,
+		},
+		{
+			name:    "Cert with empty response",
+			auth:    &CertAuth{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := tt.auth.Login(context.Background(), client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantStatus != 0 {
+				var vaultErr *Error
+				if !errors.As(err, &vaultErr) || vaultErr.StatusCode != tt.wantStatus {
+					t.Errorf("Login() error = %v, want status %d", err, tt.wantStatus)
+				}
+			}
+
+			if !tt.wantErr && secret.Auth.ClientToken != tt.wantToken {
+				t.Errorf("Login() token = %v, want %v", secret.Auth.ClientToken, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestAppRoleAuth_ReusesUnwrappedSecretID(t *testing.T) {
+	client := fakeVault(t)
+	auth := &AppRoleAuth{RoleID: "role", SecretID: "wrapping-token", SecretIDWrapped: true}
+
+	for i := 0; i < 2; i++ {
+		if _, err := auth.Login(context.Background(), client); err != nil {
+			t.Fatalf("Login() #%d error = %v", i+1, err)
+		}
+	}
+
+	// the fake accepts the wrapping token repeatedly, so make sure the second login did not need it
+	auth.SecretID = "already-used"
+	if _, err := auth.Login(context.Background(), client); err != nil {
+		t.Errorf("Login() after unwrap error = %v", err)
+	}
+}
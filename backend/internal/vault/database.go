@@ -0,0 +1,185 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+type DatabaseCredentials struct {
+	Username string
+	Password string
+}
+
+// RotateFunc switches the application to new credentials. An error keeps the old lease in
+// use and the rotation is retried.
+type RotateFunc func(creds DatabaseCredentials) error
+
+// DatabaseCredentialManager leases short-lived credentials from the database secrets engine,
+// renews the lease while possible and rotates to a fresh lease before the current one expires
+type DatabaseCredentialManager struct {
+	client *api.Client
+	mount  string
+	role   string
+
+	mu     sync.Mutex
+	secret *api.Secret
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewDatabaseCredentialManager(client *api.Client, mount, role string) *DatabaseCredentialManager {
+	if mount == "" {
+		mount = "database"
+	}
+
+	return &DatabaseCredentialManager{
+		client: client,
+		mount:  mount,
+		role:   role,
+		done:   make(chan struct{}),
+	}
+}
+
+// Fetch leases a new set of credentials, which becomes the lease watched by Start
+func (m *DatabaseCredentialManager) Fetch(ctx context.Context) (DatabaseCredentials, error) {
+	secret, err := m.client.Logical().ReadWithContext(ctx, fmt.Sprintf("%s/creds/%s", m.mount, m.role))
+	if err != nil {
+		return DatabaseCredentials{}, fmt.Errorf("vault database credentials: %w", decodeError(err))
+	}
+	if secret == nil || secret.Data == nil {
+		return DatabaseCredentials{}, errors.New("vault database credentials: empty response")
+	}
+
+	username, _ := secret.Data["username"].(string)
+	password, _ := secret.Data["password"].(string)
+	if username == "" || password == "" {
+		return DatabaseCredentials{}, errors.New("vault database credentials: response has no username or password")
+	}
+
+	m.mu.Lock()
+	m.secret = secret
+	m.mu.Unlock()
+
+	log.Printf("✓ Leased database credentials %s (ttl %ds)", username, secret.LeaseDuration)
+	return DatabaseCredentials{Username: username, Password: password}, nil
+}
+
+// Start watches the lease obtained by Fetch and calls rotate with new credentials when it can
+// no longer be renewed. The old lease is left to expire so in-flight queries are not cut off.
+func (m *DatabaseCredentialManager) Start(ctx context.Context, rotate RotateFunc) {
+	ctx, m.cancel = context.WithCancel(ctx)
+	go m.run(ctx, rotate)
+}
+
+// Stop ends the watcher and revokes the current lease
+func (m *DatabaseCredentialManager) Stop() {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+
+	m.mu.Lock()
+	secret := m.secret
+	m.mu.Unlock()
+
+	if secret != nil && secret.LeaseID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := m.client.Sys().RevokeWithContext(ctx, secret.LeaseID); err != nil {
+			log.Printf("Database lease revoke failed: %v", err)
+		}
+	}
+}
+
+func (m *DatabaseCredentialManager) run(ctx context.Context, rotate RotateFunc) {
+	defer close(m.done)
+
+	for {
+		if err := m.watch(ctx); err != nil {
+			log.Printf("Database lease renewal stopped: %v", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		backoff := time.Second
+		for {
+			err := m.rotate(ctx, rotate)
+			if err == nil {
+				break
+			}
+
+			log.Printf("Database credential rotation failed, retrying in %s: %v", backoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+		}
+	}
+}
+
+func (m *DatabaseCredentialManager) rotate(ctx context.Context, rotate RotateFunc) error {
+	m.mu.Lock()
+	previous := m.secret
+	m.mu.Unlock()
+
+	creds, err := m.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := rotate(creds); err != nil {
+		// the new lease is unused, give it back and keep watching the previous one
+		m.mu.Lock()
+		unused := m.secret
+		m.secret = previous
+		m.mu.Unlock()
+		m.client.Sys().RevokeWithContext(ctx, unused.LeaseID)
+		return err
+	}
+
+	return nil
+}
+
+// watch renews the current lease and returns once it is close to its max TTL
+func (m *DatabaseCredentialManager) watch(ctx context.Context) error {
+	m.mu.Lock()
+	secret := m.secret
+	m.mu.Unlock()
+
+	if !secret.Renewable {
+		ttl := time.Duration(secret.LeaseDuration) * time.Second
+		select {
+		case <-ctx.Done():
+		case <-time.After(ttl * 4 / 5):
+		}
+		return nil
+	}
+
+	watcher, err := m.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		return err
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.DoneCh():
+			return err
+		case <-watcher.RenewCh():
+		}
+	}
+}
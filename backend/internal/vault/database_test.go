@@ -0,0 +1,242 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// databaseVault fakes the database secrets engine. Every read of the creds endpoint leases
+// v-app-<n> under lease-<n>, renewals of a lease in capped come back with 1s left as they do
+// once the lease reaches its max TTL.
+type databaseVault struct {
+	client *api.Client
+
+	mu            sync.Mutex
+	leaseDuration int
+	renewable     bool
+	leases        int
+	capped        map[string]bool
+	renewed       []string
+	revoked       []string
+}
+
+func newDatabaseVault(t *testing.T, leaseDuration int, renewable bool) *databaseVault {
+	v := &databaseVault{leaseDuration: leaseDuration, renewable: renewable, capped: map[string]bool{}}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /v1/database/creds/app", func(w http.ResponseWriter, r *http.Request) {
+		v.mu.Lock()
+		v.leases++
+		n := v.leases
+		v.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"lease_id":       fmt.Sprintf("lease-%d", n),
+			"lease_duration": v.leaseDuration,
+			"renewable":      v.renewable,
+			"data": map[string]interface{}{
+				"username": fmt.Sprintf("v-app-%d", n),
+				"password": "secret",
+			},
+		})
+	})
+	mux.HandleFunc("PUT /v1/sys/leases/renew", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		leaseID, _ := body["lease_id"].(string)
+
+		v.mu.Lock()
+		v.renewed = append(v.renewed, leaseID)
+		leaseDuration := v.leaseDuration
+		if v.capped[leaseID] {
+			leaseDuration = 1
+		}
+		v.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"lease_id":       leaseID,
+			"lease_duration": leaseDuration,
+			"renewable":      true,
+		})
+	})
+	mux.HandleFunc("PUT /v1/sys/leases/revoke", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		v.mu.Lock()
+		v.revoked = append(v.revoked, body["lease_id"].(string))
+		v.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	cfg := api.DefaultConfig()
+	cfg.Address = server.URL
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("app-token")
+	v.client = client
+	return v
+}
+
+func (v *databaseVault) cap(leaseID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.capped[leaseID] = true
+}
+
+func (v *databaseVault) renewedLeases() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return slices.Clone(v.renewed)
+}
+
+func (v *databaseVault) revokedLeases() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return slices.Clone(v.revoked)
+}
+
+// rotations records the credentials passed to the RotateFunc, failing the first fail calls
+type rotations struct {
+	mu    sync.Mutex
+	fail  int
+	creds []DatabaseCredentials
+}
+
+func (r *rotations) rotate(creds DatabaseCredentials) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail > 0 {
+		r.fail--
+		return errors.New("new pool unreachable")
+	}
+	r.creds = append(r.creds, creds)
+	return nil
+}
+
+func (r *rotations) usernames() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var usernames []string
+	for _, creds := range r.creds {
+		usernames = append(usernames, creds.Username)
+	}
+	return usernames
+}
+
+func TestDatabaseCredentialManager_Fetch(t *testing.T) {
+	v := newDatabaseVault(t, 60, true)
+	m := NewDatabaseCredentialManager(v.client, "", "app")
+
+	creds, err := m.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if creds != (DatabaseCredentials{Username: "v-app-1", Password: "secret"}) {
+		t.Errorf("Fetch() = %+v, want v-app-1", creds)
+	}
+
+	unknown := NewDatabaseCredentialManager(v.client, "", "missing")
+	if _, err := unknown.Fetch(context.Background()); err == nil {
+		t.Error("Fetch() of an unknown role error = nil, want error")
+	}
+}
+
+func TestDatabaseCredentialManager_Renewal(t *testing.T) {
+	v := newDatabaseVault(t, 60, true)
+	m := NewDatabaseCredentialManager(v.client, "", "app")
+	if _, err := m.Fetch(context.Background()); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	var r rotations
+	m.Start(context.Background(), r.rotate)
+
+	if !waitFor(t, 5*time.Second, func() bool { return len(v.renewedLeases()) > 0 }) {
+		t.Fatal("lease was not renewed")
+	}
+	m.Stop()
+
+	if got := v.renewedLeases()[0]; got != "lease-1" {
+		t.Errorf("renewed %v, want lease-1", got)
+	}
+	if got := r.usernames(); len(got) != 0 {
+		t.Errorf("rotated to %v, want no rotation while the lease renews", got)
+	}
+	if got := v.revokedLeases(); !slices.Equal(got, []string{"lease-1"}) {
+		t.Errorf("revoked on Stop() = %v, want [lease-1]", got)
+	}
+}
+
+func TestDatabaseCredentialManager_Rotation(t *testing.T) {
+	tests := []struct {
+		name          string
+		leaseDuration int
+		renewable     bool
+		// capped leases reach their max TTL on the first renewal
+		capped bool
+		// fail is how many rotations the application rejects
+		fail        int
+		wantRotated string
+		wantRevoked []string
+		// wantLease is the lease in use after the rotation
+		wantLease string
+	}{
+		{name: "Max TTL reached", leaseDuration: 60, renewable: true, capped: true, wantRotated: "v-app-2", wantLease: "lease-2"},
+		{name: "Non-renewable lease before it expires", leaseDuration: 1, wantRotated: "v-app-2", wantLease: "lease-2"},
+		{
+			name: "Rejected credentials are revoked and retried", leaseDuration: 60, renewable: true, capped: true, fail: 1,
+			wantRotated: "v-app-3", wantRevoked: []string{"lease-2"}, wantLease: "lease-3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newDatabaseVault(t, tt.leaseDuration, tt.renewable)
+			if tt.capped {
+				v.cap("lease-1")
+			}
+
+			m := NewDatabaseCredentialManager(v.client, "", "app")
+			if _, err := m.Fetch(context.Background()); err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+
+			r := rotations{fail: tt.fail}
+			m.Start(context.Background(), r.rotate)
+
+			if !waitFor(t, 5*time.Second, func() bool { return len(r.usernames()) > 0 }) {
+				m.Stop()
+				t.Fatal("credentials were not rotated")
+			}
+
+			if got := r.usernames()[0]; got != tt.wantRotated {
+				t.Errorf("rotated to %v, want %v", got, tt.wantRotated)
+			}
+			if got := v.revokedLeases(); !slices.Equal(got, tt.wantRevoked) {
+				t.Errorf("revoked %v, want %v", got, tt.wantRevoked)
+			}
+
+			// the old lease is left to expire, Stop revokes only the rotated-to lease
+			m.Stop()
+			if got := v.revokedLeases(); got[len(got)-1] != tt.wantLease {
+				t.Errorf("revoked on Stop() = %v, want %v last", got, tt.wantLease)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+type State string
+
+const (
+	StateAuthenticated    State = "authenticated"
+	StateReauthenticating State = "reauthenticating"
+	StateFailed           State = "failed"
+	StateStopped          State = "stopped"
+)
+
+// Status is a snapshot of the Vault token lifecycle, exposed through readiness
+type Status struct {
+	State       State      `json:"state"`
+	Renewable   bool       `json:"renewable"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	LastRenewal *time.Time `json:"lastRenewal,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// LoginFunc authenticates against Vault and returns the auth secret holding the client token
+type LoginFunc func(ctx context.Context) (*api.Secret, error)
+
+// TokenManager keeps the client token alive: it renews the token before its TTL runs out and
+// logs in again once renewal is no longer possible (max TTL reached, token revoked, non-renewable token)
+type TokenManager struct {
+	client *api.Client
+	login  LoginFunc
+
+	mu     sync.RWMutex
+	secret *api.Secret
+	status Status
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewTokenManager takes the secret of the initial login. login may be nil for static tokens,
+// in which case an expired token cannot be replaced.
+func NewTokenManager(client *api.Client, secret *api.Secret, login LoginFunc) *TokenManager {
+	m := &TokenManager{
+		client: client,
+		login:  login,
+		done:   make(chan struct{}),
+	}
+	m.setSecret(secret)
+	return m
+}
+
+func (m *TokenManager) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+	go m.run(ctx)
+}
+
+// Stop ends the background renewal and waits for it to exit. Tokens obtained through a login
+// are revoked so they do not outlive the process.
+func (m *TokenManager) Stop() {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+
+	if m.login != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := m.client.Auth().Token().RevokeSelfWithContext(ctx, ""); err != nil {
+			log.Printf("Vault token revoke failed: %v", err)
+		}
+	}
+
+	m.mu.Lock()
+	m.status.State = StateStopped
+	m.mu.Unlock()
+	log.Println("✓ Vault token manager stopped")
+}
+
+func (m *TokenManager) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+func (m *TokenManager) Ready() bool {
+	return m.Status().State == StateAuthenticated
+}
+
+func (m *TokenManager) run(ctx context.Context) {
+	defer close(m.done)
+
+	for {
+		err := m.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Vault token renewal stopped: %v", err)
+		} else {
+			log.Println("Vault token reached its max TTL")
+		}
+
+		if !m.relogin(ctx) {
+			return
+		}
+	}
+}
+
+// watch blocks while the current token stays valid and returns once it has to be replaced
+func (m *TokenManager) watch(ctx context.Context) error {
+	m.mu.RLock()
+	secret := m.secret
+	m.mu.RUnlock()
+
+	ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second
+
+	// root and other periodic-less tokens never expire
+	if ttl == 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	if !secret.Auth.Renewable {
+		// log in again at 80% of the lifetime, before the token dies
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(ttl * 4 / 5):
+			return errors.New("token is not renewable")
+		}
+	}
+
+	watcher, err := m.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		return err
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.DoneCh():
+			return err
+		case renewal := <-watcher.RenewCh():
+			m.mu.Lock()
+			now := time.Now()
+			m.status.LastRenewal = &now
+			if renewal.Secret != nil && renewal.Secret.Auth != nil {
+				expiresAt := now.Add(time.Duration(renewal.Secret.Auth.LeaseDuration) * time.Second)
+				m.status.ExpiresAt = &expiresAt
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// relogin retries the login with backoff until it succeeds or ctx is done
+func (m *TokenManager) relogin(ctx context.Context) bool {
+	if m.login == nil {
+		m.setFailed(errors.New("token expired and no login method is configured"))
+		return false
+	}
+
+	m.mu.Lock()
+	m.status.State = StateReauthenticating
+	m.mu.Unlock()
+
+	backoff := time.Second
+	for {
+		secret, err := m.login(ctx)
+		if err == nil && (secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "") {
+			err = errors.New("login returned no client token")
+		}
+		if err == nil {
+			m.client.SetToken(secret.Auth.ClientToken)
+			m.setSecret(secret)
+			log.Println("✓ Vault re-authenticated successfully")
+			return true
+		}
+
+		log.Printf("Vault re-login failed, retrying in %s: %v", backoff, err)
+		m.mu.Lock()
+		m.status.LastError = err.Error()
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+func (m *TokenManager) setSecret(secret *api.Secret) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.secret = secret
+	m.status = Status{
+		State:     StateAuthenticated,
+		Renewable: secret.Auth.Renewable,
+	}
+	if secret.Auth.LeaseDuration > 0 {
+		expiresAt := time.Now().Add(time.Duration(secret.Auth.LeaseDuration) * time.Second)
+		m.status.ExpiresAt = &expiresAt
+	}
+}
+
+func (m *TokenManager) setFailed(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.status.State = StateFailed
+	m.status.LastError = err.Error()
+	log.Printf("Vault authentication failed: %v", err)
+}
@@ -0,0 +1,234 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// tokenVault fakes the token endpoints. Renewals of a token in capped come back with 1s left,
+// as Vault does once a token reaches its max TTL.
+type tokenVault struct {
+	client *api.Client
+
+	mu       sync.Mutex
+	capped   map[string]bool
+	renewals int
+	revoked  []string
+}
+
+func newTokenVault(t *testing.T) *tokenVault {
+	v := &tokenVault{capped: map[string]bool{}}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("PUT /v1/auth/token/renew-self", func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Vault-Token")
+
+		v.mu.Lock()
+		v.renewals++
+		leaseDuration := 60
+		if v.capped[token] {
+			leaseDuration = 1
+		}
+		v.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   token,
+				"lease_duration": leaseDuration,
+				"renewable":      true,
+			},
+		})
+	})
+	mux.HandleFunc("PUT /v1/auth/token/revoke-self", func(w http.ResponseWriter, r *http.Request) {
+		v.mu.Lock()
+		v.revoked = append(v.revoked, r.Header.Get("X-Vault-Token"))
+		v.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	cfg := api.DefaultConfig()
+	cfg.Address = server.URL
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("initial-token")
+	v.client = client
+	return v
+}
+
+func (v *tokenVault) cap(token string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.capped[token] = true
+}
+
+func (v *tokenVault) renewalCount() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.renewals
+}
+
+func tokenSecret(token string, leaseDuration int, renewable bool) *api.Secret {
+	return &api.Secret{Auth: &api.SecretAuth{ClientToken: token, LeaseDuration: leaseDuration, Renewable: renewable}}
+}
+
+// waitFor polls cond until it holds or the timeout passes
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestTokenManager_Renewal(t *testing.T) {
+	v := newTokenVault(t)
+	m := NewTokenManager(v.client, tokenSecret("initial-token", 60, true), nil)
+	m.Start(context.Background())
+	defer m.Stop()
+
+	if !waitFor(t, 5*time.Second, func() bool { return m.Status().LastRenewal != nil }) {
+		t.Fatalf("Status() = %+v, want a renewal", m.Status())
+	}
+
+	status := m.Status()
+	if status.State != StateAuthenticated || !status.Renewable {
+		t.Errorf("Status() = %+v, want authenticated and renewable", status)
+	}
+	if status.ExpiresAt == nil || time.Until(*status.ExpiresAt) < 50*time.Second {
+		t.Errorf("Status().ExpiresAt = %v, want about a minute ahead", status.ExpiresAt)
+	}
+	if v.client.Token() != "initial-token" {
+		t.Errorf("client token = %v, want initial-token", v.client.Token())
+	}
+}
+
+func TestTokenManager_Relogin(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret *api.Secret
+		// capped tokens reach their max TTL on the first renewal
+		capped bool
+	}{
+		{name: "Max TTL reached", secret: tokenSecret("initial-token", 60, true), capped: true},
+		{name: "Non-renewable token before it expires", secret: tokenSecret("initial-token", 1, false)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTokenVault(t)
+			if tt.capped {
+				v.cap("initial-token")
+			}
+
+			var logins atomic.Int32
+			login := func(ctx context.Context) (*api.Secret, error) {
+				logins.Add(1)
+				return tokenSecret("new-token", 60, true), nil
+			}
+
+			m := NewTokenManager(v.client, tt.secret, login)
+			m.Start(context.Background())
+			defer m.Stop()
+
+			if !waitFor(t, 5*time.Second, func() bool { return v.client.Token() == "new-token" }) {
+				t.Fatalf("client token = %v, want new-token", v.client.Token())
+			}
+			if got := logins.Load(); got != 1 {
+				t.Errorf("login calls = %d, want 1", got)
+			}
+
+			status := m.Status()
+			if status.State != StateAuthenticated || status.LastError != "" {
+				t.Errorf("Status() = %+v, want authenticated without error", status)
+			}
+		})
+	}
+}
+
+func TestTokenManager_ReloginRetries(t *testing.T) {
+	v := newTokenVault(t)
+
+	var logins atomic.Int32
+	login := func(ctx context.Context) (*api.Secret, error) {
+		if logins.Add(1) == 1 {
+			return nil, errors.New("vault sealed")
+		}
+		return tokenSecret("new-token", 60, true), nil
+	}
+
+	m := NewTokenManager(v.client, tokenSecret("initial-token", 1, false), login)
+	m.Start(context.Background())
+	defer m.Stop()
+
+	if !waitFor(t, 2*time.Second, func() bool { return m.Status().State == StateReauthenticating }) {
+		t.Fatalf("Status() = %+v, want reauthenticating", m.Status())
+	}
+	if got := m.Status().LastError; got != "vault sealed" {
+		t.Errorf("Status().LastError = %q, want vault sealed", got)
+	}
+
+	if !waitFor(t, 5*time.Second, func() bool { return m.Status().State == StateAuthenticated }) {
+		t.Fatalf("Status() = %+v, want authenticated after the retry", m.Status())
+	}
+	if v.client.Token() != "new-token" || logins.Load() != 2 {
+		t.Errorf("client token = %v after %d logins, want new-token after 2", v.client.Token(), logins.Load())
+	}
+}
+
+func TestTokenManager_ExpiryWithoutLogin(t *testing.T) {
+	v := newTokenVault(t)
+	m := NewTokenManager(v.client, tokenSecret("initial-token", 1, false), nil)
+	m.Start(context.Background())
+
+	if !waitFor(t, 5*time.Second, func() bool { return m.Status().State == StateFailed }) {
+		t.Fatalf("Status() = %+v, want failed", m.Status())
+	}
+	if m.Ready() {
+		t.Error("Ready() = true, want false")
+	}
+	if v.renewalCount() != 0 {
+		t.Errorf("renewals = %d, want 0 for a non-renewable token", v.renewalCount())
+	}
+
+	// a static token is not the manager's to revoke
+	m.Stop()
+	if len(v.revoked) != 0 {
+		t.Errorf("revoked = %v, want none", v.revoked)
+	}
+}
+
+func TestTokenManager_Stop(t *testing.T) {
+	v := newTokenVault(t)
+	login := func(ctx context.Context) (*api.Secret, error) {
+		return tokenSecret("new-token", 60, true), nil
+	}
+
+	m := NewTokenManager(v.client, tokenSecret("initial-token", 60, true), login)
+	m.Start(context.Background())
+	m.Stop()
+
+	if got := m.Status().State; got != StateStopped {
+		t.Errorf("Status().State = %v, want %v", got, StateStopped)
+	}
+	if len(v.revoked) != 1 || v.revoked[0] != "initial-token" {
+		t.Errorf("revoked = %v, want [initial-token]", v.revoked)
+	}
+}
@@ -5,21 +5,31 @@ interface LockScreenProps {
     username: string;
     onUnlock: (password: string) => Promise<void>;
     onLogout: () => Promise<void>;
-    lockedAt: number;
+    // when the lock times out in local time, from check-session's timeRemaining. null when the
+    // policy has no lock timeout or it is not known yet.
+    expiresAt: number | null;
 }
 
-const LockScreen: React.FC<LockScreenProps> = ({ username, onUnlock, onLogout, lockedAt }) => {
+const secondsUntil = (expiresAt: number) => Math.max(0, Math.ceil((expiresAt - Date.now()) / 1000));
+
+const LockScreen: React.FC<LockScreenProps> = ({ username, onUnlock, onLogout, expiresAt }) => {
     const [password, setPassword] = useState('');
     const [error, setError] = useState('');
     const [loading, setLoading] = useState(false);
-    const [timeLeft, setTimeLeft] = useState(600); // 10 นาที = 600 วินาที
+    const [timeLeft, setTimeLeft] = useState<number | null>(expiresAt === null ? null : secondsUntil(expiresAt));
 
     useEffect(() => {
+        if (expiresAt === null) {
+            setTimeLeft(null);
+            return;
+        }
+        setTimeLeft(secondsUntil(expiresAt));
+
         const interval = setInterval(() => {
-            const elapsed = Math.floor((Date.now() - lockedAt) / 1000);
-            const remaining = 600 - elapsed; // 10 นาที
+            const remaining = secondsUntil(expiresAt);
 
             if (remaining <= 0) {
+                clearInterval(interval);
                 handleForceLogout();
             } else {
                 setTimeLeft(remaining);
@@ -27,7 +37,7 @@ const LockScreen: React.FC<LockScreenProps> = ({ username, onUnlock, onLogout, l
         }, 1000);
 
         return () => clearInterval(interval);
-    }, [lockedAt]);
+    }, [expiresAt]);
 
     const handleForceLogout = () => {
         onLogout();
@@ -100,6 +110,7 @@ const LockScreen: React.FC<LockScreenProps> = ({ username, onUnlock, onLogout, l
                     </button>
                 </form>
 
+                {timeLeft !== null && (
                 <div className="mt-6 p-4 bg-yellow-50 border border-yellow-200 rounded-lg">
                     <div className="flex items-center justify-between">
                         <div className="flex items-center text-yellow-800">
@@ -111,6 +122,7 @@ const LockScreen: React.FC<LockScreenProps> = ({ username, onUnlock, onLogout, l
                         <span className="text-lg font-bold text-yellow-900">{formatTime(timeLeft)}</span>
                     </div>
                 </div>
+                )}
 
                 <button
                     type="button"
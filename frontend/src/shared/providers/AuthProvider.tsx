@@ -8,11 +8,19 @@ interface AuthProviderProps {
     children: ReactNode;
 }
 
+// response of /auth/check-session, timeRemaining is only sent while locked with a lock timeout
+interface SessionState {
+    locked: boolean;
+    lockedAt?: number;
+    timeRemaining?: number;
+}
+
 export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     const [user, setUser] = useState<User | null>(null);
     const [isLoading, setIsLoading] = useState<boolean>(true);
     const [isLocked, setIsLocked] = useState<boolean>(false);
-    const [lockedAt, setLockedAt] = useState<number>(0);
+    // when the lock times out in local time, null without a lock timeout
+    const [lockExpiresAt, setLockExpiresAt] = useState<number | null>(null);
     const [isInitialized, setIsInitialized] = useState<boolean>(false);
 
     useIdleDetector({
@@ -25,18 +33,42 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
         },
     });
 
+    // the countdown runs on the server's timeRemaining, the local clock may differ from the server's
+    const applySessionState = useCallback((session: SessionState) => {
+        if (session.locked) {
+            setIsLocked(true);
+            setLockExpiresAt(session.timeRemaining !== undefined ? Date.now() + session.timeRemaining * 1000 : null);
+            localStorage.setItem('session_locked', 'true');
+            localStorage.setItem('session_locked_at', ((session.lockedAt ?? 0) * 1000).toString());
+        } else {
+            setIsLocked(false);
+            setLockExpiresAt(null);
+            localStorage.removeItem('session_locked');
+            localStorage.removeItem('session_locked_at');
+        }
+    }, []);
+
+    // fetchLockExpiry asks the server how long the lock screen may still be unlocked
+    const fetchLockExpiry = useCallback(async () => {
+        try {
+            const response = await api.get('/auth/check-session');
+            applySessionState(response.data);
+        } catch (error) {
+            console.error('Failed to check session:', error);
+        }
+    }, [applySessionState]);
+
     const syncLockState = useCallback(() => {
         const locked = localStorage.getItem('session_locked') === 'true';
-        const lockedTime = localStorage.getItem('session_locked_at');
 
         if (locked) {
             setIsLocked(true);
-            setLockedAt(lockedTime ? parseInt(lockedTime) : Date.now());
+            fetchLockExpiry();
         } else {
             setIsLocked(false);
-            setLockedAt(0);
+            setLockExpiresAt(null);
         }
-    }, []);
+    }, [fetchLockExpiry]);
 
     // check session status on mount
     useEffect(() => {
@@ -60,11 +92,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
                 // check if session is locked
                 const sessionResponse = await api.get('/auth/check-session');
                 if (sessionResponse.data.locked) {
-                    setIsLocked(true);
-                    const lockTime = sessionResponse.data.lockedAt * 1000;
-                    setLockedAt(lockTime);
-                    localStorage.setItem('session_locked', 'true');
-                    localStorage.setItem('session_locked_at', lockTime.toString());
+                    applySessionState(sessionResponse.data);
                 }
             } catch (error: unknown) {
                 console.error('Failed to initialize auth:', error);
@@ -91,11 +119,9 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
 
         // listen for session locked event from API Interceptor
         const handleSessionLocked = () => {
-            const lockTime = Date.now();
             setIsLocked(true);
-            setLockedAt(lockTime);
             localStorage.setItem('session_locked', 'true');
-            localStorage.setItem('session_locked_at', lockTime.toString());
+            fetchLockExpiry();
         };
         const handleStorageChange = (e: StorageEvent) => {
             if (e.key === 'session_locked') {
@@ -104,7 +130,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
                 if (!e.newValue) {
                     setUser(null);
                     setIsLocked(false);
-                    setLockedAt(0);
+                    setLockExpiresAt(null);
                     localStorage.removeItem('session_locked');
                     localStorage.removeItem('session_locked_at');
                 }
@@ -113,7 +139,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
                     const userData = JSON.parse(e.newValue);
                     setUser(userData);
                     setIsLocked(false);
-                    setLockedAt(0);
+                    setLockExpiresAt(null);
                 } catch (err) {
                     console.error('Failed to parse user data:', err);
                 }
@@ -127,7 +153,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
             window.removeEventListener('session-locked', handleSessionLocked);
             window.removeEventListener('storage', handleStorageChange);
         };
-    }, [syncLockState, isInitialized]);
+    }, [syncLockState, fetchLockExpiry, applySessionState, isInitialized]);
 
     const login = async (username: string, password: string) => {
         const response = await api.post('/auth/login', { username, password });
@@ -141,7 +167,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
 
         setUser(userData);
         setIsLocked(false);
-        setLockedAt(0);
+        setLockExpiresAt(null);
     };
 
     const logout = async () => {
@@ -158,20 +184,16 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
 
             setUser(null);
             setIsLocked(false);
-            setLockedAt(0);
+            setLockExpiresAt(null);
         }
     };
 
     const lockSession = async () => {
         try {
-            const response = await api.post('/auth/lock');
-            const lockTime = response.data.lockedAt * 1000;
-
-            setIsLocked(true);
-            setLockedAt(lockTime);
-
-            localStorage.setItem('session_locked', 'true');
-            localStorage.setItem('session_locked_at', lockTime.toString());
+            await api.post('/auth/lock');
+            // the lock response has no lock timeout, check-session knows how long is left
+            const response = await api.get('/auth/check-session');
+            applySessionState(response.data);
         } catch (error) {
             console.error('Lock session failed:', error);
 
@@ -183,7 +205,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
         try {
             await api.post('/auth/unlock', { password });
             setIsLocked(false);
-            setLockedAt(0);
+            setLockExpiresAt(null);
 
             localStorage.removeItem('session_locked');
             localStorage.removeItem('session_locked_at');
@@ -208,18 +230,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
 
     const checkSession = async () => {
         const response = await api.get('/auth/check-session');
-        if (response.data.locked) {
-            const lockTime = response.data.lockedAt * 1000;
-            setIsLocked(true);
-            setLockedAt(lockTime);
-            localStorage.setItem('session_locked', 'true');
-            localStorage.setItem('session_locked_at', lockTime.toString());
-        } else {
-            setIsLocked(false);
-            setLockedAt(0);
-            localStorage.removeItem('session_locked');
-            localStorage.removeItem('session_locked_at');
-        }
+        applySessionState(response.data);
     };
 
     const value: AuthContextType = {
@@ -236,7 +247,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     return (
         <AuthContext.Provider value={value}>
             {isLocked && user ? (
-                <LockScreen username={user.username} onUnlock={unlockSession} onLogout={logout} lockedAt={lockedAt} />
+                <LockScreen username={user.username} onUnlock={unlockSession} onLogout={logout} expiresAt={lockExpiresAt} />
             ) : (
                 children
             )}